@@ -0,0 +1,313 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/svuvi/theweek/imaging"
+	"github.com/svuvi/theweek/models"
+	"github.com/svuvi/theweek/repositories"
+)
+
+// Версия формата файла article export. Увеличивается при несовместимых изменениях
+const articleArchiveVersion = 1
+
+type articleArchive struct {
+	Version  int                `json:"version"`
+	Articles []*exportedArticle `json:"articles"`
+}
+
+// exportedArticle - статья в файле выгрузки. Рубрика и авторы хранятся по slug и логинам, а обложка целиком,
+// чтобы выгрузку можно было загрузить на другой сайт
+type exportedArticle struct {
+	Slug        string               `json:"slug"`
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	TextMD      string               `json:"text_md"`
+	Section     string               `json:"section,omitempty"`
+	Status      models.ArticleStatus `json:"status"`
+	CreatedAt   time.Time            `json:"created_at"`
+	PublishAt   *time.Time           `json:"publish_at,omitempty"`
+	Authors     []string             `json:"authors"`
+	Cover       *exportedImage       `json:"cover,omitempty"`
+}
+
+type exportedImage struct {
+	Filename string `json:"filename"`
+	Content  []byte `json:"content"` // base64
+}
+
+var importSlugRegexp = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+func runArticleExport(fs *flag.FlagSet, args []string) error {
+	output := fs.String("o", "-", "файл для выгрузки, - для стандартного вывода")
+	cfg, err := loadConfig(fs, args, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	blobs, err := openBlobStore(cfg, conn)
+	if err != nil {
+		return err
+	}
+	articleRepo := repositories.NewArticleRepo(conn)
+	sectionRepo := repositories.NewSectionRepo(conn)
+	imageRepo := repositories.NewImageRepo(conn, blobs)
+
+	var articles []*models.Article
+	if fs.NArg() == 0 {
+		if articles, err = articleRepo.GetAll(); err != nil {
+			return err
+		}
+	}
+	for _, slug := range fs.Args() {
+		a, err := articleRepo.GetBySlug(slug)
+		if err != nil {
+			return fmt.Errorf("статья %s не найдена", slug)
+		}
+		articles = append(articles, a)
+	}
+
+	sections := map[int]string{}
+	all, err := sectionRepo.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, s := range all {
+		sections[s.ID] = s.Slug
+	}
+
+	archive := articleArchive{Version: articleArchiveVersion, Articles: []*exportedArticle{}}
+	for _, a := range articles {
+		e := &exportedArticle{
+			Slug:        a.Slug,
+			Title:       a.Title,
+			Description: a.Description,
+			TextMD:      a.TextMD,
+			Section:     sections[a.SectionID],
+			Status:      a.Status,
+			CreatedAt:   a.CreatedAt.UTC(),
+			Authors:     a.Authors,
+		}
+		if !a.PublishAt.IsZero() {
+			t := a.PublishAt.UTC()
+			e.PublishAt = &t
+		}
+		if a.CoverImageID != 0 {
+			img, err := imageRepo.Get(a.CoverImageID)
+			if err != nil {
+				return fmt.Errorf("не удалось загрузить обложку статьи %s:\n%w", a.Slug, err)
+			}
+			e.Cover = &exportedImage{Filename: img.Filename, Content: img.Content}
+		}
+		archive.Articles = append(archive.Articles, e)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(archive); err != nil {
+		return fmt.Errorf("ошибка при записи выгрузки:\n%w", err)
+	}
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "Выгружено статей: %d\n", len(archive.Articles))
+	}
+	return nil
+}
+
+func runArticleImport(fs *flag.FlagSet, args []string) error {
+	update := fs.Bool("update", false, "перезаписывать статьи с совпадающим slug (по умолчанию они пропускаются)")
+	fallbackAuthor := fs.String("author", "", "автор для статей, авторов которых нет на этом сайте")
+	cfg, err := loadConfig(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	var archive articleArchive
+	if err = json.NewDecoder(r).Decode(&archive); err != nil {
+		return fmt.Errorf("файл не похож на выгрузку статей:\n%w", err)
+	}
+	if archive.Version != articleArchiveVersion {
+		return fmt.Errorf("неподдерживаемая версия выгрузки: %d", archive.Version)
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	blobs, err := openBlobStore(cfg, conn)
+	if err != nil {
+		return err
+	}
+
+	im := &articleImporter{
+		articleRepo: repositories.NewArticleRepo(conn),
+		userRepo:    repositories.NewUserRepo(conn),
+		sectionRepo: repositories.NewSectionRepo(conn),
+		imageRepo:   repositories.NewImageRepo(conn, blobs),
+		update:      *update,
+	}
+	if *fallbackAuthor != "" {
+		if im.fallbackAuthor, err = im.userRepo.GetByUsername(*fallbackAuthor); err != nil {
+			return fmt.Errorf("пользователь %s не найден", *fallbackAuthor)
+		}
+	}
+
+	created, updated, skipped := 0, 0, 0
+	for _, e := range archive.Articles {
+		result, err := im.importArticle(e)
+		if err != nil {
+			return fmt.Errorf("статья %s:\n%w", e.Slug, err)
+		}
+		switch result {
+		case importCreated:
+			created++
+		case importUpdated:
+			updated++
+		case importSkipped:
+			fmt.Fprintf(os.Stderr, "Статья %s уже есть, пропускаю (перезаписать: -update)\n", e.Slug)
+			skipped++
+		}
+	}
+
+	fmt.Printf("Создано статей: %d, обновлено: %d, пропущено: %d\n", created, updated, skipped)
+	return nil
+}
+
+type importResult int
+
+const (
+	importCreated importResult = iota
+	importUpdated
+	importSkipped
+)
+
+type articleImporter struct {
+	articleRepo    models.ArticleRepository
+	userRepo       models.UserRepository
+	sectionRepo    models.SectionRepository
+	imageRepo      models.ImageRepository
+	update         bool
+	fallbackAuthor *models.User
+}
+
+func (im *articleImporter) importArticle(e *exportedArticle) (importResult, error) {
+	if !importSlugRegexp.MatchString(e.Slug) {
+		return 0, errors.New("ссылка может содержать только латинские буквы в нижнем регистре, цифры и дефис")
+	}
+	if e.Title == "" || e.TextMD == "" {
+		return 0, errors.New("у статьи нет заголовка или текста")
+	}
+	if !e.Status.Valid() {
+		return 0, fmt.Errorf("неизвестный статус %q", e.Status)
+	}
+
+	existing, err := im.articleRepo.GetBySlug(e.Slug)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	found := err == nil
+	if found && !im.update {
+		return importSkipped, nil
+	}
+
+	authors, err := im.resolveAuthors(e.Authors)
+	if err != nil {
+		return 0, err
+	}
+
+	a := &models.Article{
+		Slug:        e.Slug,
+		Title:       e.Title,
+		Description: e.Description,
+		TextMD:      e.TextMD,
+		Status:      e.Status,
+		CreatedAt:   e.CreatedAt,
+	}
+	if e.PublishAt != nil {
+		a.PublishAt = *e.PublishAt
+	}
+	if e.Section != "" {
+		if section, err := im.sectionRepo.GetBySlug(e.Section); err == nil {
+			a.SectionID = section.ID
+		} else {
+			fmt.Fprintf(os.Stderr, "Статья %s: рубрики %s нет на этом сайте, статья будет без рубрики\n", e.Slug, e.Section)
+		}
+	}
+	if e.Cover != nil {
+		cover, renditions, err := imaging.Process(e.Cover.Content)
+		if err != nil {
+			return 0, fmt.Errorf("обложка %s:\n%w", e.Cover.Filename, err)
+		}
+		cover.Filename, cover.UploadedBy = e.Cover.Filename, authors[0]
+		if a.CoverImageID, err = im.imageRepo.Create(cover, renditions); err != nil {
+			return 0, fmt.Errorf("ошибка при сохранении обложки:\n%w", err)
+		}
+	}
+
+	result := importCreated
+	if found {
+		a.ID = existing.ID
+		result = importUpdated
+	}
+	// При обновлении дата берётся из файла, а без неё ставится текущая, как у новой статьи
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+	if err = im.articleRepo.Save(a, authors, authors[0]); err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// resolveAuthors находит авторов по логинам. Неизвестные логины пропускаются, а если не нашлось никого,
+// автором становится пользователь из флага -author
+func (im *articleImporter) resolveAuthors(usernames []string) ([]int, error) {
+	var ids []int
+	for _, username := range usernames {
+		user, err := im.userRepo.GetByUsername(username)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Автора %s нет на этом сайте\n", username)
+			continue
+		}
+		ids = append(ids, user.ID)
+	}
+	if len(ids) == 0 {
+		if im.fallbackAuthor == nil {
+			return nil, errors.New("ни одного автора статьи нет на этом сайте, укажите автора флагом -author")
+		}
+		ids = append(ids, im.fallbackAuthor.ID)
+	}
+	return ids, nil
+}
@@ -0,0 +1,221 @@
+// Package backup хранит резервные копии базы данных в отдельной папке и удаляет устаревшие по правилам хранения.
+// Копии называются theweek-<вид>-<время UTC>.db, так что список копий и их возраст читаются прямо из имён файлов
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/svuvi/theweek/db"
+)
+
+type Kind string
+
+const (
+	KindHourly Kind = "hourly"
+	KindDaily  Kind = "daily"
+	KindManual Kind = "manual"
+)
+
+// Label возвращает название вида копии для интерфейса
+func (k Kind) Label() string {
+	switch k {
+	case KindHourly:
+		return "Ежечасная"
+	case KindDaily:
+		return "Ежедневная"
+	case KindManual:
+		return "Вручную"
+	}
+	return string(k)
+}
+
+// Policy - сколько последних копий каждого вида хранить
+type Policy struct {
+	KeepHourly int
+	KeepDaily  int
+	KeepManual int
+}
+
+func (p Policy) keep(k Kind) int {
+	switch k {
+	case KindHourly:
+		return p.KeepHourly
+	case KindDaily:
+		return p.KeepDaily
+	}
+	return p.KeepManual
+}
+
+type Snapshot struct {
+	Name      string
+	Kind      Kind
+	CreatedAt time.Time
+	Size      int64
+}
+
+const timeFormat = "20060102-150405"
+
+var nameRegexp = regexp.MustCompile(`^theweek-(hourly|daily|manual)-(\d{8}-\d{6})\.db$`)
+
+var (
+	ErrNotFound = errors.New("копия не найдена")
+	ErrDisabled = errors.New("папка для резервных копий не настроена (backup.dir)")
+)
+
+type Store struct {
+	db     *sql.DB
+	dir    string
+	policy Policy
+
+	// Копии снимаются по одной: по расписанию и из панели управления одновременно
+	mu sync.Mutex
+}
+
+// NewStore возвращает хранилище копий базы db в папке dir. С пустым dir копии не создаются
+func NewStore(db *sql.DB, dir string, policy Policy) *Store {
+	return &Store{db: db, dir: dir, policy: policy}
+}
+
+func (s *Store) Enabled() bool {
+	return s.dir != ""
+}
+
+// Create снимает копию базы, проверяет её целостность и удаляет устаревшие копии того же вида
+func (s *Store) Create(kind Kind) (*Snapshot, error) {
+	if !s.Enabled() {
+		return nil, ErrDisabled
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// В копии есть хэши паролей и сессии, поэтому она доступна только владельцу
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	name := fmt.Sprintf("theweek-%s-%s.db", kind, now.Format(timeFormat))
+	path := filepath.Join(s.dir, name)
+	if err := db.Backup(s.db, path); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.prune(kind); err != nil {
+		return nil, fmt.Errorf("копия создана, но не удалось удалить устаревшие:\n%w", err)
+	}
+	return &Snapshot{Name: name, Kind: kind, CreatedAt: now.Truncate(time.Second), Size: info.Size()}, nil
+}
+
+// List возвращает копии, новые первыми. Посторонние файлы в папке пропускаются
+func (s *Store) List() ([]*Snapshot, error) {
+	if !s.Enabled() {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, e := range entries {
+		snapshot, ok := parseName(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // файл удалили, пока читали папку
+		}
+		snapshot.Size = info.Size()
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt) })
+	return snapshots, nil
+}
+
+func parseName(name string) (*Snapshot, bool) {
+	m := nameRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return nil, false
+	}
+	createdAt, err := time.Parse(timeFormat, m[2])
+	if err != nil {
+		return nil, false
+	}
+	return &Snapshot{Name: name, Kind: Kind(m[1]), CreatedAt: createdAt}, true
+}
+
+// Path возвращает путь к копии по имени. Принимаются только имена копий, поэтому выйти за пределы папки нельзя
+func (s *Store) Path(name string) (string, error) {
+	if _, ok := parseName(name); !ok || !s.Enabled() {
+		return "", ErrNotFound
+	}
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+// Due сообщает, пора ли снять копию вида kind: ежечасную раз в час, ежедневную раз в сутки.
+// Время берётся из последней копии, так что перезапуски сайта не создают лишних копий
+func (s *Store) Due(kind Kind, now time.Time) (bool, error) {
+	if !s.Enabled() || s.policy.keep(kind) == 0 {
+		return false, nil
+	}
+	period := time.Hour
+	if kind == KindDaily {
+		period = 24 * time.Hour
+	}
+
+	snapshots, err := s.List()
+	if err != nil {
+		return false, err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Kind == kind {
+			// Небольшой запас, чтобы копия по часовому таймеру не сдвигалась на следующий час
+			return now.Sub(snapshot.CreatedAt) >= period-time.Minute, nil
+		}
+	}
+	return true, nil
+}
+
+// prune оставляет последние копии вида kind в количестве, заданном политикой
+func (s *Store) prune(kind Kind) error {
+	snapshots, err := s.List()
+	if err != nil {
+		return err
+	}
+	kept := 0
+	var errs []error
+	for _, snapshot := range snapshots {
+		if snapshot.Kind != kind {
+			continue
+		}
+		kept++
+		if kept > s.policy.keep(kind) {
+			if err = os.Remove(filepath.Join(s.dir, snapshot.Name)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+		kind Kind
+	}{
+		{"theweek-hourly-20260101-120000.db", true, KindHourly},
+		{"theweek-daily-20260101-000000.db", true, KindDaily},
+		{"theweek-manual-20261231-235959.db", true, KindManual},
+		{"theweek-weekly-20260101-120000.db", false, ""},
+		{"theweek-daily-20261301-000000.db", false, ""}, // 13-й месяц
+		{"theweek-daily-20260101-000000.db-journal", false, ""},
+		{"../theweek-daily-20260101-000000.db", false, ""},
+		{"database.db", false, ""},
+	}
+	for _, tt := range tests {
+		s, ok := parseName(tt.name)
+		if ok != tt.ok || ok && s.Kind != tt.kind {
+			t.Errorf("parseName(%q) = %+v, %v", tt.name, s, ok)
+		}
+	}
+}
+
+// storeWithFiles создаёт хранилище с пустыми файлами копий с указанными именами
+func storeWithFiles(t *testing.T, policy Policy, names ...string) *Store {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewStore(nil, dir, policy)
+}
+
+func TestStorePrune(t *testing.T) {
+	s := storeWithFiles(t, Policy{KeepHourly: 2, KeepDaily: 1, KeepManual: 5},
+		"theweek-hourly-20260101-100000.db",
+		"theweek-hourly-20260101-110000.db",
+		"theweek-hourly-20260101-120000.db",
+		"theweek-daily-20251231-000000.db",
+		"theweek-daily-20260101-000000.db",
+		"theweek-manual-20250101-000000.db",
+		"notes.txt",
+	)
+	if err := s.prune(KindHourly); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.prune(KindDaily); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.Name)
+	}
+	want := []string{
+		"theweek-hourly-20260101-120000.db",
+		"theweek-hourly-20260101-110000.db",
+		"theweek-daily-20260101-000000.db",
+		"theweek-manual-20250101-000000.db",
+	}
+	if len(names) != len(want) {
+		t.Fatalf("остались копии %v, ожидалось %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("остались копии %v, ожидалось %v", names, want)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(s.dir, "notes.txt")); err != nil {
+		t.Errorf("посторонний файл удалён: %v", err)
+	}
+}
+
+func TestStoreDue(t *testing.T) {
+	last := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := storeWithFiles(t, Policy{KeepHourly: 24, KeepDaily: 14},
+		"theweek-hourly-"+last.Format(timeFormat)+".db",
+		"theweek-daily-"+last.Format(timeFormat)+".db",
+	)
+
+	tests := []struct {
+		kind Kind
+		now  time.Time
+		want bool
+	}{
+		{KindHourly, last.Add(30 * time.Minute), false},
+		{KindHourly, last.Add(59*time.Minute + 30*time.Second), true}, // запас в минуту
+		{KindHourly, last.Add(2 * time.Hour), true},
+		{KindDaily, last.Add(23 * time.Hour), false},
+		{KindDaily, last.Add(24 * time.Hour), true},
+		{KindManual, last.Add(24 * time.Hour), false}, // KeepManual = 0
+	}
+	for _, tt := range tests {
+		got, err := s.Due(tt.kind, tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Due(%s, +%v) = %v, ожидалось %v", tt.kind, tt.now.Sub(last), got, tt.want)
+		}
+	}
+
+	// Без копий этого вида копия нужна сразу
+	empty := storeWithFiles(t, Policy{KeepHourly: 1})
+	if due, _ := empty.Due(KindHourly, last); !due {
+		t.Error("первая копия не запланирована")
+	}
+}
+
+func TestStorePath(t *testing.T) {
+	s := storeWithFiles(t, Policy{}, "theweek-manual-20260101-000000.db", "secret.db")
+
+	if path, err := s.Path("theweek-manual-20260101-000000.db"); err != nil || filepath.Dir(path) != s.dir {
+		t.Errorf("Path существующей копии: %q, %v", path, err)
+	}
+	for _, name := range []string{"secret.db", "../secret.db", "theweek-manual-20260102-000000.db", ""} {
+		if _, err := s.Path(name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Path(%q): %v", name, err)
+		}
+	}
+
+	disabled := NewStore(nil, "", Policy{KeepManual: 1})
+	if _, err := disabled.Create(KindManual); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Create без папки: %v", err)
+	}
+}
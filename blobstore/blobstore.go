@@ -0,0 +1,37 @@
+// Package blobstore хранит содержимое загруженных файлов вне базы данных: в папке на диске или в S3-совместимом
+// хранилище. Файлы адресуются SHA-256 своего содержимого, поэтому одинаковые загрузки хранятся один раз,
+// а записанный файл никогда не меняется
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+)
+
+var ErrNotFound = errors.New("файла нет в хранилище")
+
+var keyRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type Store interface {
+	// Put сохраняет содержимое и возвращает его ключ. Повторная запись того же содержимого ничего не меняет
+	Put(ctx context.Context, content []byte, contentType string) (string, error)
+	// Open открывает файл для чтения. Если файла нет, возвращает ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete удаляет файл. Удаление отсутствующего файла не считается ошибкой
+	Delete(ctx context.Context, key string) error
+}
+
+// Key возвращает ключ содержимого - SHA-256 в шестнадцатеричном виде
+func Key(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidKey проверяет, что строка похожа на ключ. Ключи попадают в пути и адреса, поэтому другие строки не принимаются
+func ValidKey(key string) bool {
+	return keyRegexp.MatchString(key)
+}
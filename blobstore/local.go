@@ -0,0 +1,83 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local хранит файлы в папке dir: ключ ab12cd... лежит в dir/ab/12/ab12cd..., чтобы в одной папке
+// не скапливались десятки тысяч файлов
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+func (s *Local) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key[2:4], key)
+}
+
+func (s *Local) Put(ctx context.Context, content []byte, contentType string) (string, error) {
+	key := Key(content)
+	path := s.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("не удалось создать папку хранилища:\n%w", err)
+	}
+	// Сначала пишем во временный файл: после переименования файл либо целый, либо его нет
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *Local) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if !ValidKey(key) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *Local) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return nil
+	}
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := NewLocal(dir)
+	content := []byte("картинка")
+
+	key, err := s.Put(ctx, content, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != Key(content) || !ValidKey(key) {
+		t.Fatalf("ключ %q не совпадает с SHA-256 содержимого", key)
+	}
+
+	// Файл лежит в dir/ab/cd/abcd...
+	path := filepath.Join(dir, key[:2], key[2:4], key)
+	onDisk, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(onDisk) != string(content) {
+		t.Errorf("на диске %q, ожидалось %q", onDisk, content)
+	}
+
+	// Повторная запись того же содержимого даёт тот же ключ и не оставляет временных файлов
+	if again, err := s.Put(ctx, content, "image/png"); err != nil || again != key {
+		t.Errorf("повторный Put: ключ %q, ошибка %v", again, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("в папке файла %d записей, ожидалась одна", len(entries))
+	}
+
+	f, err := s.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, _ := io.ReadAll(f)
+	f.Close()
+	if string(read) != string(content) {
+		t.Errorf("Open прочитал %q", read)
+	}
+
+	if err = s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("файл не удалён: %v", err)
+	}
+	if err = s.Delete(ctx, key); err != nil {
+		t.Errorf("удаление отсутствующего файла: %v", err)
+	}
+	if _, err = s.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open удалённого файла: %v", err)
+	}
+}
+
+func TestLocalRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "secret")
+	if err := os.WriteFile(outside, []byte("секрет"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewLocal(filepath.Join(dir, "store"))
+
+	for _, key := range []string{"", "../../secret", "ABCDEF", Key(nil)[:63], Key(nil) + "0"} {
+		if _, err := s.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q): %v", key, err)
+		}
+		if err := s.Delete(ctx, key); err != nil {
+			t.Errorf("Delete(%q): %v", key, err)
+		}
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("файл вне хранилища пропал: %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SHA-256 пустого тела запроса
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+type S3Options struct {
+	// Адрес сервиса, например https://s3.eu-central-1.amazonaws.com или http://127.0.0.1:9000
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string // добавляется к ключам, например "images/"
+	AccessKey string
+	SecretKey string
+	// Адреса вида endpoint/bucket/key вместо bucket.endpoint/key. Нужны MinIO и большинству самостоятельно
+	// развёрнутых хранилищ
+	PathStyle bool
+}
+
+// S3 хранит файлы в бакете S3-совместимого хранилища. Запросы подписываются AWS Signature Version 4
+type S3 struct {
+	opts   S3Options
+	base   *url.URL
+	client *http.Client
+}
+
+func NewS3(opts S3Options) (*S3, error) {
+	base, err := url.Parse(strings.TrimRight(opts.Endpoint, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("адрес S3 должен быть вида https://s3.example.com, получено %q", opts.Endpoint)
+	}
+	if !opts.PathStyle {
+		base.Host = opts.Bucket + "." + base.Host
+	}
+	return &S3{opts: opts, base: base, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.base
+	path := strings.TrimRight(u.Path, "/")
+	if s.opts.PathStyle {
+		path += "/" + url.PathEscape(s.opts.Bucket)
+	}
+	for _, segment := range strings.Split(s.opts.Prefix+key, "/") {
+		path += "/" + url.PathEscape(segment)
+	}
+	u.Path, u.RawPath = path, path
+	return &u
+}
+
+func (s *S3) Put(ctx context.Context, content []byte, contentType string) (string, error) {
+	key := Key(content)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// Ключ и есть SHA-256 тела, так что хранилище само проверит, что файл дошёл целым
+	resp, err := s.do(req, key)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return key, nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if !ValidKey(key) {
+		return nil, ErrNotFound
+	}
+	o := &s3Object{store: s, ctx: ctx, key: key}
+	if err := o.get(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, emptyPayloadHash)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do подписывает и отправляет запрос. Ответ 404 превращается в ErrNotFound, остальные ошибки - в текст с кодом S3
+func (s *S3) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к S3:\n%w", err)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	code := string(body)
+	if _, rest, ok := strings.Cut(code, "<Code>"); ok {
+		code, _, _ = strings.Cut(rest, "</Code>")
+	}
+	return nil, fmt.Errorf("S3 ответил %s на %s %s: %s", resp.Status, req.Method, req.URL.Path, code)
+}
+
+// sign добавляет к запросу подпись AWS Signature Version 4. Подписываются host, range и заголовки x-amz-*
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + s.opts.Region + "/s3/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.opts.SecretKey)
+	for _, part := range []string{amzDate[:8], s.opts.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Object читает объект по мере надобности. Открытие сразу запрашивает объект целиком: обычно его
+// и отдают целиком. После перемотки в другое место (запрос части файла) делается новый запрос с Range
+type s3Object struct {
+	store *S3
+	ctx   context.Context
+	key   string
+	size  int64
+	off   int64
+
+	body    io.ReadCloser
+	bodyOff int64 // позиция body в объекте
+}
+
+func (o *s3Object) get() error {
+	req, err := http.NewRequestWithContext(o.ctx, http.MethodGet, o.store.objectURL(o.key).String(), nil)
+	if err != nil {
+		return err
+	}
+	if o.off > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", o.off))
+	}
+	resp, err := o.store.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		// Content-Range: bytes 100-199/200
+		_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		if o.size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("S3 вернул непонятный Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+	case o.off > 0:
+		resp.Body.Close()
+		return errors.New("S3 не поддерживает чтение части файла")
+	default:
+		o.size = resp.ContentLength
+	}
+	o.body, o.bodyOff = resp.Body, o.off
+	return nil
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.off >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil || o.bodyOff != o.off {
+		o.closeBody()
+		if err := o.get(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := o.body.Read(p)
+	o.off += int64(n)
+	o.bodyOff += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.off
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("неизвестный whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("отрицательная позиция")
+	}
+	o.off = offset
+	return offset, nil
+}
+
+func (o *s3Object) closeBody() {
+	if o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+}
+
+func (o *s3Object) Close() error {
+	o.closeBody()
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/svuvi/theweek/repositories"
+)
+
+func runInviteCreate(fs *flag.FlagSet, args []string) error {
+	n := fs.Int("n", 1, "количество приглашений")
+	cfg, err := loadConfig(fs, args, 0, 0)
+	if err != nil {
+		return err
+	}
+	if *n < 1 || *n > 100 {
+		return errors.New("за раз можно создать от 1 до 100 приглашений")
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	inviteRepo := repositories.NewInviteRepo(conn)
+
+	for range *n {
+		invite, err := inviteRepo.Create()
+		if err != nil {
+			return fmt.Errorf("ошибка при создании приглашения:\n%w", err)
+		}
+		fmt.Printf("%s/invite/%s\n", cfg.BaseURL, invite.Code)
+	}
+	return nil
+}
+
+func runRecoveryCodeCreate(fs *flag.FlagSet, args []string) error {
+	cfg, err := loadConfig(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	user, err := repositories.NewUserRepo(conn).GetByUsername(fs.Arg(0))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("пользователь %s не найден", fs.Arg(0))
+	} else if err != nil {
+		return err
+	}
+
+	rCode, err := repositories.NewRecoveryCodeRepo(conn).Create(user.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании кода восстановления:\n%w", err)
+	}
+	fmt.Printf("Ссылка для восстановления пароля %s:\n%s/account/restore-password?code=%s\n", user.Username, cfg.BaseURL, rCode.RecoveryCode)
+	return nil
+}
@@ -2,10 +2,17 @@ package components
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
 	"log"
+	"path"
 	"strings"
+	"time"
 
-	"github.com/yuin/goldmark"
+	"github.com/svuvi/theweek/imaging"
+	"github.com/svuvi/theweek/models"
 )
 
 // String is the result string, bool indicates if it was trimmed
@@ -34,11 +41,213 @@ func trimToRowsOrChars(s string, maxRows, maxChars int) (string, bool) {
 	return strings.Join(trimmedRows, "\n"), trimmed
 }
 
+// MarkdownToHTML рендерит Markdown текст статьи в HTML так же, как на странице статьи
+func MarkdownToHTML(md string) string {
+	return mdStringToHTML(md)
+}
+
 func mdStringToHTML(md string) string {
 	var buf bytes.Buffer
-	if err := goldmark.Convert([]byte(md), &buf); err != nil {
+	if err := markdown.Convert([]byte(md), &buf); err != nil {
 		log.Println("Error when parsing markdown string:\n", err, "\nThe string:\n", md)
 	}
 
 	return buf.String()
 }
+
+// highlightMarks экранирует строку из результата поиска и заменяет маркеры совпадений на <mark>
+func highlightMarks(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, models.SearchMarkStart, "<mark>")
+	s = strings.ReplaceAll(s, models.SearchMarkEnd, "</mark>")
+	return s
+}
+
+type csrfTokenKey struct{}
+
+// WithCSRFToken кладёт CSRF-токен посетителя в контекст запроса, откуда его берут формы и layouts.Base
+func WithCSRFToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, csrfTokenKey{}, token)
+}
+
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfTokenKey{}).(string)
+	return token
+}
+
+// CSRFHeaders возвращает значение атрибута hx-headers, чтобы htmx отправлял токен с каждым запросом
+func CSRFHeaders(ctx context.Context) string {
+	headers, _ := json.Marshal(map[string]string{"X-CSRF-Token": CSRFToken(ctx)})
+	return string(headers)
+}
+
+type userKey struct{}
+
+// WithUser кладёт вошедшего пользователя в контекст запроса. Шапка, layouts и обработчики берут его оттуда
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// CurrentUser возвращает вошедшего пользователя. Для гостей возвращается пользователь с ID=0
+func CurrentUser(ctx context.Context) *models.User {
+	if user, ok := ctx.Value(userKey{}).(*models.User); ok {
+		return user
+	}
+	return &models.User{}
+}
+
+type sectionsKey struct{}
+
+// WithSections кладёт список рубрик в контекст запроса. Шапка и форма публикации берут рубрики оттуда
+func WithSections(ctx context.Context, sections []*models.Section) context.Context {
+	return context.WithValue(ctx, sectionsKey{}, sections)
+}
+
+func sectionsFromContext(ctx context.Context) []*models.Section {
+	sections, _ := ctx.Value(sectionsKey{}).([]*models.Section)
+	return sections
+}
+
+// navSections возвращает рубрики для верхнего (top = true) или нижнего ряда навигации
+func navSections(ctx context.Context, top bool) []*models.Section {
+	var res []*models.Section
+	for _, s := range sectionsFromContext(ctx) {
+		if (top && s.InNavTop) || (!top && s.InNavBottom) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// datetimeLocalValue форматирует время для <input type="datetime-local">. Нулевое время даёт пустую строку
+func datetimeLocalValue(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("2006-01-02T15:04")
+}
+
+// DescribeUserAgent возвращает короткое описание браузера и системы для списка сессий, например "Firefox, Windows".
+// Полная строка User-Agent показывается во всплывающей подсказке
+func DescribeUserAgent(ua string) string {
+	if ua == "" {
+		return "Неизвестное устройство"
+	}
+
+	// Порядок важен: Edge и Opera содержат "Chrome", Chrome содержит "Safari"
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"YaBrowser/", "Яндекс Браузер"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := ""
+	for _, s := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + ", " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	// Не браузер, например curl: показываем название программы
+	name, _, _ := strings.Cut(ua, " ")
+	return name
+}
+
+// Site - название и публичный адрес сайта из настроек
+type Site struct {
+	Name   string
+	URL    string            // без завершающего слэша
+	Static map[string]string // путь файла внутри static/ -> адрес с отпечатком содержимого
+}
+
+type siteKey struct{}
+
+// WithSite кладёт название и адрес сайта в контекст запроса для заголовков страниц и мета-тегов
+func WithSite(ctx context.Context, site Site) context.Context {
+	return context.WithValue(ctx, siteKey{}, site)
+}
+
+func SiteName(ctx context.Context) string {
+	site, _ := ctx.Value(siteKey{}).(Site)
+	return site.Name
+}
+
+// AbsoluteURL дополняет путь от корня сайта публичным адресом, например для og:url
+func AbsoluteURL(ctx context.Context, path string) string {
+	site, _ := ctx.Value(siteKey{}).(Site)
+	return site.URL + path
+}
+
+// StaticURL возвращает адрес файла из static/ с отпечатком содержимого, например /static/style.3f2a1b9c0d.css.
+// Адрес меняется вместе с файлом, поэтому браузер хранит его без перепроверки
+func StaticURL(ctx context.Context, name string) string {
+	site, _ := ctx.Value(siteKey{}).(Site)
+	if url, ok := site.Static[name]; ok {
+		return url
+	}
+	return "/static/" + name
+}
+
+// FormatSize форматирует размер файла, например "1МБ" или "512КБ"
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dМБ", n>>20)
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fМБ", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%dКБ", n>>10)
+	}
+	return fmt.Sprintf("%dБ", n)
+}
+
+// ImageURL возвращает адрес картинки. При width > 0 сервер отдаёт самую узкую копию не уже width пикселей
+func ImageURL(id, width int) string {
+	if width > 0 {
+		return fmt.Sprintf("/images/%d?w=%d", id, width)
+	}
+	return fmt.Sprint("/images/", id)
+}
+
+// ImageSrcset перечисляет копии картинки для атрибута srcset. Если картинка уже какой-то из ширин,
+// по этому адресу отдаётся оригинал, так что ссылки не ведут в пустоту
+func ImageSrcset(id int) string {
+	candidates := make([]string, len(imaging.Widths))
+	for i, width := range imaging.Widths {
+		candidates[i] = fmt.Sprintf("%s %dw", ImageURL(id, width), width)
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// MarkdownImageSnippet возвращает Markdown для вставки картинки в текст статьи.
+// Подпись берётся из имени файла без расширения
+func MarkdownImageSnippet(img *models.Image) string {
+	alt := strings.TrimSuffix(img.Filename, path.Ext(img.Filename))
+	alt = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(alt)
+	return fmt.Sprintf("![%s](%s)", alt, ImageURL(img.ID, 0))
+}
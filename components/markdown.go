@@ -0,0 +1,133 @@
+package components
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// markdown - рендерер текстов статей. Картинки с сайта, стоящие отдельным абзацем, превращаются в <figure>
+var markdown = goldmark.New(
+	goldmark.WithParserOptions(parser.WithASTTransformers(util.Prioritized(figureTransformer{}, 100))),
+	goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(figureRenderer{}, 100))),
+)
+
+// Ширина колонки текста статьи, см. .article-content в style.css
+const articleFigureSizes = "(max-width: 600px) 100vw, 600px"
+
+// Ссылка на загруженную картинку: /images/12 или /images/12?w=640
+var localImageRegexp = regexp.MustCompile(`^/images/(\d+)(\?.*)?$`)
+
+var kindFigure = ast.NewNodeKind("Figure")
+
+// figure - картинка с сайта с подписью. Заменяет абзац, в котором кроме картинки ничего нет
+type figure struct {
+	ast.BaseBlock
+	imageID int
+	alt     string
+	caption string
+}
+
+func (n *figure) Kind() ast.NodeKind {
+	return kindFigure
+}
+
+func (n *figure) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"ImageID": strconv.Itoa(n.imageID), "Caption": n.caption}, nil)
+}
+
+type figureTransformer struct{}
+
+func (figureTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var paragraphs []*ast.Paragraph
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if p, ok := n.(*ast.Paragraph); ok && entering {
+			paragraphs = append(paragraphs, p)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// Абзацы заменяются после обхода, чтобы не менять дерево во время Walk
+	for _, p := range paragraphs {
+		img, ok := p.FirstChild().(*ast.Image)
+		if !ok || p.ChildCount() != 1 {
+			continue
+		}
+		m := localImageRegexp.FindSubmatch(img.Destination)
+		if m == nil {
+			continue
+		}
+		id, err := strconv.Atoi(string(m[1]))
+		if err != nil {
+			continue
+		}
+
+		// Подпись - title картинки, а если его нет, то описание: ![Подпись](/images/12)
+		f := &figure{imageID: id, alt: unescapeMarkdown([]byte(plainText(img, source))), caption: unescapeMarkdown(img.Title)}
+		if f.caption == "" {
+			f.caption = f.alt
+		}
+		p.Parent().ReplaceChild(p.Parent(), p, f)
+	}
+}
+
+// plainText собирает текст внутри узла без разметки, как goldmark делает для alt
+func plainText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Value(source))
+			if c.SoftLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		default:
+			b.WriteString(plainText(c, source))
+		}
+	}
+	return b.String()
+}
+
+// unescapeMarkdown убирает экранирование \[ и раскрывает &amp; и &#123;, как goldmark делает при выводе текста
+func unescapeMarkdown(b []byte) string {
+	return string(util.ResolveEntityNames(util.ResolveNumericReferences(util.UnescapePunctuations(b))))
+}
+
+type figureRenderer struct{}
+
+func (figureRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindFigure, renderFigure)
+}
+
+func renderFigure(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*figure)
+	w.WriteString(`<figure class="article-figure"><img src="`)
+	w.WriteString(html.EscapeString(ImageURL(n.imageID, 1024)))
+	w.WriteString(`" srcset="`)
+	w.WriteString(html.EscapeString(ImageSrcset(n.imageID)))
+	w.WriteString(`" sizes="` + articleFigureSizes + `" alt="`)
+	w.WriteString(html.EscapeString(n.alt))
+	w.WriteString(`" loading="lazy" decoding="async">`)
+	if n.caption != "" {
+		w.WriteString("<figcaption>")
+		w.WriteString(html.EscapeString(n.caption))
+		w.WriteString("</figcaption>")
+	}
+	w.WriteString("</figure>\n")
+	return ast.WalkSkipChildren, nil
+}
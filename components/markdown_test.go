@@ -0,0 +1,99 @@
+package components
+
+import "testing"
+
+// Атрибуты <img> в figure для картинки 12
+const figureImg12 = `<img src="/images/12?w=1024" srcset="/images/12?w=320 320w, /images/12?w=640 640w, /images/12?w=1024 1024w, /images/12?w=1600 1600w" sizes="(max-width: 600px) 100vw, 600px"`
+
+func TestMarkdownFigures(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{
+			"картинка отдельным абзацем",
+			"![Закат](/images/12)",
+			`<figure class="article-figure">` + figureImg12 + ` alt="Закат" loading="lazy" decoding="async"><figcaption>Закат</figcaption></figure>` + "\n",
+		},
+		{
+			"между абзацами текста",
+			"До\n\n![Закат](/images/12)\n\nПосле",
+			"<p>До</p>\n" + `<figure class="article-figure">` + figureImg12 + ` alt="Закат" loading="lazy" decoding="async"><figcaption>Закат</figcaption></figure>` + "\n<p>После</p>\n",
+		},
+		{
+			"ссылка с шириной",
+			"![Закат](/images/12?w=640)",
+			`<figure class="article-figure">` + figureImg12 + ` alt="Закат" loading="lazy" decoding="async"><figcaption>Закат</figcaption></figure>` + "\n",
+		},
+		{
+			"title важнее alt",
+			`![Закат над морем](/images/12 "Фото: автор")`,
+			`<figure class="article-figure">` + figureImg12 + ` alt="Закат над морем" loading="lazy" decoding="async"><figcaption>Фото: автор</figcaption></figure>` + "\n",
+		},
+		{
+			"без alt и title нет подписи",
+			"![](/images/12)",
+			`<figure class="article-figure">` + figureImg12 + ` alt="" loading="lazy" decoding="async"></figure>` + "\n",
+		},
+		{
+			"alt без разметки",
+			"![Закат *над* `морем`](/images/12)",
+			`<figure class="article-figure">` + figureImg12 + ` alt="Закат над морем" loading="lazy" decoding="async"><figcaption>Закат над морем</figcaption></figure>` + "\n",
+		},
+		{
+			"экранирование alt и подписи",
+			`!["Том & Джерри" <3 \[1\]](/images/12 "<script>alert('x')</script> &amp; ещё")`,
+			`<figure class="article-figure">` + figureImg12 +
+				` alt="&#34;Том &amp; Джерри&#34; &lt;3 [1]" loading="lazy" decoding="async">` +
+				`<figcaption>&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt; &amp; ещё</figcaption></figure>` + "\n",
+		},
+		{
+			"HTML-теги в alt отбрасываются",
+			"![<b>Закат</b>](/images/12)",
+			`<figure class="article-figure">` + figureImg12 + ` alt="Закат" loading="lazy" decoding="async"><figcaption>Закат</figcaption></figure>` + "\n",
+		},
+		{
+			"картинка в строке с текстом",
+			"Смотрите ![Закат](/images/12) внизу",
+			`<p>Смотрите <img src="/images/12" alt="Закат"> внизу</p>` + "\n",
+		},
+		{
+			"две картинки в одном абзаце",
+			"![А](/images/1) ![Б](/images/2)",
+			`<p><img src="/images/1" alt="А"> <img src="/images/2" alt="Б"></p>` + "\n",
+		},
+		{
+			"картинка внутри ссылки",
+			"[![Закат](/images/12)](/articles/sunset)",
+			`<p><a href="/articles/sunset"><img src="/images/12" alt="Закат"></a></p>` + "\n",
+		},
+		{
+			"картинка с другого сайта",
+			"![Закат](https://example.com/images/12)",
+			`<p><img src="https://example.com/images/12" alt="Закат"></p>` + "\n",
+		},
+		{
+			"не картинка сайта",
+			"![Логотип](/static/images/12)",
+			`<p><img src="/static/images/12" alt="Логотип"></p>` + "\n",
+		},
+		{
+			"без номера",
+			"![Закат](/images/sunset.png)",
+			`<p><img src="/images/sunset.png" alt="Закат"></p>` + "\n",
+		},
+		{
+			"в цитате",
+			"> ![Закат](/images/12)",
+			"<blockquote>\n" + `<figure class="article-figure">` + figureImg12 + ` alt="Закат" loading="lazy" decoding="async"><figcaption>Закат</figcaption></figure>` + "\n</blockquote>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mdStringToHTML(tt.md); got != tt.want {
+				t.Errorf("получено\n%s\nожидалось\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+// Package config собирает настройки сервера из флагов командной строки, переменных окружения
+// и необязательного файла в формате TOML. Приоритет: флаги, затем окружение, затем файл, затем значения по умолчанию
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/svuvi/theweek/backup"
+	"github.com/svuvi/theweek/blobstore"
+	"github.com/svuvi/theweek/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Config struct {
+	// Адрес, на котором слушает HTTP-сервер
+	ListenAddr string
+	// Путь к файлу базы данных SQLite
+	DBPath string
+	// Публичный адрес сайта без завершающего слэша, например https://theweek.svuvich.nl.
+	// Из него строятся абсолютные ссылки в лентах и мета-тегах, и он же - источник для ключей доступа
+	BaseURL string
+	// Название сайта в заголовках страниц, лентах и приложениях-аутентификаторах
+	SiteName string
+
+	// Флаг Secure у куки. Выключается только для разработки без HTTPS
+	CookieSecure bool
+	// Атрибут SameSite у куки: lax или strict
+	CookieSameSite string
+
+	// Максимальный размер загружаемой картинки (обложки, аватара) в байтах. Оригиналы крупнее
+	// imaging.MaxDimension уменьшаются, поэтому в хранилище они занимают заметно меньше
+	MaxImageSize int64
+	// Максимальный размер формы с файлами в байтах
+	MaxFormSize int64
+
+	// Стоимость bcrypt для новых хэшей паролей
+	BcryptCost int
+
+	SessionMaxAge      time.Duration
+	SessionIdleTimeout time.Duration
+
+	// Сколько ждать завершения начатых запросов при остановке сервера
+	ShutdownTimeout time.Duration
+
+	// Папка для резервных копий базы данных. Пустая строка отключает копии по расписанию
+	BackupDir string
+	// Сколько хранить ежечасных, ежедневных и созданных вручную копий
+	BackupKeepHourly int
+	BackupKeepDaily  int
+	BackupKeepManual int
+
+	// Где хранятся загруженные файлы: local - папка StorageDir, s3 - бакет S3-совместимого хранилища.
+	// В базе остаются только имена и ключи файлов, поэтому резервные копии базы картинок не содержат
+	StorageBackend string
+	StorageDir     string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3Prefix       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3PathStyle    bool
+}
+
+// Default возвращает настройки, с которыми сайт работал до появления конфигурации
+func Default() *Config {
+	return &Config{
+		ListenAddr:         ":8080",
+		DBPath:             "database.db",
+		BaseURL:            "https://theweek.svuvich.nl",
+		SiteName:           "The Week",
+		CookieSecure:       true,
+		CookieSameSite:     "lax",
+		MaxImageSize:       20 << 20,
+		MaxFormSize:        25 << 20,
+		BcryptCost:         14,
+		SessionMaxAge:      30 * 24 * time.Hour,
+		SessionIdleTimeout: 7 * 24 * time.Hour,
+		ShutdownTimeout:    30 * time.Second,
+		BackupDir:          "backups",
+		BackupKeepHourly:   24,
+		BackupKeepDaily:    14,
+		BackupKeepManual:   10,
+		StorageBackend:     "local",
+		StorageDir:         "media",
+		S3Region:           "us-east-1",
+	}
+}
+
+// Префикс переменных окружения: THEWEEK_LISTEN_ADDR и т.д.
+const envPrefix = "THEWEEK_"
+
+// setting связывает поле конфигурации с флагом, переменной окружения и ключом в файле
+type setting struct {
+	flag  string
+	key   string // ключ в файле; "раздел.ключ" для ключей внутри [раздела]
+	usage string
+}
+
+// env возвращает имя переменной окружения, например cookie.same_site -> THEWEEK_COOKIE_SAME_SITE
+func (s setting) env() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+// Load регистрирует флаги настроек в fs, разбирает args и дополняет результат окружением и файлом настроек.
+// Путь к файлу задаётся флагом -config или переменной THEWEEK_CONFIG.
+// Собственные флаги команды нужно зарегистрировать в fs до вызова Load
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	c := Default()
+	configPath := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "путь к файлу настроек в формате TOML")
+	settings := c.register(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var file map[string]string
+	if *configPath != "" {
+		var err error
+		if file, err = readFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	known := map[string]bool{}
+	for _, s := range settings {
+		known[s.key] = true
+		if explicit[s.flag] {
+			continue
+		}
+
+		value, source, ok := "", "", false
+		if v, found := os.LookupEnv(s.env()); found {
+			value, source, ok = v, "переменная "+s.env(), true
+		} else if v, found := file[s.key]; found {
+			value, source, ok = v, fmt.Sprintf("%s: %s", *configPath, s.key), true
+		}
+		if ok {
+			if err := fs.Lookup(s.flag).Value.Set(value); err != nil {
+				return nil, fmt.Errorf("%s: %w", source, err)
+			}
+		}
+	}
+	for key := range file {
+		if !known[key] {
+			return nil, fmt.Errorf("%s: неизвестная настройка %s", *configPath, key)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) register(fs *flag.FlagSet) []setting {
+	var settings []setting
+	str := func(p *string, s setting) {
+		fs.StringVar(p, s.flag, *p, s.usage)
+		settings = append(settings, s)
+	}
+	str(&c.ListenAddr, setting{"listen", "listen_addr", "адрес HTTP-сервера"})
+	str(&c.DBPath, setting{"db", "db_path", "путь к файлу базы данных"})
+	str(&c.BaseURL, setting{"base-url", "base_url", "публичный адрес сайта"})
+	str(&c.SiteName, setting{"site-name", "site_name", "название сайта"})
+	str(&c.CookieSameSite, setting{"cookie-same-site", "cookie.same_site", "атрибут SameSite куки: lax или strict"})
+
+	s := setting{"cookie-secure", "cookie.secure", "ставить куки флаг Secure (выключать только для разработки без HTTPS)"}
+	fs.BoolVar(&c.CookieSecure, s.flag, c.CookieSecure, s.usage)
+	settings = append(settings, s)
+
+	s = setting{"max-image-size", "upload.max_image_size", "максимальный размер картинки в байтах"}
+	fs.Int64Var(&c.MaxImageSize, s.flag, c.MaxImageSize, s.usage)
+	settings = append(settings, s)
+	s = setting{"max-form-size", "upload.max_form_size", "максимальный размер формы с файлами в байтах"}
+	fs.Int64Var(&c.MaxFormSize, s.flag, c.MaxFormSize, s.usage)
+	settings = append(settings, s)
+
+	s = setting{"bcrypt-cost", "bcrypt_cost", "стоимость bcrypt для хэшей паролей"}
+	fs.IntVar(&c.BcryptCost, s.flag, c.BcryptCost, s.usage)
+	settings = append(settings, s)
+
+	s = setting{"session-max-age", "session.max_age", "срок жизни сессии с момента входа"}
+	fs.DurationVar(&c.SessionMaxAge, s.flag, c.SessionMaxAge, s.usage)
+	settings = append(settings, s)
+	s = setting{"session-idle-timeout", "session.idle_timeout", "срок жизни сессии без запросов"}
+	fs.DurationVar(&c.SessionIdleTimeout, s.flag, c.SessionIdleTimeout, s.usage)
+	settings = append(settings, s)
+
+	s = setting{"shutdown-timeout", "shutdown_timeout", "сколько ждать завершения начатых запросов при остановке"}
+	fs.DurationVar(&c.ShutdownTimeout, s.flag, c.ShutdownTimeout, s.usage)
+	settings = append(settings, s)
+
+	str(&c.BackupDir, setting{"backup-dir", "backup.dir", "папка для резервных копий базы данных, пустая - без копий по расписанию"})
+	s = setting{"backup-keep-hourly", "backup.keep_hourly", "сколько хранить ежечасных копий"}
+	fs.IntVar(&c.BackupKeepHourly, s.flag, c.BackupKeepHourly, s.usage)
+	settings = append(settings, s)
+	s = setting{"backup-keep-daily", "backup.keep_daily", "сколько хранить ежедневных копий"}
+	fs.IntVar(&c.BackupKeepDaily, s.flag, c.BackupKeepDaily, s.usage)
+	settings = append(settings, s)
+	s = setting{"backup-keep-manual", "backup.keep_manual", "сколько хранить копий, созданных вручную"}
+	fs.IntVar(&c.BackupKeepManual, s.flag, c.BackupKeepManual, s.usage)
+	settings = append(settings, s)
+
+	str(&c.StorageBackend, setting{"storage-backend", "storage.backend", "хранилище загруженных файлов: local или s3"})
+	str(&c.StorageDir, setting{"storage-dir", "storage.dir", "папка для загруженных файлов при storage.backend = local"})
+	str(&c.S3Endpoint, setting{"s3-endpoint", "s3.endpoint", "адрес S3-совместимого хранилища"})
+	str(&c.S3Region, setting{"s3-region", "s3.region", "регион S3"})
+	str(&c.S3Bucket, setting{"s3-bucket", "s3.bucket", "бакет S3"})
+	str(&c.S3Prefix, setting{"s3-prefix", "s3.prefix", "префикс ключей в бакете, например images/"})
+	str(&c.S3AccessKey, setting{"s3-access-key", "s3.access_key", "ключ доступа S3"})
+	str(&c.S3SecretKey, setting{"s3-secret-key", "s3.secret_key", "секретный ключ S3 (лучше задавать переменной THEWEEK_S3_SECRET_KEY)"})
+	s = setting{"s3-path-style", "s3.path_style", "адреса вида endpoint/bucket/key, нужны MinIO и похожим хранилищам"}
+	fs.BoolVar(&c.S3PathStyle, s.flag, c.S3PathStyle, s.usage)
+	settings = append(settings, s)
+
+	return settings
+}
+
+// Validate проверяет настройки и приводит BaseURL к виду без завершающего слэша
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.ListenAddr == "" {
+		errs = append(errs, errors.New("не задан адрес сервера"))
+	}
+	if c.DBPath == "" {
+		errs = append(errs, errors.New("не задан путь к базе данных"))
+	}
+
+	c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+	if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+		errs = append(errs, fmt.Errorf("base_url должен быть адресом вида https://example.com, получено %q", c.BaseURL))
+	}
+	if strings.TrimSpace(c.SiteName) == "" {
+		errs = append(errs, errors.New("не задано название сайта"))
+	}
+
+	if c.CookieSameSite != "lax" && c.CookieSameSite != "strict" {
+		errs = append(errs, fmt.Errorf("cookie.same_site должен быть lax или strict, получено %q", c.CookieSameSite))
+	}
+
+	if c.MaxImageSize <= 0 {
+		errs = append(errs, errors.New("upload.max_image_size должен быть больше нуля"))
+	}
+	if c.MaxFormSize < c.MaxImageSize {
+		errs = append(errs, errors.New("upload.max_form_size не может быть меньше upload.max_image_size"))
+	}
+
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, fmt.Errorf("bcrypt_cost должен быть от %d до %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+
+	if c.SessionMaxAge <= 0 || c.SessionIdleTimeout <= 0 {
+		errs = append(errs, errors.New("сроки жизни сессии должны быть больше нуля"))
+	}
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, errors.New("shutdown_timeout не может быть отрицательным"))
+	}
+	if c.BackupKeepHourly < 0 || c.BackupKeepDaily < 0 || c.BackupKeepManual < 1 {
+		errs = append(errs, errors.New("backup.keep_hourly и backup.keep_daily не могут быть отрицательными, а backup.keep_manual должен быть больше нуля"))
+	}
+
+	switch c.StorageBackend {
+	case "local":
+		if c.StorageDir == "" {
+			errs = append(errs, errors.New("не задана папка storage.dir"))
+		}
+	case "s3":
+		if c.S3Endpoint == "" || c.S3Region == "" || c.S3Bucket == "" || c.S3AccessKey == "" || c.S3SecretKey == "" {
+			errs = append(errs, errors.New("для storage.backend = s3 нужны s3.endpoint, s3.region, s3.bucket, s3.access_key и s3.secret_key"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend должен быть local или s3, получено %q", c.StorageBackend))
+	}
+
+	return errors.Join(errs...)
+}
+
+// SameSite возвращает значение атрибута SameSite для http.Cookie
+func (c *Config) SameSite() http.SameSite {
+	if c.CookieSameSite == "strict" {
+		return http.SameSiteStrictMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// BackupPolicy возвращает правила хранения резервных копий
+func (c *Config) BackupPolicy() backup.Policy {
+	return backup.Policy{KeepHourly: c.BackupKeepHourly, KeepDaily: c.BackupKeepDaily, KeepManual: c.BackupKeepManual}
+}
+
+// BlobStore создаёт хранилище загруженных файлов
+func (c *Config) BlobStore() (blobstore.Store, error) {
+	if c.StorageBackend == "s3" {
+		return blobstore.NewS3(blobstore.S3Options{
+			Endpoint:  c.S3Endpoint,
+			Region:    c.S3Region,
+			Bucket:    c.S3Bucket,
+			Prefix:    c.S3Prefix,
+			AccessKey: c.S3AccessKey,
+			SecretKey: c.S3SecretKey,
+			PathStyle: c.S3PathStyle,
+		})
+	}
+	return blobstore.NewLocal(c.StorageDir), nil
+}
+
+// SessionPolicy возвращает сроки жизни сессий
+func (c *Config) SessionPolicy() models.SessionPolicy {
+	return models.SessionPolicy{MaxAge: c.SessionMaxAge, IdleTimeout: c.SessionIdleTimeout}
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load вызывает Load с отдельным набором флагов. В args и значениях env вместо {config}
+// подставляется путь к файлу с содержимым file
+func load(t *testing.T, args []string, env map[string]string, file string) (*Config, error) {
+	t.Helper()
+	path := writeFile(t, file)
+	for name, value := range env {
+		t.Setenv(name, strings.ReplaceAll(value, "{config}", path))
+	}
+	var expanded []string
+	for _, arg := range args {
+		expanded = append(expanded, strings.ReplaceAll(arg, "{config}", path))
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(fs, expanded)
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+		// want меняет Default() так, как должен выглядеть результат
+		want func(c *Config)
+	}{
+		{"значения по умолчанию", nil, nil, "", func(c *Config) {}},
+		{
+			"файл",
+			[]string{"-config", "{config}"},
+			nil,
+			"listen_addr = \"127.0.0.1:9000\"\nbase_url = \"https://example.com/\"\n[cookie]\nsecure = false\nsame_site = \"strict\"\n" +
+				"[upload]\nmax_image_size = 1_048_576\nmax_form_size = 2_097_152\n[session]\nmax_age = \"48h\"\n",
+			func(c *Config) {
+				c.ListenAddr = "127.0.0.1:9000"
+				c.BaseURL = "https://example.com"
+				c.CookieSecure = false
+				c.CookieSameSite = "strict"
+				c.MaxImageSize = 1 << 20
+				c.MaxFormSize = 2 << 20
+				c.SessionMaxAge = 48 * time.Hour
+			},
+		},
+		{
+			"путь к файлу из окружения",
+			nil,
+			map[string]string{"THEWEEK_CONFIG": "{config}"},
+			"db_path = \"file.db\"",
+			func(c *Config) { c.DBPath = "file.db" },
+		},
+		{
+			"окружение важнее файла",
+			[]string{"-config", "{config}"},
+			map[string]string{"THEWEEK_DB_PATH": "env.db", "THEWEEK_COOKIE_SAME_SITE": "strict", "THEWEEK_BCRYPT_COST": "10"},
+			"db_path = \"file.db\"\nsite_name = \"Из файла\"\nbcrypt_cost = 12\n[cookie]\nsame_site = \"lax\"",
+			func(c *Config) {
+				c.DBPath = "env.db"
+				c.SiteName = "Из файла"
+				c.CookieSameSite = "strict"
+				c.BcryptCost = 10
+			},
+		},
+		{
+			"флаг важнее окружения и файла",
+			[]string{"-config", "{config}", "-db", "flag.db", "-cookie-secure=false", "-backup-dir", ""},
+			map[string]string{"THEWEEK_DB_PATH": "env.db", "THEWEEK_COOKIE_SECURE": "true", "THEWEEK_SITE_NAME": "Из окружения"},
+			"db_path = \"file.db\"\n[backup]\ndir = \"file-backups\"\n[cookie]\nsecure = true",
+			func(c *Config) {
+				c.DBPath = "flag.db"
+				c.CookieSecure = false
+				c.BackupDir = ""
+				c.SiteName = "Из окружения"
+			},
+		},
+		{
+			"пустая переменная окружения тоже задаёт значение",
+			[]string{"-config", "{config}"},
+			map[string]string{"THEWEEK_BACKUP_DIR": ""},
+			"[backup]\ndir = \"file-backups\"",
+			func(c *Config) { c.BackupDir = "" },
+		},
+		{
+			"s3",
+			[]string{"-config", "{config}", "-storage-backend", "s3", "-s3-path-style"},
+			map[string]string{"THEWEEK_S3_SECRET_KEY": "secret"},
+			"[s3]\nendpoint = \"https://s3.example.com\"\nbucket = \"theweek\"\naccess_key = \"key\"",
+			func(c *Config) {
+				c.StorageBackend = "s3"
+				c.S3PathStyle = true
+				c.S3Endpoint = "https://s3.example.com"
+				c.S3Bucket = "theweek"
+				c.S3AccessKey = "key"
+				c.S3SecretKey = "secret"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := load(t, tt.args, tt.env, tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Default()
+			tt.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("получено\n%+v\nожидалось\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		wantErr string
+	}{
+		{"неизвестная настройка", []string{"-config", "{config}"}, nil, "listen = \":8080\"", "неизвестная настройка listen"},
+		{"неизвестная настройка в разделе", []string{"-config", "{config}"}, nil, "[cookie]\nhttp_only = true", "неизвестная настройка cookie.http_only"},
+		{"ключ раздела вне раздела", []string{"-config", "{config}"}, nil, "same_site = \"lax\"", "неизвестная настройка same_site"},
+		{"неизвестная настройка при флаге", []string{"-config", "{config}", "-listen", ":1"}, nil, "listen_addr = \":2\"\nunknown = 1", "неизвестная настройка unknown"},
+		{"неизвестный флаг", []string{"-listen-addr", ":8080"}, nil, "", "flag provided but not defined"},
+		{"файла нет", []string{"-config", "{config}.missing"}, nil, "", "не удалось открыть файл настроек"},
+		{"ошибка в файле", []string{"-config", "{config}"}, nil, "listen_addr = :8080", "некорректное значение"},
+		{"неверный тип в файле", []string{"-config", "{config}"}, nil, "[upload]\nmax_image_size = \"много\"", "theweek.toml: upload.max_image_size"},
+		{"неверный тип в окружении", nil, map[string]string{"THEWEEK_SESSION_IDLE_TIMEOUT": "неделя"}, "", "переменная THEWEEK_SESSION_IDLE_TIMEOUT"},
+		{"неверный тип во флаге", []string{"-bcrypt-cost", "много"}, nil, "", "invalid value"},
+		{"проверка значения из файла", []string{"-config", "{config}"}, nil, "[cookie]\nsame_site = \"none\"", `cookie.same_site должен быть lax или strict, получено "none"`},
+		{"проверка значения из окружения", nil, map[string]string{"THEWEEK_STORAGE_BACKEND": "ftp"}, "", `storage.backend должен быть local или s3, получено "ftp"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := load(t, tt.args, tt.env, tt.file)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ошибка %v, ожидалась с %q", err, tt.wantErr)
+			}
+			if c != nil {
+				t.Error("при ошибке возвращены настройки")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr []string // пустой, если ошибок нет
+	}{
+		{"значения по умолчанию", func(c *Config) {}, nil},
+		{"http и порт", func(c *Config) { c.BaseURL = "http://localhost:8080/" }, nil},
+		{"s3", func(c *Config) {
+			c.StorageBackend, c.S3Endpoint, c.S3Bucket, c.S3AccessKey, c.S3SecretKey = "s3", "https://s3", "b", "k", "s"
+		}, nil},
+		{"без копий по расписанию", func(c *Config) { c.BackupDir, c.BackupKeepHourly, c.BackupKeepDaily = "", 0, 0 }, nil},
+		{"пустые адрес и база", func(c *Config) { c.ListenAddr, c.DBPath = "", "" }, []string{"не задан адрес сервера", "не задан путь к базе данных"}},
+		{"base_url с путём", func(c *Config) { c.BaseURL = "https://example.com/blog" }, []string{"base_url должен быть адресом"}},
+		{"base_url без схемы", func(c *Config) { c.BaseURL = "example.com" }, []string{"base_url должен быть адресом"}},
+		{"base_url ftp", func(c *Config) { c.BaseURL = "ftp://example.com" }, []string{"base_url должен быть адресом"}},
+		{"название из пробелов", func(c *Config) { c.SiteName = "  " }, []string{"не задано название сайта"}},
+		{"same_site none", func(c *Config) { c.CookieSameSite = "none" }, []string{"cookie.same_site"}},
+		{"нулевой размер картинки", func(c *Config) { c.MaxImageSize = 0 }, []string{"upload.max_image_size должен быть больше нуля"}},
+		{"форма меньше картинки", func(c *Config) { c.MaxFormSize = c.MaxImageSize - 1 }, []string{"upload.max_form_size не может быть меньше"}},
+		{"bcrypt слишком дешёвый", func(c *Config) { c.BcryptCost = 3 }, []string{"bcrypt_cost должен быть от 4 до 31"}},
+		{"bcrypt слишком дорогой", func(c *Config) { c.BcryptCost = 32 }, []string{"bcrypt_cost"}},
+		{"сессия без срока", func(c *Config) { c.SessionIdleTimeout = 0 }, []string{"сроки жизни сессии"}},
+		{"отрицательное ожидание остановки", func(c *Config) { c.ShutdownTimeout = -time.Second }, []string{"shutdown_timeout"}},
+		{"ни одной ручной копии", func(c *Config) { c.BackupKeepManual = 0 }, []string{"backup.keep_manual должен быть больше нуля"}},
+		{"отрицательное число копий", func(c *Config) { c.BackupKeepDaily = -1 }, []string{"backup.keep_daily"}},
+		{"local без папки", func(c *Config) { c.StorageDir = "" }, []string{"не задана папка storage.dir"}},
+		{"s3 без бакета", func(c *Config) {
+			c.StorageBackend, c.S3Endpoint, c.S3AccessKey, c.S3SecretKey = "s3", "https://s3", "k", "s"
+		}, []string{"для storage.backend = s3 нужны"}},
+		{"s3 без региона", func(c *Config) {
+			c.StorageBackend, c.S3Endpoint, c.S3Bucket, c.S3AccessKey, c.S3SecretKey, c.S3Region = "s3", "https://s3", "b", "k", "s", ""
+		}, []string{"для storage.backend = s3 нужны"}},
+		{"несколько ошибок сразу", func(c *Config) {
+			c.SiteName, c.BcryptCost, c.StorageBackend = "", 100, "disk"
+		}, []string{"не задано название сайта", "bcrypt_cost", `storage.backend должен быть local или s3, получено "disk"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.change(c)
+			err := c.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.HasSuffix(c.BaseURL, "/") {
+					t.Errorf("BaseURL %q остался с завершающим слэшем", c.BaseURL)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("ошибки нет")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("в ошибке %q нет %q", err, want)
+				}
+			}
+			if lines := strings.Count(err.Error(), "\n") + 1; lines != len(tt.wantErr) {
+				t.Errorf("ошибок %d, ожидалось %d:\n%v", lines, len(tt.wantErr), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readFile читает файл настроек. Поддерживается подмножество TOML, которого хватает для плоских настроек:
+// комментарии #, заголовки [раздел], строки вида ключ = значение, где значение - строка в кавычках,
+// число или true/false. Ключи внутри раздела возвращаются как "раздел.ключ"
+func readFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть файл настроек:\n%w", err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%s:%d: незакрытый заголовок раздела", path, n)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == "" {
+				return nil, fmt.Errorf("%s:%d: пустое имя раздела", path, n)
+			}
+			continue
+		}
+
+		key, raw, found := strings.Cut(line, "=")
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+		if !found || key == "" {
+			return nil, fmt.Errorf("%s:%d: ожидалась строка вида ключ = значение", path, n)
+		}
+		value, err := parseValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+
+		if section != "" {
+			key = section + "." + key
+		}
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("%s:%d: настройка %s задана повторно", path, n, key)
+		}
+		values[key] = value
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при чтении файла настроек:\n%w", err)
+	}
+
+	return values, nil
+}
+
+// stripComment отрезает комментарий, не трогая # внутри строк в кавычках
+func stripComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+func parseValue(raw string) (string, error) {
+	if strings.HasPrefix(raw, `"`) {
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("некорректная строка %s", raw)
+		}
+		return s, nil
+	}
+	if raw == "true" || raw == "false" {
+		return raw, nil
+	}
+	// TOML разрешает разделять разряды подчёркиванием: 10_485_760
+	if _, err := strconv.ParseInt(strings.ReplaceAll(raw, "_", ""), 10, 64); err == nil {
+		return strings.ReplaceAll(raw, "_", ""), nil
+	}
+	return "", fmt.Errorf("некорректное значение %s: строки нужно заключать в кавычки", raw)
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile сохраняет content во временный файл настроек и возвращает путь к нему
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "theweek.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{"пустой файл", "", map[string]string{}},
+		{
+			"комментарии и пустые строки",
+			"# настройки\n\n  listen_addr = \":8080\" # порт\n\t\n",
+			map[string]string{"listen_addr": ":8080"},
+		},
+		{
+			"ключи до первого раздела и внутри разделов",
+			"site_name = \"Неделя\"\n[cookie]\nsecure = false\nsame_site = \"strict\"\n[ upload ]\nmax_image_size = 1024\n",
+			map[string]string{"site_name": "Неделя", "cookie.secure": "false", "cookie.same_site": "strict", "upload.max_image_size": "1024"},
+		},
+		{
+			"решётка и экранированная кавычка внутри строки",
+			`site_name = "The # \"Week\"" # комментарий`,
+			map[string]string{"site_name": `The # "Week"`},
+		},
+		{"экранирование в строке", `s3_prefix = "a\tb\\"`, map[string]string{"s3_prefix": "a\tb\\"}},
+		{"пустая строка в кавычках", `backup_dir = ""`, map[string]string{"backup_dir": ""}},
+		{"разряды через подчёркивание", "max_form_size = 10_485_760", map[string]string{"max_form_size": "10485760"}},
+		{"отрицательное число", "shutdown = -1", map[string]string{"shutdown": "-1"}},
+		{"пробелы вокруг равно", "a=1\nb   =   true", map[string]string{"a": "1", "b": "true"}},
+		{"одинаковый ключ в разных разделах", "[a]\nkey = 1\n[b]\nkey = 2", map[string]string{"a.key": "1", "b.key": "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readFile(writeFile(t, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("прочитано %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"незакрытый заголовок", "[cookie\nsecure = true", ":1: незакрытый заголовок раздела"},
+		{"пустое имя раздела", "a = 1\n[ ]", ":2: пустое имя раздела"},
+		{"строка без равно", "# комментарий\nlisten_addr", ":2: ожидалась строка вида ключ = значение"},
+		{"пустой ключ", "= 1", ":1: ожидалась строка вида ключ = значение"},
+		{"строка без кавычек", "listen_addr = localhost:8080", ":1: некорректное значение localhost:8080: строки нужно заключать в кавычки"},
+		{"одинарные кавычки", "site_name = 'Week'", "некорректное значение 'Week'"},
+		{"незакрытая кавычка", `site_name = "Week`, `:1: некорректная строка "Week`},
+		{"текст после строки", `site_name = "Week" extra`, "некорректная строка"},
+		{"дробное число", "bcrypt_cost = 1.5", "некорректное значение 1.5"},
+		{"True с большой буквы", "secure = True", "некорректное значение True"},
+		{"повтор ключа", "a = 1\nb = 2\na = 3", ":3: настройка a задана повторно"},
+		{"повтор ключа в повторном разделе", "[s3]\nbucket = \"a\"\n[cookie]\n[s3]\nbucket = \"b\"", ":5: настройка s3.bucket задана повторно"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readFile(writeFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ошибка %v, ожидалась с %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadFileMissing(t *testing.T) {
+	_, err := readFile(filepath.Join(t.TempDir(), "нет.toml"))
+	if err == nil || !strings.Contains(err.Error(), "не удалось открыть файл настроек") {
+		t.Errorf("ошибка %v", err)
+	}
+}
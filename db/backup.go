@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Копия снимается порциями, между которыми база свободна для записи. Если сайт изменит базу во время
+// копирования, SQLite сам начнёт копию заново с учётом изменений
+const (
+	backupPagesPerStep = 256
+	backupStepPause    = 10 * time.Millisecond
+)
+
+// Backup сохраняет согласованную копию базы в файл path через online backup API SQLite и проверяет её целостность.
+// Сайт при этом продолжает работать. Недописанный или повреждённый файл удаляется
+func Backup(db *sql.DB, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("файл %s уже существует", path)
+	}
+	if err := copyDatabase(db, path); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("ошибка при создании копии базы данных:\n%w", err)
+	}
+	if err := CheckIntegrity(path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+func copyDatabase(src *sql.DB, path string) error {
+	dst, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	ctx := context.Background()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(dstDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			bk, err := dstDriver.(*sqlite3.SQLiteConn).Backup("main", srcDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := bk.Step(backupPagesPerStep)
+				if err != nil {
+					bk.Finish()
+					return err
+				}
+				if done {
+					return bk.Finish()
+				}
+				time.Sleep(backupStepPause)
+			}
+		})
+	})
+}
+
+// CheckIntegrity проверяет файл базы данных через PRAGMA integrity_check, не изменяя его
+func CheckIntegrity(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("%s не является базой данных SQLite:\n%w", path, err)
+	}
+	defer rows.Close()
+
+	var problems []error
+	for rows.Next() {
+		var result string
+		if err = rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			problems = append(problems, errors.New(result))
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("база данных %s повреждена:\n%w", path, errors.Join(problems...))
+	}
+	return nil
+}
+
+// Restore заменяет базу dbPath копией из файла snapshot. Копия проверяется до замены: она должна быть целой
+// и не новее схемы, которую знает приложение; более старая схема обновится миграциями при запуске.
+// Текущая база сохраняется рядом, путь к ней возвращается в previous (пустой, если базы не было).
+// Сайт на время восстановления должен быть остановлен, иначе он продолжит писать в старый файл
+func Restore(snapshot, dbPath string) (previous string, err error) {
+	if _, err = os.Stat(snapshot); err != nil {
+		return "", err
+	}
+	src, err := sql.Open("sqlite3", "file:"+snapshot+"?mode=ro")
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	// Проверки изменяют файл (ensureMigrationsTable), поэтому выполняются на копии, которая потом встанет на место базы
+	tmp := dbPath + ".restore"
+	os.Remove(tmp)
+	if err = Backup(src, tmp); err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+	if err = checkRestoredSchema(tmp); err != nil {
+		return "", err
+	}
+
+	if _, err = os.Stat(dbPath); err == nil {
+		previous = fmt.Sprintf("%s.before-restore-%s", dbPath, time.Now().Format("20060102-150405"))
+		current := ConnectDB(dbPath)
+		err = Backup(current, previous)
+		current.Close()
+		if err != nil {
+			return "", fmt.Errorf("не удалось сохранить текущую базу перед восстановлением:\n%w", err)
+		}
+	}
+
+	// Журналы относятся к старому файлу и испортили бы восстановленный
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err = os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return previous, err
+		}
+	}
+	if err = os.Rename(tmp, dbPath); err != nil {
+		return previous, err
+	}
+	return previous, nil
+}
+
+func checkRestoredSchema(path string) error {
+	conn := ConnectDB(path)
+	defer conn.Close()
+
+	version, err := SchemaVersion(conn)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать версию схемы копии:\n%w", err)
+	}
+	if version == 0 {
+		return errors.New("копия не похожа на базу данных сайта: в ней нет ни одной таблицы сайта")
+	}
+	if latest := LatestSchemaVersion(); version > latest {
+		return fmt.Errorf("%w: версия схемы копии %d, приложение знает версии до %d", ErrDatabaseTooNew, version, latest)
+	}
+	return nil
+}
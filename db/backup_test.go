@@ -0,0 +1,121 @@
+//go:build sqlite_fts5
+
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSiteDB создаёт базу сайта со всеми миграциями и одной статьёй title
+func newSiteDB(t *testing.T, path, title string) {
+	t.Helper()
+	conn := ConnectDB(path)
+	defer conn.Close()
+	if _, err := Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(`INSERT INTO articles (slug, title, textMD, description) VALUES ('a', ?, '', '')`, title); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func articleTitle(t *testing.T, path string) string {
+	t.Helper()
+	conn := ConnectDB(path)
+	defer conn.Close()
+	var title string
+	if err := conn.QueryRow(`SELECT title FROM articles WHERE slug = 'a'`).Scan(&title); err != nil {
+		t.Fatal(err)
+	}
+	return title
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "site.db")
+	snapshot := filepath.Join(dir, "snapshot.db")
+	newSiteDB(t, dbPath, "до копии")
+
+	conn := ConnectDB(dbPath)
+	if err := Backup(conn, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := Backup(conn, snapshot); err == nil {
+		t.Error("Backup перезаписал существующий файл")
+	}
+	if _, err := conn.Exec(`UPDATE articles SET title = 'после копии'`); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if err := CheckIntegrity(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, err := Restore(snapshot, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := articleTitle(t, dbPath); got != "до копии" {
+		t.Errorf("после восстановления статья %q", got)
+	}
+	if got := articleTitle(t, previous); got != "после копии" {
+		t.Errorf("сохранённая перед восстановлением база: статья %q", got)
+	}
+	if _, err = os.Stat(dbPath + ".restore"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("временный файл остался: %v", err)
+	}
+}
+
+func TestRestoreRejected(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "site.db")
+	newSiteDB(t, dbPath, "текущая")
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("это не база данных, а просто текст достаточной длины"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// База без таблиц сайта
+	foreign := filepath.Join(dir, "foreign.db")
+	conn := ConnectDB(foreign)
+	if _, err := conn.Exec(`CREATE TABLE notes (id INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// База от более новой версии приложения
+	newer := filepath.Join(dir, "newer.db")
+	newSiteDB(t, newer, "из будущего")
+	conn = ConnectDB(newer)
+	if _, err := conn.Exec(`INSERT INTO schema_migrations (version, name) VALUES (9999, '9999_future')`); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	tests := []struct {
+		name     string
+		snapshot string
+		want     error
+	}{
+		{"не база данных", garbage, nil},
+		{"чужая база", foreign, nil},
+		{"более новая схема", newer, ErrDatabaseTooNew},
+		{"файла нет", filepath.Join(dir, "missing.db"), os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Restore(tt.snapshot, dbPath)
+			if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("ошибка %v, ожидалась %v", err, tt.want)
+			}
+			if got := articleTitle(t, dbPath); got != "текущая" {
+				t.Errorf("база изменена: статья %q", got)
+			}
+		})
+	}
+}
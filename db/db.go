@@ -7,8 +7,8 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func ConnectDB() *sql.DB {
-	db, err := sql.Open("sqlite3", "database.db")
+func ConnectDB(path string) *sql.DB {
+	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		log.Fatal("Невозможно подключиться к базе данных:\n", err)
 	}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Миграции лежат в migrations/ и называются НОМЕР_описание.sql, например 0002_add_tags.sql.
+// Уже применённые файлы менять нельзя: изменения схемы оформляются новой миграцией
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version   int
+	Name      string
+	SQL       string
+	AppliedAt time.Time // нулевое, если миграция ещё не применена
+}
+
+func (m *Migration) IsApplied() bool {
+	return !m.AppliedAt.IsZero()
+}
+
+// ErrDatabaseTooNew возвращается, если в базе применены миграции, которых нет в этой версии приложения,
+// например после отката на старый билд
+var ErrDatabaseTooNew = errors.New("база данных создана более новой версией приложения")
+
+// loadMigrations читает встроенные миграции, отсортированные по номеру
+func loadMigrations() ([]*Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*Migration
+	seen := map[int]string{}
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		number, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("имя миграции %s должно начинаться с номера", e.Name())
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("у миграций %s и %s одинаковый номер", other, e.Name())
+		}
+		seen[version] = e.Name()
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, &Migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensureMigrationsTable создаёт schema_migrations. Базы, созданные до появления миграций вручную из schema.sql,
+// уже содержат таблицы первой миграции, поэтому она отмечается применённой без выполнения
+func ensureMigrationsTable(db *sql.DB) error {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&exists)
+	if err != nil || exists == 1 {
+		return err
+	}
+
+	var legacy int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'articles'`).Scan(&legacy)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`CREATE TABLE schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+	if legacy == 1 {
+		log.Print("База данных создана до появления миграций, считаю её схему версией 1")
+		if _, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (1, '0001_initial')`); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MigrationStatus возвращает все известные приложению миграции с отметкой о применении.
+// Если в базе есть миграции новее приложения, вместе со списком возвращается ErrDatabaseTooNew
+func MigrationStatus(db *sql.DB) ([]*Migration, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, fmt.Errorf("не удалось создать таблицу schema_migrations:\n%w", err)
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range migrations {
+		if t, ok := applied[m.Version]; ok {
+			m.AppliedAt = t
+			delete(applied, m.Version)
+		}
+	}
+	if len(applied) > 0 {
+		return migrations, ErrDatabaseTooNew
+	}
+	return migrations, nil
+}
+
+// SchemaVersion возвращает номер последней применённой миграции
+func SchemaVersion(db *sql.DB) (int, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// LatestSchemaVersion возвращает номер последней миграции, встроенной в приложение
+func LatestSchemaVersion() int {
+	migrations, err := loadMigrations()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate применяет недостающие миграции по порядку. Каждая миграция выполняется в своей транзакции
+// вместе с записью в schema_migrations, так что при ошибке база остаётся на предыдущей версии.
+// Возвращает применённые миграции
+func Migrate(db *sql.DB) ([]*Migration, error) {
+	migrations, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	for _, m := range migrations {
+		if m.IsApplied() {
+			continue
+		}
+		if err = applyMigration(db, m); err != nil {
+			return done, fmt.Errorf("ошибка в миграции %s:\n%w", m.Name, err)
+		}
+		log.Printf("Применена миграция %s", m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func applyMigration(db *sql.DB, m *Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	m.AppliedAt = time.Now().UTC()
+	return nil
+}
@@ -0,0 +1,186 @@
+//go:build sqlite_fts5
+
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn := ConnectDB(filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	conn := openTestDB(t)
+
+	done, err := Migrate(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != LatestSchemaVersion() {
+		t.Errorf("применено %d миграций, ожидалось %d", len(done), LatestSchemaVersion())
+	}
+
+	// Повторный запуск ничего не делает
+	done, err = Migrate(conn)
+	if err != nil || len(done) != 0 {
+		t.Errorf("повторный Migrate: применено %d, ошибка %v", len(done), err)
+	}
+
+	// admin из первой миграции удалён: на свежей базе нет ни одного пользователя
+	var users int
+	if err = conn.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if users != 0 {
+		t.Errorf("на свежей базе %d пользователей", users)
+	}
+}
+
+// Старый admin удаляется, если им не пользовались, и остаётся с отключённым паролем, если пользовались
+func TestMigrateDefaultAdmin(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		legacy     string // данные в базе до миграций
+		wantHash   string // пароль admin после миграций, "" если admin удалён
+		wantAuthor string // автор старой статьи
+	}{
+		{"не пользовались", `
+			INSERT INTO users (username, hashed_password, is_admin) VALUES ('editor', 'hash-editor', 1);
+		`, "", "editor"},
+		{"пароль сменили", `
+			UPDATE users SET hashed_password = 'hash-admin' WHERE username = 'admin';
+			INSERT INTO users (username, hashed_password, is_admin) VALUES ('editor', 'hash-editor', 1);
+		`, "hash-admin", "admin"},
+		{"входили", `
+			INSERT INTO sessions (user_id, session_key_hash) VALUES (1, x'00');
+			INSERT INTO users (username, hashed_password, is_admin) VALUES ('editor', 'hash-editor', 1);
+		`, "disabled:1", "editor"},
+		{"загружали картинки, других администраторов нет", `
+			INSERT INTO images (filename, uploaded_by, content) VALUES ('a.png', 1, x'89504E470D0A1A0A');
+		`, "disabled:1", "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := openTestDB(t)
+			_, err := conn.Exec(migrations[0].SQL + tt.legacy + `
+				INSERT INTO articles (slug, title, textMD, description) VALUES ('old', 'Старая', '', '');
+			`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = Migrate(conn); err != nil {
+				t.Fatal(err)
+			}
+
+			var hash string
+			err = conn.QueryRow(`SELECT hashed_password FROM users WHERE username = 'admin'`).Scan(&hash)
+			if err != nil && err != sql.ErrNoRows {
+				t.Fatal(err)
+			}
+			if hash != tt.wantHash {
+				t.Errorf("пароль admin %q, ожидался %q", hash, tt.wantHash)
+			}
+
+			var author string
+			err = conn.QueryRow(`SELECT u.username FROM article_authors aa JOIN users u ON u.id = aa.user_id`).Scan(&author)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if author != tt.wantAuthor {
+				t.Errorf("автор старой статьи %s, ожидался %s", author, tt.wantAuthor)
+			}
+		})
+	}
+}
+
+// Базы, созданные до миграций, имеют схему из первой миграции и получают все остальные поверх неё
+func TestMigrateLegacyDatabase(t *testing.T) {
+	conn := openTestDB(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(migrations[0].SQL + `
+		INSERT INTO users (username, hashed_password, is_admin) VALUES ('editor', 'hash-editor', 1), ('reader', 'hash-reader', 0);
+		INSERT INTO articles (slug, title, textMD, description) VALUES ('first', 'Первая',
+			'Текст про погоду ![](/images/1?w=640) ![](/images/1) https://example.com/images/12 /images/ /images/x', 'Описание');
+		INSERT INTO images (filename, uploaded_by, content) VALUES ('a.png', 1, x'89504E470D0A1A0A');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	version, err := SchemaVersion(conn)
+	if err != nil || version != LatestSchemaVersion() {
+		t.Fatalf("версия схемы %d (ошибка %v), ожидалась %d", version, err, LatestSchemaVersion())
+	}
+
+	roles := map[string]string{"admin": "admin", "editor": "admin", "reader": "reader"}
+	for username, want := range roles {
+		var role string
+		if err = conn.QueryRow(`SELECT role FROM users WHERE username = ?`, username).Scan(&role); err != nil {
+			t.Fatal(err)
+		}
+		if role != want {
+			t.Errorf("роль %s = %q, ожидалась %q", username, role, want)
+		}
+	}
+
+	var status string
+	var sectionID sql.NullInt64
+	err = conn.QueryRow(`SELECT status, section_id FROM articles WHERE slug = 'first'`).Scan(&status, &sectionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "published" || sectionID.Valid {
+		t.Errorf("статья после миграции: status = %q, section_id = %v", status, sectionID)
+	}
+
+	checks := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"рубрики", `SELECT COUNT(*) FROM sections`, 13},
+		{"автор статьи - администратор, который может войти", `SELECT COUNT(*) FROM article_authors WHERE user_id = 2 AND position = 0`, 1},
+		{"первая ревизия", `SELECT COUNT(*) FROM article_revisions`, 1},
+		{"поисковый индекс", `SELECT COUNT(*) FROM articles_fts WHERE articles_fts MATCH 'погоду'`, 1},
+		{"картинки из текста", `SELECT COUNT(*) FROM image_usages WHERE article_id = 1 AND image_id IN (1, 12)`, 2},
+		{"только картинки из текста", `SELECT COUNT(*) FROM image_usages`, 2},
+		{"тип старой картинки", `SELECT COUNT(*) FROM images WHERE mime_type = 'image/png' AND size = 8`, 1},
+	}
+	for _, c := range checks {
+		var got int
+		if err = conn.QueryRow(c.query).Scan(&got); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: %d, ожидалось %d", c.name, got, c.want)
+		}
+	}
+
+	// Новые статьи получают значения по умолчанию и попадают в индекс
+	_, err = conn.Exec(`INSERT INTO articles (slug, title, textMD, description) VALUES ('second', 'Вторая', 'Снег', '')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found int
+	if err = conn.QueryRow(`SELECT COUNT(*) FROM articles_fts WHERE articles_fts MATCH 'снег'`).Scan(&found); err != nil || found != 1 {
+		t.Errorf("новая статья в индексе: %d, ошибка %v", found, err)
+	}
+}
@@ -0,0 +1,16 @@
+-- Раньше schema.sql создавал пользователя admin с паролем, хэш которого лежит в открытом репозитории.
+-- Если пароль так и не сменили, а учётной записью не пользовались (на свежей базе всегда так), она удаляется:
+-- первого администратора создаёт theweek user create -admin <логин>.
+-- Иначе вход по старому паролю отключается: хэш заменяется строкой, с которой не совпадёт ни один пароль.
+-- Восстановить доступ: theweek user reset-password admin
+DELETE FROM users
+WHERE username = 'admin'
+    AND hashed_password = '$2a$14$0DRESadVeTLIdqc2U7IqzeCQncEzZukLUtLj3WjD.LHGaiWwefcGa'
+    AND NOT EXISTS (SELECT 1 FROM sessions WHERE user_id = users.id)
+    AND NOT EXISTS (SELECT 1 FROM images WHERE uploaded_by = users.id)
+    AND NOT EXISTS (SELECT 1 FROM recovery_codes WHERE user_id = users.id);
+
+UPDATE users
+SET hashed_password = 'disabled:' || id
+WHERE username = 'admin'
+    AND hashed_password = '$2a$14$0DRESadVeTLIdqc2U7IqzeCQncEzZukLUtLj3WjD.LHGaiWwefcGa';
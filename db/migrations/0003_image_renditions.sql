@@ -0,0 +1,25 @@
+-- Тип и размеры картинки хранятся рядом с ней, а не определяются при каждом запросе.
+-- У старых картинок тип восстанавливается по первым байтам, размеры остаются нулевыми
+-- до запуска theweek image reprocess
+ALTER TABLE images ADD COLUMN mime_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+
+UPDATE images SET mime_type = CASE
+    WHEN hex(substr(content, 1, 3)) = 'FFD8FF' THEN 'image/jpeg'
+    WHEN hex(substr(content, 1, 8)) = '89504E470D0A1A0A' THEN 'image/png'
+    WHEN hex(substr(content, 1, 4)) = '47494638' THEN 'image/gif'
+    WHEN hex(substr(content, 1, 4)) = '52494646' AND hex(substr(content, 9, 4)) = '57454250' THEN 'image/webp'
+    ELSE 'application/octet-stream'
+END;
+
+-- Уменьшенные копии и WebP-варианты. Оригинал остаётся в images
+CREATE TABLE image_renditions (
+    image_id INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    mime_type TEXT NOT NULL,
+    content BLOB NOT NULL,
+    PRIMARY KEY (image_id, width, mime_type),
+    FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE
+);
@@ -0,0 +1,25 @@
+-- Содержимое картинок переезжает из базы в хранилище файлов (папку или S3), в базе остаются ключ и размер.
+-- Файлы переносит приложение при запуске, SQL до хранилища не дотянуться: пока строка не перенесена,
+-- blob_key пустой, а содержимое остаётся в content
+ALTER TABLE images ADD COLUMN blob_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+UPDATE images SET size = COALESCE(length(content), 0);
+CREATE INDEX images_blob_key ON images (blob_key);
+
+-- В image_renditions content был NOT NULL, поэтому таблица пересоздаётся
+CREATE TABLE image_renditions_new (
+    image_id INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    mime_type TEXT NOT NULL,
+    content BLOB,
+    blob_key TEXT NOT NULL DEFAULT '',
+    size INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (image_id, width, mime_type),
+    FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE
+);
+INSERT INTO image_renditions_new (image_id, width, height, mime_type, content, size)
+SELECT image_id, width, height, mime_type, content, length(content) FROM image_renditions;
+DROP TABLE image_renditions;
+ALTER TABLE image_renditions_new RENAME TO image_renditions;
+CREATE INDEX image_renditions_blob_key ON image_renditions (blob_key);
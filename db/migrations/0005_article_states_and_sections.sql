@@ -0,0 +1,54 @@
+-- Рубрики, статусы статей, отложенная публикация и время изменения.
+-- updated_at нельзя добавить через ADD COLUMN: у такого столбца не может быть DEFAULT CURRENT_TIMESTAMP,
+-- поэтому таблица статей пересоздаётся. Все уже существующие статьи опубликованы и остаются без рубрики
+CREATE TABLE sections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    in_nav_top INTEGER DEFAULT 0 NOT NULL, -- boolean 0/1
+    in_nav_bottom INTEGER DEFAULT 0 NOT NULL, -- boolean 0/1
+    position INTEGER DEFAULT 0 NOT NULL
+);
+
+INSERT INTO sections (slug, name, in_nav_top, in_nav_bottom, position) VALUES
+    ("hrotraik", "Хротрайк", 1, 1, 1),
+    ("mir", "Мир", 1, 1, 2),
+    ("skitsofrenlyandiya", "Скитсофренляндия", 1, 0, 3),
+    ("kalibriya", "Калибрия", 1, 0, 4),
+    ("tsukusi", "Цукуси", 1, 0, 5),
+    ("biznes", "Бизнес", 0, 1, 6),
+    ("iskusstvo", "Искусство", 0, 1, 7),
+    ("zhizn", "Жизнь", 0, 1, 8),
+    ("mneniya", "Мнения", 0, 1, 9),
+    ("muzyka", "Музыка", 0, 1, 10),
+    ("igry", "Игры", 0, 1, 11),
+    ("kulinariya", "Кулинария", 0, 1, 12),
+    ("pogoda", "Погода", 0, 1, 13);
+
+CREATE TABLE articles_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    title TEXT NOT NULL,
+    textMD TEXT NOT NULL,
+    description TEXT NOT NULL,
+    cover_image_id INTEGER,
+    section_id INTEGER,
+    status TEXT NOT NULL DEFAULT 'published' CHECK (status IN ('draft', 'scheduled', 'published', 'unpublished')),
+    publish_at DATETIME, -- время отложенной публикации для status = 'scheduled'
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (cover_image_id) REFERENCES images (id),
+    FOREIGN KEY (section_id) REFERENCES sections (id)
+);
+
+INSERT INTO articles_new (id, slug, created_at, title, textMD, description, cover_image_id, status, updated_at)
+SELECT id, slug, created_at, title, textMD, description, cover_image_id, 'published', created_at FROM articles;
+
+DROP TABLE articles;
+ALTER TABLE articles_new RENAME TO articles;
+
+CREATE INDEX articles_section_id ON articles (section_id);
+
+CREATE INDEX articles_status ON articles (status, publish_at);
+
+CREATE INDEX articles_feed ON articles (status, datetime(created_at) DESC, id DESC);
@@ -0,0 +1,25 @@
+-- Полнотекстовый индекс статей. Требует сборки с тегом sqlite_fts5
+CREATE VIRTUAL TABLE articles_fts USING fts5 (
+    title,
+    description,
+    textMD,
+    content = 'articles',
+    content_rowid = 'id',
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER articles_fts_insert AFTER INSERT ON articles BEGIN
+    INSERT INTO articles_fts (rowid, title, description, textMD) VALUES (new.id, new.title, new.description, new.textMD);
+END;
+
+CREATE TRIGGER articles_fts_delete AFTER DELETE ON articles BEGIN
+    INSERT INTO articles_fts (articles_fts, rowid, title, description, textMD) VALUES ('delete', old.id, old.title, old.description, old.textMD);
+END;
+
+CREATE TRIGGER articles_fts_update AFTER UPDATE ON articles BEGIN
+    INSERT INTO articles_fts (articles_fts, rowid, title, description, textMD) VALUES ('delete', old.id, old.title, old.description, old.textMD);
+    INSERT INTO articles_fts (rowid, title, description, textMD) VALUES (new.id, new.title, new.description, new.textMD);
+END;
+
+-- Заполнить индекс уже существующими статьями
+INSERT INTO articles_fts (articles_fts) VALUES ('rebuild');
@@ -0,0 +1,17 @@
+CREATE TABLE article_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    article_id INTEGER NOT NULL,
+    editor_id INTEGER, -- NULL для ревизий, созданных до появления истории
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL,
+    textMD TEXT NOT NULL,
+    FOREIGN KEY (article_id) REFERENCES articles (id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users (id)
+);
+
+CREATE INDEX article_revisions_article_id ON article_revisions (article_id);
+
+-- Текущая версия каждой статьи становится её первой ревизией
+INSERT INTO article_revisions (article_id, created_at, title, description, textMD)
+    SELECT id, created_at, title, description, textMD FROM articles;
@@ -0,0 +1,31 @@
+-- Роли вместо флага is_admin, профили и авторы статей.
+-- Администраторы остаются администраторами, остальные становятся читателями
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'reader' CHECK (role IN ('reader', 'author', 'editor', 'admin'));
+UPDATE users SET role = CASE WHEN is_admin = 1 THEN 'admin' ELSE 'reader' END;
+ALTER TABLE users DROP COLUMN is_admin;
+
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN avatar_image_id INTEGER REFERENCES images (id);
+
+-- Авторы статьи. position = 0 у основного автора, соавторы идут дальше по порядку
+CREATE TABLE article_authors (
+    article_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (article_id, user_id),
+    FOREIGN KEY (article_id) REFERENCES articles (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX article_authors_user_id ON article_authors (user_id);
+
+-- Раньше автор статьи не записывался, а публиковать могли только администраторы.
+-- Статьи без автора недоступны для редактирования авторам, поэтому они достаются первому администратору,
+-- который может войти: старый admin с отключённым паролем (см. 0002) выбирается, только если других нет
+INSERT INTO article_authors (article_id, user_id, position)
+SELECT a.id, u.id, 0
+FROM articles a, (
+    SELECT id FROM users WHERE role = 'admin'
+    ORDER BY hashed_password LIKE 'disabled:%', id
+    LIMIT 1
+) u;
@@ -0,0 +1,23 @@
+-- Блокировка входа после серии неудачных попыток
+ALTER TABLE users ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0; -- неудачные попытки входа подряд
+ALTER TABLE users ADD COLUMN locked_until DATETIME; -- вход заблокирован до этого времени
+
+-- Журнал событий безопасности: блокировки входа и т.п.
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    user_id INTEGER,
+    event TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+-- Состояние ограничителей частоты попыток входа, переживающее перезапуск сервера
+CREATE TABLE rate_limit_buckets (
+    limiter TEXT NOT NULL,
+    key TEXT NOT NULL,
+    tokens REAL NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (limiter, key)
+);
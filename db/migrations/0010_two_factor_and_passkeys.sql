@@ -0,0 +1,49 @@
+-- Двухфакторная аутентификация
+ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT ''; -- base32, задаётся при начале подключения 2FA
+ALTER TABLE users ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0; -- boolean 0/1
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0; -- шаг последнего принятого кода, защищает от повторного использования
+
+-- Резервные коды двухфакторной аутентификации, одноразовые
+CREATE TABLE totp_backup_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash BLOB NOT NULL,
+    used_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX totp_backup_codes_user_id ON totp_backup_codes (user_id);
+
+-- Незавершённые входы и церемонии WebAuthn: пароль проверен и ожидается второй фактор,
+-- либо браузеру выдан вызов для ключа доступа
+CREATE TABLE pre_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    purpose TEXT NOT NULL CHECK(purpose IN ('totp', 'passkey_login', 'passkey_register')),
+    user_id INTEGER, -- NULL при входе по ключу доступа, пока ключ не предъявлен
+    key_hash BLOB NOT NULL UNIQUE, -- hashed UUID
+    challenge BLOB, -- вызов WebAuthn
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+-- Настройки сайта, которые меняются из панели управления
+CREATE TABLE settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+-- Ключи доступа (WebAuthn)
+CREATE TABLE passkeys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    credential_id BLOB NOT NULL UNIQUE,
+    public_key BLOB NOT NULL, -- ключ в формате COSE
+    sign_count INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX passkeys_user_id ON passkeys (user_id);
@@ -0,0 +1,3 @@
+-- Устройство и адрес входа для списка активных сессий
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT ''; -- адрес, с которого был выполнен вход
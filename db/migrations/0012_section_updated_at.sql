@@ -0,0 +1,4 @@
+-- Время изменения рубрики: название и адрес рубрики входят в её ленту, поэтому участвуют в ETag и Last-Modified.
+-- У существующих рубрик время неизвестно, берётся момент миграции, чтобы закэшированные ленты один раз обновились
+ALTER TABLE sections ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE sections SET updated_at = CURRENT_TIMESTAMP;
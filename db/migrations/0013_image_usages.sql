@@ -0,0 +1,32 @@
+-- Картинки, на которые ссылается текст статьи или одна из её ревизий. Строки добавляет ArticleRepo.Save
+-- вместе с ревизией, поэтому медиатеке не нужно разбирать тексты всех статей, чтобы посчитать использования
+CREATE TABLE image_usages (
+    image_id INTEGER NOT NULL,
+    article_id INTEGER NOT NULL,
+    PRIMARY KEY (image_id, article_id),
+    FOREIGN KEY (article_id) REFERENCES articles (id) ON DELETE CASCADE
+) WITHOUT ROWID;
+
+CREATE INDEX image_usages_article_id ON image_usages (article_id);
+CREATE INDEX articles_cover_image_id ON articles (cover_image_id);
+CREATE INDEX users_avatar_image_id ON users (avatar_image_id);
+
+-- Ссылки вида /images/12, /images/12?w=640 или с адресом сайта впереди, как imageLinkRegexp в repositories.
+-- links по очереди отрезает текст до каждого вхождения /images/, CAST берёт число в начале остатка
+WITH RECURSIVE
+    texts (article_id, textMD) AS (
+        SELECT id, textMD FROM articles
+        UNION ALL
+        SELECT article_id, textMD FROM article_revisions
+    ),
+    links (article_id, rest) AS (
+        SELECT article_id, substr(textMD, instr(textMD, '/images/') + 8) FROM texts
+        WHERE instr(textMD, '/images/') > 0
+        UNION ALL
+        SELECT article_id, substr(rest, instr(rest, '/images/') + 8) FROM links
+        WHERE instr(rest, '/images/') > 0
+    )
+INSERT OR IGNORE INTO image_usages (image_id, article_id)
+SELECT CAST(rest AS INTEGER), article_id FROM links
+WHERE substr(rest, 1, 1) BETWEEN '0' AND '9'
+    AND article_id IN (SELECT id FROM articles);
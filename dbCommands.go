@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/svuvi/theweek/backup"
+	"github.com/svuvi/theweek/db"
+)
+
+func runMigrate(fs *flag.FlagSet, args []string) error {
+	// Подкоманда идёт до флагов (migrate status -db ...): flag останавливается на первом аргументе без дефиса.
+	// Старый порядок (migrate -db ... status) тоже принимается
+	status := len(args) > 0 && args[0] == "status"
+	if status {
+		args = args[1:]
+	}
+	cfg, err := loadConfig(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 1 {
+		if status || fs.Arg(0) != "status" {
+			fs.Usage()
+			return errUsage
+		}
+		status = true
+	}
+
+	conn := db.ConnectDB(cfg.DBPath)
+	defer conn.Close()
+
+	if !status {
+		applied, err := db.Migrate(conn)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Применено миграций: %d\n", len(applied))
+		_, err = openBlobStore(cfg, conn)
+		return err
+	}
+
+	migrations, err := db.MigrationStatus(conn)
+	if err != nil && !errors.Is(err, db.ErrDatabaseTooNew) {
+		return err
+	}
+	pending := 0
+	for _, m := range migrations {
+		if m.IsApplied() {
+			fmt.Printf("[x] %s  %s\n", m.Name, m.AppliedAt.Local().Format("02.01.2006 15:04"))
+		} else {
+			fmt.Printf("[ ] %s\n", m.Name)
+			pending++
+		}
+	}
+	fmt.Printf("Не применено: %d\n", pending)
+	return err
+}
+
+func runDBBackup(fs *flag.FlagSet, args []string) error {
+	cfg, err := loadConfig(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	conn := db.ConnectDB(cfg.DBPath)
+	defer conn.Close()
+
+	if err = db.Backup(conn, fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Println("Копия базы данных сохранена в", fs.Arg(0))
+	return nil
+}
+
+func runDBRestore(fs *flag.FlagSet, args []string) error {
+	yes := fs.Bool("yes", false, "не спрашивать подтверждение")
+	cfg, err := loadConfig(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	// Принимается путь к файлу или имя копии из папки backup.dir
+	snapshot := fs.Arg(0)
+	if _, err = os.Stat(snapshot); err != nil {
+		store := backup.NewStore(nil, cfg.BackupDir, cfg.BackupPolicy())
+		if snapshot, err = store.Path(fs.Arg(0)); err != nil {
+			return fmt.Errorf("%s: нет такого файла и такой копии в папке %q", fs.Arg(0), cfg.BackupDir)
+		}
+	}
+
+	if !*yes {
+		fmt.Printf("База данных %s будет заменена копией %s. Сайт должен быть остановлен. Продолжить? [y/N] ", cfg.DBPath, snapshot)
+		answer, err := stdin.ReadString('\n')
+		if err != nil && answer == "" {
+			return err
+		}
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" && a != "д" && a != "да" {
+			fmt.Println("Отменено")
+			return nil
+		}
+	}
+
+	previous, err := db.Restore(snapshot, cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	if previous != "" {
+		fmt.Println("Прежняя база данных сохранена в", previous)
+	}
+	fmt.Println("База данных восстановлена из", snapshot)
+	return nil
+}
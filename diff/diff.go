@@ -0,0 +1,101 @@
+// Пакет diff строит построчную разницу между двумя текстами
+package diff
+
+import "strings"
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+type Line struct {
+	Op   Op
+	Text string
+	// Номера строки в старом и новом тексте, начиная с 1. 0 если строки в этом тексте нет
+	OldNum int
+	NewNum int
+}
+
+// Наибольший размер таблицы НОП: 4 Мбайт значений int32, например по 1000 изменённых строк с каждой стороны.
+// Таблица занимает O(n·m) памяти, поэтому для больших изменений она не строится
+const maxTableCells = 1 << 20
+
+// Lines сравнивает тексты построчно через наибольшую общую подпоследовательность.
+// Если изменённая часть текстов слишком велика для таблицы, она показывается целиком удалённой и вставленной заново
+func Lines(oldText, newText string) []Line {
+	a := strings.Split(oldText, "\n")
+	b := strings.Split(newText, "\n")
+
+	// Общие начало и конец не участвуют в построении таблицы
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+
+	lines := make([]Line, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, Line{Op: Equal, Text: a[i], OldNum: i + 1, NewNum: i + 1})
+	}
+
+	n, m := len(midA), len(midB)
+	if (n+1)*(m+1) > maxTableCells {
+		for i, text := range midA {
+			lines = append(lines, Line{Op: Delete, Text: text, OldNum: prefix + i + 1})
+		}
+		for j, text := range midB {
+			lines = append(lines, Line{Op: Insert, Text: text, NewNum: prefix + j + 1})
+		}
+	} else {
+		lines = appendLCS(lines, midA, midB, prefix)
+	}
+
+	for k := 0; k < suffix; k++ {
+		oldNum := len(a) - suffix + k
+		newNum := len(b) - suffix + k
+		lines = append(lines, Line{Op: Equal, Text: a[oldNum], OldNum: oldNum + 1, NewNum: newNum + 1})
+	}
+	return lines
+}
+
+// appendLCS добавляет к lines разницу между midA и midB, которые начинаются после prefix общих строк
+func appendLCS(lines []Line, midA, midB []string, prefix int) []Line {
+	// lcs[i][j] - длина НОП для midA[i:] и midB[j:]
+	n, m := len(midA), len(midB)
+	lcs := make([]int32, (n+1)*(m+1))
+	at := func(i, j int) int32 { return lcs[i*(m+1)+j] }
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i*(m+1)+j] = at(i+1, j+1) + 1
+			} else {
+				lcs[i*(m+1)+j] = max(at(i+1, j), at(i, j+1))
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && midA[i] == midB[j]:
+			lines = append(lines, Line{Op: Equal, Text: midA[i], OldNum: prefix + i + 1, NewNum: prefix + j + 1})
+			i++
+			j++
+		case i < n && (j == m || at(i+1, j) >= at(i, j+1)):
+			lines = append(lines, Line{Op: Delete, Text: midA[i], OldNum: prefix + i + 1})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: midB[j], NewNum: prefix + j + 1})
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// format записывает разницу как в unified diff: " " - без изменений, "-" - удалено, "+" - добавлено
+func format(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString([]string{" ", "+", "-"}[l.Op] + l.Text + "\n")
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"без изменений", "a\nb", "a\nb", " a\n b\n"},
+		{"добавлена строка", "a\nc", "a\nb\nc", " a\n+b\n c\n"},
+		{"удалена строка", "a\nb\nc", "a\nc", " a\n-b\n c\n"},
+		{"изменена строка", "a\nb\nc", "a\nx\nc", " a\n-b\n+x\n c\n"},
+		{"пустой старый текст", "", "a", "-\n+a\n"},
+		{"перестановка", "a\nb\nc\nd", "b\na\nc\nd", "-a\n b\n+a\n c\n d\n"},
+		{"общие строки в середине", "x\na\ny\nb\nz", "a\nq\nb", "-x\n a\n-y\n+q\n b\n-z\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := format(Lines(tt.old, tt.new)); got != tt.want {
+				t.Errorf("разница:\n%s\nожидалось:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesNumbers(t *testing.T) {
+	lines := Lines("a\nb\nc", "a\nx\ny\nc")
+	want := []Line{
+		{Equal, "a", 1, 1},
+		{Delete, "b", 2, 0},
+		{Insert, "x", 0, 2},
+		{Insert, "y", 0, 3},
+		{Equal, "c", 3, 4},
+	}
+	if fmt.Sprint(lines) != fmt.Sprint(want) {
+		t.Errorf("строки %v, ожидалось %v", lines, want)
+	}
+}
+
+// Большие изменения показываются заменой без таблицы НОП, общие начало и конец сохраняются
+func TestLinesLargeFallback(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < 3000; i++ {
+		oldLines = append(oldLines, fmt.Sprint("старая ", i))
+		newLines = append(newLines, fmt.Sprint("новая ", i))
+	}
+	old := "начало\n" + strings.Join(oldLines, "\n") + "\nконец"
+	new := "начало\n" + strings.Join(newLines, "\n") + "\nконец"
+
+	// Таблица для 3000×3000 строк заняла бы 36 Мбайт
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	lines := Lines(old, new)
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4<<20 {
+		t.Errorf("выделено %d байт", allocated)
+	}
+
+	if len(lines) != 2+3000+3000 {
+		t.Fatalf("%d строк разницы", len(lines))
+	}
+	if lines[0].Op != Equal || lines[len(lines)-1].Op != Equal || lines[len(lines)-1].NewNum != 3002 {
+		t.Errorf("общие строки потеряны: %v ... %v", lines[0], lines[len(lines)-1])
+	}
+	for i, l := range lines[1 : len(lines)-1] {
+		want := Delete
+		if i >= 3000 {
+			want = Insert
+		}
+		if l.Op != want {
+			t.Fatalf("строка %d: %v", i+1, l)
+		}
+	}
+}
@@ -9,6 +9,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/yuin/goldmark v1.7.8
 	golang.org/x/crypto v0.32.0
+	golang.org/x/image v0.25.0
 )
 
 require golang.org/x/sys v0.29.0 // indirect
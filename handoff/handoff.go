@@ -0,0 +1,166 @@
+// Package handoff позволяет перезапускать сервер без разрыва соединений.
+//
+// Слушающий сокет берётся от systemd (socket activation), от родительского процесса или создаётся заново.
+// По сигналу процесс запускает новую версию своего исполняемого файла и передаёт ей сокет. Новая версия,
+// когда готова принимать запросы, сообщает об этом systemd и просит старую завершиться: старая перестаёт
+// принимать соединения, дожидается уже начатых запросов и выходит. Сокет всё это время открыт,
+// поэтому входящие соединения ждут в очереди ядра, а не получают отказ
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Переменная окружения, через которую дочерний процесс узнаёт номер унаследованного дескриптора
+const envListenFD = "THEWEEK_LISTEN_FD"
+
+// systemd передаёт сокеты начиная с дескриптора 3
+const systemdFirstFD = 3
+
+// Listen возвращает слушающий сокет. Порядок: сокет от родителя при перезапуске,
+// сокет от systemd при socket activation, новый сокет на addr
+func Listen(addr string) (net.Listener, error) {
+	if fd := os.Getenv(envListenFD); fd != "" {
+		os.Unsetenv(envListenFD)
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный %s: %q", envListenFD, fd)
+		}
+		ln, err := fileListener(n)
+		inherited = err == nil
+		return ln, err
+	}
+
+	if ln, err := systemdListener(); ln != nil || err != nil {
+		return ln, err
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// inherited - сокет получен от родительского процесса, то есть идёт перезапуск
+var inherited bool
+
+func fileListener(fd int) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), "listener")
+	if f == nil {
+		return nil, fmt.Errorf("дескриптор %d недоступен", fd)
+	}
+	defer f.Close() // FileListener дублирует дескриптор
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("дескриптор %d не является слушающим сокетом:\n%w", fd, err)
+	}
+	return ln, nil
+}
+
+// systemdListener возвращает сокет, переданный systemd через LISTEN_FDS, или nil, если сокета нет
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	if n > 1 {
+		return nil, errors.New("systemd передал больше одного сокета, ожидается один")
+	}
+
+	// Переменные предназначены только этому процессу
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	syscall.CloseOnExec(systemdFirstFD)
+
+	return fileListener(systemdFirstFD)
+}
+
+// Restart запускает новую копию исполняемого файла с теми же аргументами и передаёт ей сокет ln.
+// Исполняемый файл ищется заново, так что подхватывается новая версия, положенная на место старой.
+// Возвращает запущенный процесс; вызывающий должен дождаться его через Wait
+func Restart(ln net.Listener) (*os.Process, error) {
+	tcp, ok := ln.(*net.TCPListener)
+	if !ok {
+		return nil, errors.New("передать можно только TCP-сокет")
+	}
+	f, err := tcp.File()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{f} // станет дескриптором 3
+	cmd.Env = append(childEnv(), envListenFD+"="+strconv.Itoa(systemdFirstFD))
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd.Process, nil
+}
+
+func childEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		switch name {
+		case envListenFD, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// Ready сообщает, что процесс готов принимать запросы: уведомляет systemd и, если сокет получен
+// от родителя, просит родителя завершиться
+func Ready() error {
+	state := "READY=1"
+	if inherited {
+		// Главным процессом службы теперь считается этот, иначе systemd остановит службу вместе с родителем
+		state = fmt.Sprintf("MAINPID=%d\nREADY=1", os.Getpid())
+	}
+	if err := notify(state); err != nil {
+		return fmt.Errorf("не удалось уведомить systemd:\n%w", err)
+	}
+
+	if inherited {
+		if err := syscall.Kill(os.Getppid(), syscall.SIGTERM); err != nil {
+			return fmt.Errorf("не удалось остановить предыдущий процесс:\n%w", err)
+		}
+	}
+	return nil
+}
+
+// notify отправляет состояние в сокет NOTIFY_SOCKET (протокол sd_notify). Без systemd ничего не делает
+func notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // абстрактный сокет Linux
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
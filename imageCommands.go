@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/svuvi/theweek/imaging"
+	"github.com/svuvi/theweek/repositories"
+)
+
+// runImageReprocess обрабатывает картинки, загруженные до появления уменьшенных копий. Картинки,
+// которые не удалось прочитать, остаются как есть и отдаются без копий
+func runImageReprocess(fs *flag.FlagSet, args []string) error {
+	cfg, err := loadConfig(fs, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	blobs, err := openBlobStore(cfg, conn)
+	if err != nil {
+		return err
+	}
+	imageRepo := repositories.NewImageRepo(conn, blobs)
+
+	ids, err := imageRepo.ListUnprocessed()
+	if err != nil {
+		return err
+	}
+	processed, failed := 0, 0
+	for _, id := range ids {
+		img, err := imageRepo.Get(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Картинка %d пропущена: %v\n", id, err)
+			failed++
+			continue
+		}
+		processedImg, renditions, err := imaging.Process(img.Content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Картинка %d (%s) пропущена: %v\n", id, img.Filename, err)
+			failed++
+			continue
+		}
+		processedImg.ID = id
+		if err = imageRepo.Replace(processedImg, renditions); err != nil {
+			return fmt.Errorf("картинка %d:\n%w", id, err)
+		}
+		processed++
+	}
+
+	fmt.Printf("Обработано картинок: %d, пропущено: %d\n", processed, failed)
+	return nil
+}
@@ -0,0 +1,104 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// jpegOrientation ищет в сегменте APP1 (EXIF) тег ориентации 0x0112. Если тега нет или файл
+// повреждён, возвращает 1 - картинку поворачивать не нужно
+func jpegOrientation(content []byte) int {
+	for i := 2; i+4 <= len(content); {
+		if content[i] != 0xff {
+			return 1
+		}
+		marker := content[i+1]
+		// Начало сжатых данных: дальше метаданных нет
+		if marker == 0xda || marker == 0xd9 {
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(content[i+2:]))
+		if size < 2 || i+2+size > len(content) {
+			return 1
+		}
+		segment := content[i+4 : i+2+size]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+			return v
+		}
+		return 1
+	}
+	return 1
+}
+
+// orient поворачивает и отражает картинку так, как её показывает камера.
+// При ориентациях 5-8 ширина и высота меняются местами
+func orient(m *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return m
+	}
+	w, h := m.Bounds().Dx(), m.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		for dx := 0; dx < dw; dx++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-dx, dy
+			case 3:
+				sx, sy = w-1-dx, h-1-dy
+			case 4:
+				sx, sy = dx, h-1-dy
+			case 5:
+				sx, sy = dy, dx
+			case 6:
+				sx, sy = dy, h-1-dx
+			case 7:
+				sx, sy = w-1-dy, h-1-dx
+			case 8:
+				sx, sy = w-1-dy, dx
+			}
+			si, di := m.PixOffset(sx, sy), dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], m.Pix[si:si+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,282 @@
+// Package imaging проверяет загруженные картинки и готовит их к показу. Тип определяется по содержимому,
+// а не по имени файла. Оригинал поворачивается по EXIF и перекодируется, поэтому метаданные вроде координат
+// съёмки не сохраняются. Для каждой ширины из Widths создаётся уменьшенная копия в формате оригинала,
+// а для картинок без потерь (PNG, GIF, WebP) ещё и WebP-вариант, если он получился меньше
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/svuvi/theweek/models"
+	"github.com/svuvi/theweek/webp"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // регистрирует декодер WebP для image.Decode
+)
+
+// Ширины уменьшенных копий. Шаблоны перечисляют их в srcset
+var Widths = []int{320, 640, 1024, 1600}
+
+const (
+	// Наибольшая сторона сохраняемого оригинала. Более крупные фотографии уменьшаются
+	MaxDimension = 2560
+	// Ограничение на размер картинки до уменьшения, чтобы маленький файл не занял при распаковке всю память
+	maxPixels = 50_000_000
+
+	originalQuality  = 90
+	renditionQuality = 82
+)
+
+var (
+	ErrUnsupported = errors.New("поддерживаются только картинки JPEG, PNG, GIF и WebP")
+	ErrTooLarge    = fmt.Errorf("картинка больше %d мегапикселей", maxPixels/1_000_000)
+)
+
+// Process проверяет картинку и возвращает очищенный оригинал (Content, MimeType, Width, Height)
+// и уменьшенные копии. Имя файла и автора заполняет вызывающий
+func Process(content []byte) (*models.Image, []*models.ImageRendition, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, ErrUnsupported
+	}
+	if cfg.Width < 1 || cfg.Height < 1 {
+		return nil, nil, ErrUnsupported
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, nil, ErrTooLarge
+	}
+
+	var src image.Image
+	original := &models.Image{}
+	switch format {
+	case "jpeg":
+		m, err := jpeg.Decode(bytes.NewReader(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("не удалось прочитать JPEG:\n%w", err)
+		}
+		src = orient(toRGBA(m), jpegOrientation(content))
+	case "png", "webp":
+		m, _, err := image.Decode(bytes.NewReader(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("не удалось прочитать картинку:\n%w", err)
+		}
+		src = toRGBA(m)
+	case "gif":
+		// DecodeAll распаковывает все кадры сразу, поэтому ограничение действует на их сумму
+		pixels, err := gifFramePixels(content)
+		if err != nil {
+			return nil, nil, ErrUnsupported
+		}
+		if pixels > maxPixels {
+			return nil, nil, fmt.Errorf("%w в сумме по всем кадрам", ErrTooLarge)
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("не удалось прочитать GIF:\n%w", err)
+		}
+		// Кадры сохраняются как есть, без комментариев и прочих расширений
+		var buf bytes.Buffer
+		if err = gif.EncodeAll(&buf, g); err != nil {
+			return nil, nil, err
+		}
+		original.Content, original.MimeType = buf.Bytes(), "image/gif"
+		original.Width, original.Height = g.Config.Width, g.Config.Height
+		// Копии и WebP-варианты потеряли бы анимацию, поэтому анимированная картинка отдаётся только целиком
+		if len(g.Image) > 1 {
+			return original, nil, nil
+		}
+		src = toRGBA(g.Image[0])
+	default:
+		return nil, nil, ErrUnsupported
+	}
+
+	// Фотографии остаются JPEG, всё остальное - PNG, чтобы не потерять прозрачность и чёткие края.
+	// WebP со сжатием с потерями без прозрачности - тоже фотография
+	lossless := format != "jpeg"
+	if format == "webp" && !webpLossless(content) && isOpaque(src) {
+		lossless = false
+	}
+
+	if original.Content == nil {
+		if b := src.Bounds(); b.Dx() > MaxDimension || b.Dy() > MaxDimension {
+			src = fit(src, MaxDimension)
+		}
+		r, err := encode(src, lossless, originalQuality)
+		if err != nil {
+			return nil, nil, err
+		}
+		original.Content, original.MimeType = r.Content, r.MimeType
+		original.Width, original.Height = r.Width, r.Height
+	}
+
+	var renditions []*models.ImageRendition
+	if lossless {
+		if r, err := encodeWebP(src); err == nil && len(r.Content) < len(original.Content) {
+			renditions = append(renditions, r)
+		}
+	}
+	for _, width := range Widths {
+		if width >= src.Bounds().Dx() {
+			break
+		}
+		scaled := resize(src, width)
+		r, err := encode(scaled, lossless, renditionQuality)
+		if err != nil {
+			return nil, nil, err
+		}
+		renditions = append(renditions, r)
+		if lossless {
+			if w, err := encodeWebP(scaled); err == nil && len(w.Content) < len(r.Content) {
+				renditions = append(renditions, w)
+			}
+		}
+	}
+	return original, renditions, nil
+}
+
+func encode(m image.Image, lossless bool, quality int) (*models.ImageRendition, error) {
+	b := m.Bounds()
+	r := &models.ImageRendition{Width: b.Dx(), Height: b.Dy()}
+	var buf bytes.Buffer
+	var err error
+	if lossless {
+		r.MimeType = "image/png"
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, m)
+	} else {
+		r.MimeType = "image/jpeg"
+		err = jpeg.Encode(&buf, m, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось сохранить картинку %s:\n%w", r.MimeType, err)
+	}
+	r.Content = buf.Bytes()
+	return r, nil
+}
+
+func encodeWebP(m image.Image) (*models.ImageRendition, error) {
+	b := m.Bounds()
+	var buf bytes.Buffer
+	if err := webp.Encode(&buf, m); err != nil {
+		return nil, err
+	}
+	return &models.ImageRendition{Width: b.Dx(), Height: b.Dy(), MimeType: "image/webp", Content: buf.Bytes()}, nil
+}
+
+// toRGBA переводит картинку в *image.RGBA с началом координат в нуле: с ним быстро работают поворот и масштабирование
+func toRGBA(m image.Image) *image.RGBA {
+	b := m.Bounds()
+	if rgba, ok := m.(*image.RGBA); ok && b.Min == (image.Point{}) {
+		return rgba
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), m, b.Min, draw.Src)
+	return rgba
+}
+
+// webpLossless сообщает, сжата ли картинка WebP без потерь: ищет среди блоков RIFF блок VP8L
+func webpLossless(content []byte) bool {
+	for i := 12; i+8 <= len(content); {
+		switch string(content[i : i+4]) {
+		case "VP8L":
+			return true
+		case "VP8 ":
+			return false
+		}
+		size := int(binary.LittleEndian.Uint32(content[i+4:]))
+		i += 8 + size + size&1
+	}
+	return false
+}
+
+// gifFramePixels складывает площади всех кадров GIF, пропуская сжатые данные без распаковки
+func gifFramePixels(content []byte) (int, error) {
+	errMalformed := errors.New("повреждённый GIF")
+	// Заголовок (6 байт) и описание логического экрана (7 байт)
+	if len(content) < 13 {
+		return 0, errMalformed
+	}
+	i := 13
+	if flags := content[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1)
+	}
+
+	// skipSubBlocks пропускает цепочку блоков данных, которая заканчивается блоком нулевой длины
+	skipSubBlocks := func() error {
+		for {
+			if i >= len(content) {
+				return errMalformed
+			}
+			size := int(content[i])
+			i += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+
+	pixels := 0
+	for {
+		if i >= len(content) {
+			return 0, errMalformed
+		}
+		switch content[i] {
+		case 0x21: // расширение: метка и блоки данных
+			i += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2c: // кадр: описание (10 байт с меткой), таблица цветов, размер кода LZW и сжатые данные
+			if i+10 > len(content) {
+				return 0, errMalformed
+			}
+			w := int(binary.LittleEndian.Uint16(content[i+5:]))
+			h := int(binary.LittleEndian.Uint16(content[i+7:]))
+			pixels += w * h
+			flags := content[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x3b: // конец файла
+			return pixels, nil
+		default:
+			return 0, errMalformed
+		}
+	}
+}
+
+func isOpaque(m image.Image) bool {
+	if o, ok := m.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// resize уменьшает картинку до ширины width с сохранением пропорций
+func resize(m image.Image, width int) *image.RGBA {
+	b := m.Bounds()
+	height := max(1, (b.Dy()*width+b.Dx()/2)/b.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), m, b, xdraw.Src, nil)
+	return dst
+}
+
+// fit уменьшает картинку так, чтобы большая сторона была не больше size
+func fit(m image.Image, size int) *image.RGBA {
+	b := m.Bounds()
+	if b.Dx() >= b.Dy() {
+		return resize(m, size)
+	}
+	return resize(m, max(1, (b.Dx()*size+b.Dy()/2)/b.Dy()))
+}
@@ -0,0 +1,302 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// gradient - непрозрачная картинка, на которой видно и уменьшение, и поворот
+func gradient(w, h int) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return m
+}
+
+func encodePNG(t *testing.T, m image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, m image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, frames int, w, h int) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.White, color.Black})
+		frame.SetColorIndex(i%w, 0, 1)
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// bigGIF собирает GIF из frames кадров w x h с пустыми данными LZW: размеры видны без распаковки
+func bigGIF(frames, w, h int) []byte {
+	b := []byte("GIF89a")
+	b = binary.LittleEndian.AppendUint16(b, uint16(w))
+	b = binary.LittleEndian.AppendUint16(b, uint16(h))
+	b = append(b, 0x80, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff) // глобальная таблица из двух цветов
+	for i := 0; i < frames; i++ {
+		b = append(b, 0x21, 0xf9, 4, 0, 10, 0, 0, 0) // задержка кадра
+		b = append(b, 0x2c, 0, 0, 0, 0)
+		b = binary.LittleEndian.AppendUint16(b, uint16(w))
+		b = binary.LittleEndian.AppendUint16(b, uint16(h))
+		b = append(b, 0, 2, 1, 0x44, 0)
+	}
+	return append(b, 0x3b)
+}
+
+// pngWithSize меняет размеры в заголовке PNG, не трогая данные, и пересчитывает контрольную сумму
+func pngWithSize(t *testing.T, w, h uint32) []byte {
+	t.Helper()
+	content := encodePNG(t, gradient(1, 1))
+	// Сигнатура (8 байт), длина (4), "IHDR" (4), ширина и высота
+	binary.BigEndian.PutUint32(content[16:], w)
+	binary.BigEndian.PutUint32(content[20:], h)
+	binary.BigEndian.PutUint32(content[29:], crc32.ChecksumIEEE(content[12:29]))
+	return content
+}
+
+// withOrientation вставляет сразу после SOI сегмент EXIF с тегом ориентации
+func withOrientation(content []byte, orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := append([]byte(nil), content[:2]...)
+	out = append(out, 0xff, 0xe1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, content[2:]...)
+}
+
+func TestProcessRejected(t *testing.T) {
+	bmp := []byte("BM\x3a\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00\x28\x00\x00\x00\x01\x00\x00\x00\x01\x00\x00\x00\x01\x00\x18\x00")
+	tests := []struct {
+		name    string
+		content []byte
+		want    error
+	}{
+		{"пустой файл", nil, ErrUnsupported},
+		{"текст", []byte("просто текст, переименованный в photo.jpg"), ErrUnsupported},
+		{"HTML", []byte("<!DOCTYPE html><html><script>alert(1)</script></html>"), ErrUnsupported},
+		{"BMP", bmp, ErrUnsupported},
+		{"обрезанный PNG", encodePNG(t, gradient(4, 4))[:20], ErrUnsupported},
+		{"нулевая ширина", pngWithSize(t, 0, 10), ErrUnsupported},
+		{"слишком много пикселей", pngWithSize(t, 10_000, 10_000), ErrTooLarge},
+		{"GIF с большими кадрами", bigGIF(3, 7000, 7000), ErrTooLarge},
+		{"GIF с сотней кадров", bigGIF(100, 1000, 1000), ErrTooLarge},
+		{"обрезанный GIF", bigGIF(2, 100, 100)[:40], ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Process(tt.content)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ошибка %v, ожидалась %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGIFFramePixels(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    int
+	}{
+		{"один кадр", encodeGIF(t, 1, 40, 20), 800},
+		{"анимация", encodeGIF(t, 3, 400, 200), 240_000},
+		{"пустые данные кадров", bigGIF(2, 7000, 7000), 98_000_000},
+	}
+	for _, tt := range tests {
+		got, err := gifFramePixels(tt.content)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: %d пикселей (ошибка %v), ожидалось %d", tt.name, got, err, tt.want)
+		}
+	}
+
+	content := encodeGIF(t, 2, 40, 20)
+	for _, n := range []int{0, 12, 13, len(content) / 2, len(content) - 1} {
+		if _, err := gifFramePixels(content[:n]); err == nil {
+			t.Errorf("GIF, обрезанный до %d байт, принят", n)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         []byte
+		mimeType        string
+		width, height   int
+		renditionType   string // формат копий, если отличается от оригинала
+		renditionWidths []int
+		webp            bool // есть ли WebP-варианты
+	}{
+		{"маленький PNG", encodePNG(t, gradient(200, 100)), "image/png", 200, 100, "", nil, false},
+		{"PNG", encodePNG(t, gradient(1000, 500)), "image/png", 1000, 500, "", []int{320, 640}, true},
+		{"JPEG", encodeJPEG(t, gradient(1000, 500)), "image/jpeg", 1000, 500, "", []int{320, 640}, false},
+		{"большой JPEG уменьшается", encodeJPEG(t, gradient(3000, 1500)), "image/jpeg", MaxDimension, MaxDimension / 2, "", Widths, false},
+		{"высокий JPEG уменьшается по высоте", encodeJPEG(t, gradient(600, 3000)), "image/jpeg", 512, MaxDimension, "", []int{320}, false},
+		{"GIF: копии в PNG", encodeGIF(t, 1, 400, 200), "image/gif", 400, 200, "image/png", []int{320}, true},
+		{"анимированный GIF без копий", encodeGIF(t, 3, 400, 200), "image/gif", 400, 200, "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original, renditions, err := Process(tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if original.MimeType != tt.mimeType || original.Width != tt.width || original.Height != tt.height {
+				t.Fatalf("оригинал %s %dx%d, ожидался %s %dx%d",
+					original.MimeType, original.Width, original.Height, tt.mimeType, tt.width, tt.height)
+			}
+			// Расшифрованные картинки без потерь по ширине: с ними сравниваются WebP-варианты
+			lossless := map[int]image.Image{original.Width: checkDecodes(t, original.Content, original.Width, original.Height)}
+			var webps []image.Image
+
+			renditionType := tt.renditionType
+			if renditionType == "" {
+				renditionType = tt.mimeType
+			}
+			var widths []int
+			webp := false
+			for _, r := range renditions {
+				m := checkDecodes(t, r.Content, r.Width, r.Height)
+				if want := max(1, (tt.height*r.Width+tt.width/2)/tt.width); r.Height != want {
+					t.Errorf("копия %s шириной %d: высота %d, ожидалась %d", r.MimeType, r.Width, r.Height, want)
+				}
+				switch r.MimeType {
+				case "image/webp":
+					webp = true
+					webps = append(webps, m)
+				case renditionType:
+					widths = append(widths, r.Width)
+					if renditionType != "image/jpeg" {
+						lossless[r.Width] = m
+					}
+				default:
+					t.Errorf("копия в формате %s", r.MimeType)
+				}
+			}
+			if !equalInts(widths, tt.renditionWidths) {
+				t.Errorf("ширины копий %v, ожидались %v", widths, tt.renditionWidths)
+			}
+			if webp != tt.webp {
+				t.Errorf("WebP-варианты: %v, ожидалось %v", webp, tt.webp)
+			}
+			for _, m := range webps {
+				want, ok := lossless[m.Bounds().Dx()]
+				if !ok {
+					t.Errorf("WebP шириной %d без копии без потерь того же размера", m.Bounds().Dx())
+					continue
+				}
+				if x, y, differ := firstDifference(m, want); differ {
+					t.Errorf("WebP шириной %d отличается от копии без потерь в пикселе (%d, %d)", m.Bounds().Dx(), x, y)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessStripsEXIF(t *testing.T) {
+	tests := []struct {
+		orientation   uint16
+		width, height int
+	}{
+		{1, 40, 20},
+		{3, 40, 20},
+		{6, 20, 40},
+		{8, 20, 40},
+	}
+	for _, tt := range tests {
+		content := withOrientation(encodeJPEG(t, gradient(40, 20)), tt.orientation)
+		if got := jpegOrientation(content); got != int(tt.orientation) {
+			t.Fatalf("jpegOrientation = %d, ожидалось %d", got, tt.orientation)
+		}
+
+		original, _, err := Process(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if original.Width != tt.width || original.Height != tt.height {
+			t.Errorf("ориентация %d: %dx%d, ожидалось %dx%d", tt.orientation, original.Width, original.Height, tt.width, tt.height)
+		}
+		if bytes.Contains(original.Content, []byte("Exif")) {
+			t.Errorf("ориентация %d: EXIF остался в оригинале", tt.orientation)
+		}
+	}
+}
+
+// checkDecodes полностью расшифровывает картинку и сверяет её размер с метаданными
+func checkDecodes(t *testing.T, content []byte, width, height int) image.Image {
+	t.Helper()
+	m, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("результат не читается: %v", err)
+	}
+	if b := m.Bounds(); b.Dx() != width || b.Dy() != height {
+		t.Errorf("в файле %dx%d, в метаданных %dx%d", b.Dx(), b.Dy(), width, height)
+	}
+	return m
+}
+
+// firstDifference возвращает первый пиксель, в котором картинки одного размера различаются
+func firstDifference(a, b image.Image) (int, int, bool) {
+	ab, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			ca := color.NRGBAModel.Convert(a.At(ab.Min.X+x, ab.Min.Y+y))
+			cb := color.NRGBAModel.Convert(b.At(bb.Min.X+x, bb.Min.Y+y))
+			if ca != cb {
+				return x, y, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/svuvi/theweek/backup"
+)
+
+// Backups раз в interval снимает ежечасную и ежедневную копии базы, если подошёл их срок.
+// Работает до отмены ctx
+func Backups(ctx context.Context, store *backup.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, kind := range []backup.Kind{backup.KindDaily, backup.KindHourly} {
+			due, err := store.Due(kind, time.Now())
+			if err != nil {
+				log.Print("Ошибка при чтении папки резервных копий:\n", err)
+				break
+			}
+			if !due {
+				continue
+			}
+			snapshot, err := store.Create(kind)
+			if err != nil {
+				log.Print("Ошибка при создании резервной копии базы данных:\n", err)
+				continue
+			}
+			log.Printf("Создана резервная копия %s", snapshot.Name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
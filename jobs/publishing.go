@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/svuvi/theweek/models"
+)
+
+// PublishScheduled раз в interval публикует запланированные статьи, время публикации которых наступило.
+// Работает до отмены ctx
+func PublishScheduled(ctx context.Context, articleRepo models.ArticleRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := articleRepo.PublishScheduled(time.Now())
+		if err != nil {
+			log.Print("Ошибка при публикации запланированных статей:\n", err)
+		} else if n > 0 {
+			log.Printf("Опубликовано запланированных статей: %d", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
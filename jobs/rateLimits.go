@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/svuvi/theweek/models"
+	"github.com/svuvi/theweek/ratelimit"
+)
+
+// PersistRateLimits восстанавливает состояние ограничителей из БД, а затем сохраняет его раз в interval
+// и при отмене ctx, чтобы перезапуск сервера не обнулял счётчики попыток входа
+func PersistRateLimits(ctx context.Context, repo models.RateLimitRepository, interval time.Duration, limiters ...*ratelimit.Limiter) {
+	for _, l := range limiters {
+		if err := l.Load(repo); err != nil {
+			log.Printf("Ошибка при загрузке состояния ограничителя %s:\n%v", l.Name(), err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			saveRateLimits(repo, limiters)
+			return
+		case <-ticker.C:
+			saveRateLimits(repo, limiters)
+		}
+	}
+}
+
+func saveRateLimits(repo models.RateLimitRepository, limiters []*ratelimit.Limiter) {
+	for _, l := range limiters {
+		if err := l.Save(repo); err != nil {
+			log.Printf("Ошибка при сохранении состояния ограничителя %s:\n%v", l.Name(), err)
+		}
+	}
+}
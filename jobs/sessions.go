@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/svuvi/theweek/models"
+)
+
+// CleanupSessions раз в interval удаляет завершённые и истёкшие по policy сессии.
+// Работает до отмены ctx
+func CleanupSessions(ctx context.Context, sessionRepo models.SessionRepository, policy models.SessionPolicy, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		n, err := sessionRepo.DeleteStale(now.Add(-policy.MaxAge), now.Add(-policy.IdleTimeout))
+		if err != nil {
+			log.Print("Ошибка при удалении устаревших сессий:\n", err)
+		} else if n > 0 {
+			log.Printf("Удалено устаревших сессий: %d", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,26 +1,129 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"strings"
 
+	"github.com/svuvi/theweek/blobstore"
+	"github.com/svuvi/theweek/config"
 	"github.com/svuvi/theweek/db"
-	"github.com/svuvi/theweek/middleware"
-	"github.com/svuvi/theweek/routes"
+	"github.com/svuvi/theweek/repositories"
 )
 
+type command struct {
+	name  string // одно или два слова: "serve", "user create"
+	args  string
+	usage string
+	run   func(fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"serve", "[-migrate-only]", "запустить сайт (команда по умолчанию)", runServe},
+	{"migrate", "[status]", "применить миграции базы данных или показать их состояние", runMigrate},
+	{"user create", "[-admin] [-role роль] логин", "создать пользователя, пароль вводится с клавиатуры", runUserCreate},
+	{"user reset-password", "логин", "задать пользователю новый пароль и завершить его сессии", runUserResetPassword},
+	{"invite create", "[-n количество]", "создать ссылки-приглашения для регистрации", runInviteCreate},
+	{"recovery-code create", "логин", "создать ссылку для восстановления пароля", runRecoveryCodeCreate},
+	{"article export", "[-o файл] [slug ...]", "выгрузить статьи в JSON (все, если slug не указаны)", runArticleExport},
+	{"article import", "[-update] [-author логин] файл", "загрузить статьи из JSON, созданного article export", runArticleImport},
+	{"image reprocess", "", "создать уменьшенные копии картинок, загруженных до их появления", runImageReprocess},
+	{"db backup", "файл", "сохранить копию базы данных, не останавливая сайт", runDBBackup},
+	{"db restore", "[-yes] файл|имя-копии", "заменить базу данных резервной копией (сайт должен быть остановлен)", runDBRestore},
+}
+
 func main() {
-	db := db.ConnectDB()
-	defer db.Close()
+	cmd, args := findCommand(os.Args[1:])
+	if cmd == nil {
+		printUsage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("theweek "+cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Использование: theweek %s %s\n%s\n\nФлаги:\n", cmd.name, cmd.args, cmd.usage)
+		fs.PrintDefaults()
+	}
 
-	h := routes.NewBaseHandler(db)
-	router := middleware.NewLogger(h.NewRouter())
+	err := cmd.run(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Ошибка:", err)
+		os.Exit(1)
+	}
+}
 
-	server := http.Server{
-		Addr:    ":8080",
-		Handler: router,
+// findCommand находит команду по первым словам args. Без команды, в том числе когда первым идёт флаг,
+// запускается serve, чтобы старые способы запуска (./theweek -listen ...) продолжали работать
+func findCommand(args []string) (*command, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return &commands[0], args
 	}
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == commands[i].name {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, nil
+}
 
-	log.Printf("Запускаю сервер http://localhost%s", server.Addr)
-	server.ListenAndServe()
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Использование: theweek <команда> [флаги]\n\nКоманды:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-22s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nФлаги команды и общие настройки: theweek <команда> -h")
+}
+
+// errUsage означает, что команде передали не те аргументы. Справка по команде к этому моменту уже выведена
+var errUsage = errors.New("неверные аргументы команды")
+
+// loadConfig разбирает флаги команды вместе с общими настройками и проверяет количество аргументов после флагов
+func loadConfig(fs *flag.FlagSet, args []string, minArgs, maxArgs int) (*config.Config, error) {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if n := fs.NArg(); n < minArgs || (maxArgs >= 0 && n > maxArgs) {
+		fs.Usage()
+		return nil, errUsage
+	}
+	return cfg, nil
+}
+
+// openDB подключается к базе данных и применяет миграции, чтобы команды работали и на только что созданной базе
+func openDB(cfg *config.Config) (*sql.DB, error) {
+	conn := db.ConnectDB(cfg.DBPath)
+	if _, err := db.Migrate(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("не удалось обновить схему базы данных:\n%w", err)
+	}
+	return conn, nil
+}
+
+// openBlobStore создаёт хранилище загруженных файлов и переносит в него картинки, которые остались в базе
+// от версий до появления хранилища. Перенос продолжается с того же места, если его прервали
+func openBlobStore(cfg *config.Config, conn *sql.DB) (blobstore.Store, error) {
+	blobs, err := cfg.BlobStore()
+	if err != nil {
+		return nil, err
+	}
+	moved, err := repositories.NewImageRepo(conn, blobs).MoveContentToStore()
+	if moved > 0 {
+		log.Printf("Перенесено файлов из базы данных в хранилище: %d", moved)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось перенести картинки из базы данных в хранилище:\n%w", err)
+	}
+	return blobs, nil
 }
@@ -4,22 +4,102 @@ import (
 	"time"
 )
 
+type ArticleStatus string
+
+const (
+	StatusDraft       ArticleStatus = "draft"
+	StatusScheduled   ArticleStatus = "scheduled"
+	StatusPublished   ArticleStatus = "published"
+	StatusUnpublished ArticleStatus = "unpublished"
+)
+
+var ArticleStatuses = []ArticleStatus{StatusDraft, StatusScheduled, StatusPublished, StatusUnpublished}
+
+func (s ArticleStatus) Valid() bool {
+	switch s {
+	case StatusDraft, StatusScheduled, StatusPublished, StatusUnpublished:
+		return true
+	}
+	return false
+}
+
+func (s ArticleStatus) Label() string {
+	switch s {
+	case StatusDraft:
+		return "Черновик"
+	case StatusScheduled:
+		return "Запланирована"
+	case StatusPublished:
+		return "Опубликована"
+	case StatusUnpublished:
+		return "Снята с публикации"
+	}
+	return string(s)
+}
+
 type Article struct {
 	ID           int
 	Slug         string
-	CreatedAt    time.Time
+	CreatedAt    time.Time // Дата публикации. Для неопубликованных статей - дата создания
 	Title        string
 	TextMD       string
 	Description  string
 	CoverImageID int
+	SectionID    int // 0 если статья без рубрики
+	Status       ArticleStatus
+	PublishAt    time.Time // Время отложенной публикации, нулевое если не задано
+	UpdatedAt    time.Time // Время последнего изменения
+	Authors      []string  // Логины авторов, основной автор первый. Только для чтения, меняется через ArticleRepository.Save
+}
+
+func (a *Article) IsPublished() bool {
+	return a.Status == StatusPublished
+}
+
+// Маркеры начала и конца совпадения в подсвеченных полях результата поиска
+const (
+	SearchMarkStart = "\x02"
+	SearchMarkEnd   = "\x03"
+)
+
+type ArticleSearchResult struct {
+	Article *Article // Без TextMD
+	// Заголовок и фрагмент текста, где совпадения обёрнуты в SearchMarkStart и SearchMarkEnd
+	TitleHighlighted string
+	Snippet          string
 }
 
 type ArticleRepository interface {
-	Create(slug, title, textMD, description string, coverImageID int) error // coverImageID = 0 если отсутствует
 	GetByID(id int) (*Article, error)
 	GetBySlug(slug string) (*Article, error)
+	// GetAll возвращает статьи во всех статусах
 	GetAll() ([]*Article, error)
-	Update(*Article) error
-	SetCoverImage(id int, newCoverImageID int) error                                // coverImageID = 0 если отсутствует
+	// GetLatestPublished возвращает последние опубликованные статьи рубрики (sectionID = 0 для всех статей), начиная с новых
+	GetLatestPublished(sectionID, limit int) ([]*Article, error)
+	// GetPublishedCards возвращает страницу опубликованных статей без TextMD, начиная с новых
+	GetPublishedCards(sectionID, offset, limit int) ([]*Article, error)
+	// GetPublishedCardsBefore возвращает опубликованные статьи без TextMD, идущие в ленте после статьи
+	// с датой публикации before и идентификатором beforeID
+	GetPublishedCardsBefore(sectionID int, before time.Time, beforeID, limit int) ([]*Article, error)
+	CountPublished(sectionID int) (int, error)
+	// GetAllByAuthor возвращает статьи во всех статусах, где пользователь автор или соавтор
+	GetAllByAuthor(userID int) ([]*Article, error)
+	// GetPublishedByAuthor возвращает опубликованные статьи без TextMD, где пользователь автор или соавтор
+	GetPublishedByAuthor(userID int) ([]*Article, error)
+	// Save в одной транзакции создаёт статью (a.ID = 0, тогда заполняет a.ID) или обновляет её,
+	// заменяет авторов на authorIDs, если список не nil (первый в списке - основной автор),
+	// записывает ревизию от имени editorID и отмечает картинки из текста как используемые.
+	// CoverImageID и SectionID = 0 если отсутствуют, CreatedAt новой статьи - текущее время, если не задано.
+	// При ошибке ничего не сохраняется
+	Save(a *Article, authorIDs []int, editorID int) error
+	// Search ищет опубликованные статьи по заголовку, описанию и тексту. Результаты отсортированы по релевантности
+	Search(query string, limit int) ([]*ArticleSearchResult, error)
+	SetCoverImage(id int, newCoverImageID int) error // coverImageID = 0 если отсутствует
+	// FeedState возвращает время последнего изменения статей и количество опубликованных статей
+	// в рубрике (sectionID = 0 для всех статей). Используется для условных запросов к лентам
+	FeedState(sectionID int) (time.Time, int, error)
+	// PublishScheduled публикует запланированные статьи, у которых PublishAt не позже now.
+	// Возвращает количество опубликованных статей
+	PublishScheduled(now time.Time) (int, error)
 	Delete(id int) error
 }
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// AuditEvent - тип события в журнале безопасности
+type AuditEvent string
+
+const (
+	AuditLoginLockout AuditEvent = "login_lockout"
+	AuditLoginUnlock  AuditEvent = "login_unlock"
+	AuditTOTPEnabled  AuditEvent = "totp_enabled"
+	AuditTOTPDisabled AuditEvent = "totp_disabled"
+	AuditBackupCode   AuditEvent = "backup_code_used"
+	AuditPolicy       AuditEvent = "policy_changed"
+	AuditPasskeyAdd   AuditEvent = "passkey_added"
+	AuditPasskeyDel   AuditEvent = "passkey_removed"
+	AuditPasswordCLI  AuditEvent = "password_reset_cli"
+	AuditBackupCreate AuditEvent = "backup_created"
+	AuditBackupGet    AuditEvent = "backup_downloaded"
+)
+
+// Label возвращает описание события для интерфейса
+func (e AuditEvent) Label() string {
+	switch e {
+	case AuditLoginLockout:
+		return "Блокировка входа"
+	case AuditLoginUnlock:
+		return "Снятие блокировки"
+	case AuditTOTPEnabled:
+		return "2FA включена"
+	case AuditTOTPDisabled:
+		return "2FA отключена"
+	case AuditBackupCode:
+		return "Вход по резервному коду"
+	case AuditPolicy:
+		return "Изменение политики"
+	case AuditPasskeyAdd:
+		return "Добавлен ключ доступа"
+	case AuditPasskeyDel:
+		return "Удалён ключ доступа"
+	case AuditPasswordCLI:
+		return "Пароль сброшен из консоли"
+	case AuditBackupCreate:
+		return "Создана копия базы данных"
+	case AuditBackupGet:
+		return "Скачана копия базы данных"
+	}
+	return string(e)
+}
+
+type AuditEntry struct {
+	ID        int
+	CreatedAt time.Time
+	UserID    int // 0 если событие не связано с пользователем
+	Username  string
+	Event     AuditEvent
+	Details   string
+	IP        string
+}
+
+type AuditRepository interface {
+	Create(userID int, event AuditEvent, details, ip string) error
+	// GetRecent возвращает последние limit записей, новые первыми
+	GetRecent(limit int) ([]*AuditEntry, error)
+}
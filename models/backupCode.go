@@ -0,0 +1,10 @@
+package models
+
+// BackupCodeRepository хранит хэши резервных кодов двухфакторной аутентификации
+type BackupCodeRepository interface {
+	// Replace удаляет старые коды пользователя и сохраняет новые
+	Replace(userID int, codes []string) error
+	// Use отмечает код как использованный. Возвращает false, если такого неиспользованного кода нет
+	Use(userID int, code string) (bool, error)
+	CountUnused(userID int) (int, error)
+}
@@ -1,19 +1,69 @@
 package models
 
-import "time"
+import (
+	"context"
+	"io"
+	"time"
+)
 
 type Image struct {
 	ID         int
 	Filename   string
 	UploadedBy int
 	UploadedAt time.Time
-	Content    []byte
+	MimeType   string
+	Width      int // 0 у картинок, загруженных до появления обработки
+	Height     int
+	Size       int    // Размер содержимого в байтах
+	BlobKey    string // Ключ содержимого в хранилище файлов
+	Content    []byte // Передаётся в Create и заполняется Get, остальные методы его не читают
+}
+
+// ImageRendition - уменьшенная копия картинки или её вариант в другом формате
+type ImageRendition struct {
+	ImageID  int
+	Width    int
+	Height   int
+	MimeType string
+	Size     int
+	BlobKey  string
+	Content  []byte // Только для Create и Replace
+}
+
+// LibraryImage - картинка в медиатеке панели управления
+type LibraryImage struct {
+	Image
+	Uploader string // логин загрузившего, пустой если пользователь удалён
+	Usages   int    // статьи с картинкой на обложке или в тексте и пользователи с ней на аватаре
 }
 
 type ImageRepository interface {
-	Create(filename string, uploadedBy int, content []byte) (int, error) // Returns ID of the uploaded image
+	// Create сохраняет содержимое картинки и копий в хранилище файлов, а их описание - в базу. Возвращает ID картинки
+	Create(img *Image, renditions []*ImageRendition) (int, error)
+	// Get возвращает картинку вместе с содержимым
 	Get(id int) (*Image, error)
+	// GetMeta возвращает картинку без Content
+	GetMeta(id int) (*Image, error)
 	GetName(id int) (string, error)
+	// GetRenditions возвращает копии картинки без Content, от узких к широким
+	GetRenditions(imageID int) ([]*ImageRendition, error)
+	// OpenContent открывает содержимое картинки или копии по BlobKey
+	OpenContent(ctx context.Context, blobKey string) (io.ReadSeekCloser, error)
+	// ListUnprocessed возвращает ID картинок, загруженных до появления обработки
+	ListUnprocessed() ([]int, error)
+	// Replace заменяет содержимое картинки и все её копии
+	Replace(img *Image, renditions []*ImageRendition) error
+	// MoveContentToStore переносит в хранилище содержимое, оставшееся в базе от прошлых версий.
+	// Возвращает количество перенесённых файлов
+	MoveContentToStore() (int, error)
+	// List возвращает все картинки без Content для медиатеки, новые первыми
+	List() ([]*LibraryImage, error)
+	// ListMeta возвращает ID, имена и размеры всех картинок, новые первыми. Для выбора обложки
+	ListMeta() ([]*Image, error)
+	// Usages возвращает, сколько статей (включая их прошлые ревизии) и пользователей используют картинку
+	Usages(id int) (int, error)
 	ChangeFilename(id int, newFilename string) error
-	Delete(id int) error
+	// DeleteUnused удаляет картинку, если она нигде не используется.
+	// Иначе ничего не удаляет и возвращает количество использований, как Usages
+	DeleteUnused(id int) (int, error)
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Passkey - ключ доступа WebAuthn, зарегистрированный пользователем
+type Passkey struct {
+	ID           int
+	UserID       int
+	CredentialID []byte
+	PublicKey    []byte // ключ в формате COSE
+	SignCount    uint32
+	Name         string
+	CreatedAt    time.Time
+	LastUsed     time.Time // нулевое время, если ключом ещё не входили
+}
+
+type PasskeyRepository interface {
+	Create(userID int, credentialID, publicKey []byte, signCount uint32, name string) (*Passkey, error)
+	GetByCredentialID(credentialID []byte) (*Passkey, error)
+	GetByUser(userID int) ([]*Passkey, error)
+	// UpdateSignCount сохраняет новый счётчик подписей и время входа
+	UpdateSignCount(id int, signCount uint32) error
+	// Delete удаляет ключ, только если он принадлежит пользователю
+	Delete(id, userID int) error
+}
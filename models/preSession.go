@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Назначение предварительной сессии
+const (
+	// Пароль проверен, осталось ввести код 2FA
+	PreSessionTOTP = "totp"
+	// Браузеру выдан вызов для входа по ключу доступа
+	PreSessionPasskeyLogin = "passkey_login"
+	// Браузеру выдан вызов для регистрации нового ключа доступа вошедшим пользователем
+	PreSessionPasskeyRegister = "passkey_register"
+)
+
+// PreSession - начатый, но не завершённый вход или церемония WebAuthn
+type PreSession struct {
+	ID        int
+	Purpose   string
+	UserID    int // 0, если пользователь ещё неизвестен
+	Challenge []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (p *PreSession) IsExpired() bool {
+	return time.Now().After(p.ExpiresAt)
+}
+
+type PreSessionRepository interface {
+	// Create сохраняет хэш ключа. Заодно удаляет просроченные записи
+	Create(purpose string, userID int, key string, challenge []byte, lifetime time.Duration) (*PreSession, error)
+	GetByKey(key string) (*PreSession, error)
+	Delete(id int) error
+}
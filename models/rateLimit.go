@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RateLimitBucket - сохранённое состояние корзины токенов ограничителя частоты запросов
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+type RateLimitRepository interface {
+	// Load возвращает все сохранённые корзины ограничителя с именем limiter
+	Load(limiter string) ([]*RateLimitBucket, error)
+	// Replace заменяет сохранённые корзины ограничителя на buckets
+	Replace(limiter string, buckets []*RateLimitBucket) error
+}
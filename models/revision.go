@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ArticleRevision - сохранённая версия заголовка, описания и текста статьи
+type ArticleRevision struct {
+	ID             int
+	ArticleID      int
+	EditorID       int    // 0 если редактор неизвестен (ревизии, созданные до появления истории)
+	EditorUsername string // Заполняется при чтении, пустое если редактор неизвестен
+	CreatedAt      time.Time
+	Title          string
+	Description    string
+	TextMD         string
+}
+
+// Document собирает ревизию в один текст для сравнения
+func (r *ArticleRevision) Document() string {
+	return "# " + r.Title + "\n\n" + r.Description + "\n\n---\n\n" + r.TextMD
+}
+
+type RevisionRepository interface {
+	GetByID(id int) (*ArticleRevision, error)
+	// GetByArticle возвращает ревизии статьи, начиная с самой новой
+	GetByArticle(articleID int) ([]*ArticleRevision, error)
+}
@@ -0,0 +1,70 @@
+package models
+
+import "slices"
+
+// Role определяет, что пользователь может делать на сайте. Хранится в users.role
+type Role string
+
+const (
+	RoleReader Role = "reader"
+	RoleAuthor Role = "author"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// Roles перечисляет роли в порядке возрастания прав, для выпадающих списков
+var Roles = []Role{RoleReader, RoleAuthor, RoleEditor, RoleAdmin}
+
+func (r Role) Valid() bool {
+	return slices.Contains(Roles, r)
+}
+
+// AtLeast сообщает, что роль не ниже other в порядке Roles
+func (r Role) AtLeast(other Role) bool {
+	return slices.Index(Roles, r) >= slices.Index(Roles, other) && r.Valid()
+}
+
+// Label возвращает название роли для интерфейса
+func (r Role) Label() string {
+	switch r {
+	case RoleReader:
+		return "Читатель"
+	case RoleAuthor:
+		return "Автор"
+	case RoleEditor:
+		return "Редактор"
+	case RoleAdmin:
+		return "Администратор"
+	}
+	return string(r)
+}
+
+type Permission string
+
+const (
+	// Доступ к панели управления
+	PermissionDashboard Permission = "dashboard"
+	// Создание статей и редактирование статей, где пользователь указан автором
+	PermissionWriteArticles Permission = "write_articles"
+	// Редактирование, публикация и удаление любых статей
+	PermissionEditAllArticles Permission = "edit_all_articles"
+	PermissionManageSections  Permission = "manage_sections"
+	PermissionManageInvites   Permission = "manage_invites"
+	// Просмотр пользователей, назначение ролей и коды восстановления
+	PermissionManageUsers Permission = "manage_users"
+	// Создание и скачивание резервных копий базы данных
+	PermissionManageBackups Permission = "manage_backups"
+)
+
+// rolePermissions - таблица прав каждой роли
+var rolePermissions = map[Role][]Permission{
+	RoleReader: {},
+	RoleAuthor: {PermissionDashboard, PermissionWriteArticles},
+	RoleEditor: {PermissionDashboard, PermissionWriteArticles, PermissionEditAllArticles, PermissionManageSections},
+	RoleAdmin: {PermissionDashboard, PermissionWriteArticles, PermissionEditAllArticles, PermissionManageSections,
+		PermissionManageInvites, PermissionManageUsers, PermissionManageBackups},
+}
+
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
@@ -0,0 +1,67 @@
+package models
+
+import "testing"
+
+func TestRoleCan(t *testing.T) {
+	all := []Permission{PermissionDashboard, PermissionWriteArticles, PermissionEditAllArticles, PermissionManageSections,
+		PermissionManageInvites, PermissionManageUsers, PermissionManageBackups}
+
+	tests := []struct {
+		role    Role
+		allowed []Permission
+	}{
+		{RoleReader, nil},
+		{RoleAuthor, []Permission{PermissionDashboard, PermissionWriteArticles}},
+		{RoleEditor, []Permission{PermissionDashboard, PermissionWriteArticles, PermissionEditAllArticles, PermissionManageSections}},
+		{RoleAdmin, all},
+		{Role(""), nil},
+		{Role("superuser"), nil},
+	}
+	for _, tt := range tests {
+		allowed := map[Permission]bool{}
+		for _, p := range tt.allowed {
+			allowed[p] = true
+		}
+		for _, p := range all {
+			if got := tt.role.Can(p); got != allowed[p] {
+				t.Errorf("%q.Can(%s) = %v, ожидалось %v", tt.role, p, got, allowed[p])
+			}
+		}
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role, other Role
+		want        bool
+	}{
+		{RoleAdmin, RoleEditor, true},
+		{RoleEditor, RoleEditor, true},
+		{RoleAuthor, RoleEditor, false},
+		{RoleReader, RoleReader, true},
+		{RoleReader, RoleAuthor, false},
+		{Role("superuser"), RoleReader, false},
+		{Role(""), RoleReader, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.AtLeast(tt.other); got != tt.want {
+			t.Errorf("%q.AtLeast(%q) = %v, ожидалось %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestRoleValid(t *testing.T) {
+	for _, r := range Roles {
+		if !r.Valid() {
+			t.Errorf("роль %q недействительна", r)
+		}
+		if r.Label() == string(r) {
+			t.Errorf("у роли %q нет названия", r)
+		}
+	}
+	for _, r := range []Role{"", "Admin", "root"} {
+		if r.Valid() {
+			t.Errorf("роль %q считается действительной", r)
+		}
+	}
+}
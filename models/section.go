@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type Section struct {
+	ID          int
+	Slug        string
+	Name        string
+	InNavTop    bool      // Показывать в верхнем ряду навигации
+	InNavBottom bool      // Показывать в нижнем ряду навигации
+	Position    int       // Порядок в навигации, по возрастанию
+	UpdatedAt   time.Time // Время последнего изменения, входит в Last-Modified ленты рубрики
+}
+
+type SectionRepository interface {
+	Create(slug, name string, inNavTop, inNavBottom bool, position int) (*Section, error)
+	GetByID(id int) (*Section, error)
+	GetBySlug(slug string) (*Section, error)
+	// GetAll возвращает все рубрики, отсортированные по Position
+	GetAll() ([]*Section, error)
+	Update(*Section) error
+	// Delete удаляет рубрику. Статьи этой рубрики остаются без рубрики
+	Delete(id int) error
+}
@@ -9,10 +9,35 @@ type Session struct {
 	CreatedAt      time.Time
 	LastUse        time.Time
 	IsActive       bool
+	UserAgent      string
+	IP             string
+}
+
+// SessionPolicy задаёт сроки жизни сессий
+type SessionPolicy struct {
+	// Сессия истекает через MaxAge после входа, даже если ей постоянно пользуются
+	MaxAge time.Duration
+	// и через IdleTimeout без запросов
+	IdleTimeout time.Duration
+}
+
+// ExpiresAt возвращает момент, когда сессия истечёт, если ей больше не пользоваться
+func (p SessionPolicy) ExpiresAt(s *Session) time.Time {
+	absolute := s.CreatedAt.Add(p.MaxAge)
+	idle := s.LastUse.Add(p.IdleTimeout)
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+func (p SessionPolicy) IsExpired(s *Session, now time.Time) bool {
+	return !now.Before(p.ExpiresAt(s))
 }
 
 type SessionRepository interface {
-	Create(userID int, sessionKey string) (*Session, error)
+	Create(userID int, sessionKey, userAgent, ip string) (*Session, error)
+	// GetUserSessions возвращает сессии пользователя, начиная с недавно использованных
 	GetUserSessions(userID int) ([]*Session, error)
 	GetSessionByID(sessionID int) (*Session, error)
 	GetSessionByKey(sessionKey string) (*Session, error)
@@ -20,4 +45,11 @@ type SessionRepository interface {
 	UpdateLastUsedByKey(sessionKey string) error
 	UpdateLastUsedByID(sessionID int) error
 	SetInactive(sessionKey string) error
+	// SetInactiveByID завершает сессию, только если она принадлежит пользователю
+	SetInactiveByID(sessionID, userID int) error
+	// SetInactiveExcept завершает все сессии пользователя, кроме exceptSessionID. Возвращает число завершённых сессий
+	SetInactiveExcept(userID, exceptSessionID int) (int, error)
+	// DeleteStale удаляет завершённые сессии и сессии, созданные до createdBefore или не использовавшиеся с usedBefore.
+	// Возвращает число удалённых сессий
+	DeleteStale(createdBefore, usedBefore time.Time) (int, error)
 }
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionPolicyExpiry(t *testing.T) {
+	policy := SessionPolicy{MaxAge: 30 * 24 * time.Hour, IdleTimeout: 7 * 24 * time.Hour}
+	login := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		lastUse   time.Time
+		now       time.Time
+		expiresAt time.Time
+		expired   bool
+	}{
+		{"сразу после входа", login, login, login.Add(7 * day), false},
+		{"почти неделя без запросов", login, login.Add(7*day - time.Second), login.Add(7 * day), false},
+		{"неделя без запросов", login, login.Add(7 * day), login.Add(7 * day), true},
+		{"пользовались вчера", login.Add(10 * day), login.Add(11 * day), login.Add(17 * day), false},
+		// Постоянное использование не продлевает сессию дольше MaxAge
+		{"пользуются каждый день", login.Add(29 * day), login.Add(29*day + time.Hour), login.Add(30 * day), false},
+		{"месяц после входа", login.Add(30*day - time.Hour), login.Add(30 * day), login.Add(30 * day), true},
+	}
+	for _, tt := range tests {
+		s := &Session{CreatedAt: login, LastUse: tt.lastUse}
+		if got := policy.ExpiresAt(s); !got.Equal(tt.expiresAt) {
+			t.Errorf("%s: ExpiresAt = %v, ожидалось %v", tt.name, got, tt.expiresAt)
+		}
+		if got := policy.IsExpired(s, tt.now); got != tt.expired {
+			t.Errorf("%s: IsExpired = %v, ожидалось %v", tt.name, got, tt.expired)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+// Ключи настроек сайта
+const (
+	// "1" если администраторы обязаны включить двухфакторную аутентификацию
+	SettingRequireAdmin2FA = "require_admin_2fa"
+)
+
+type SettingsRepository interface {
+	// Get возвращает значение настройки или пустую строку, если она не задана
+	Get(key string) (string, error)
+	Set(key, value string) error
+}
@@ -1,13 +1,58 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+)
 
 type User struct {
 	ID             int
 	Username       string
 	HashedPassowrd string
 	RegisteredAt   time.Time
-	IsAdmin        bool
+	Role           Role
+	Bio            string
+	AvatarImageID  int // 0 если аватара нет
+	FailedLogins   int
+	LockedUntil    time.Time // нулевое время если вход не блокировался
+	TOTPSecret     string
+	TOTPEnabled    bool
+	TOTPLastStep   int64
+}
+
+// LoginDisabled сообщает, что вход по паролю отключён: так миграция помечает пользователя admin
+// со старым паролем из репозитория, пока ему не зададут новый
+func (u *User) LoginDisabled() bool {
+	return strings.HasPrefix(u.HashedPassowrd, "disabled:")
+}
+
+// Can сообщает, есть ли у пользователя право p. У неавторизованного пользователя (ID = 0) прав нет
+func (u *User) Can(p Permission) bool {
+	return u.ID != 0 && u.Role.Can(p)
+}
+
+// CanEditArticle сообщает, может ли пользователь редактировать, публиковать и удалять статью.
+// Авторы могут работать только со статьями, где они указаны автором или соавтором
+func (u *User) CanEditArticle(a *Article) bool {
+	if u.Can(PermissionEditAllArticles) {
+		return true
+	}
+	return u.Can(PermissionWriteArticles) && slices.Contains(a.Authors, u.Username)
+}
+
+// CanManageImage сообщает, может ли пользователь переименовать и удалить картинку.
+// Авторы могут работать только со своими загрузками
+func (u *User) CanManageImage(img *Image) bool {
+	if u.Can(PermissionEditAllArticles) {
+		return true
+	}
+	return u.Can(PermissionWriteArticles) && img.UploadedBy == u.ID
+}
+
+// IsLocked сообщает, заблокирован ли сейчас вход в аккаунт после серии неудачных попыток
+func (u *User) IsLocked() bool {
+	return u.LockedUntil.After(time.Now())
 }
 
 type UserRepository interface {
@@ -17,6 +62,21 @@ type UserRepository interface {
 	GetByUsername(username string) (*User, error)
 	ChangeUsername(id int, newUsername string) error
 	ChangePassword(id int, newHashedPassword string) error
-	SetAdmin(id int, isAdmin bool) error
+	SetRole(id int, role Role) error
+	// UpdateProfile меняет описание и аватар пользователя. avatarImageID = 0 если аватара нет
+	UpdateProfile(id int, bio string, avatarImageID int) error
+	// RecordFailedLogin увеличивает счётчик неудачных попыток входа и возвращает новое значение.
+	// Если прошлая блокировка к моменту now истекла, она снимается и счёт начинается заново
+	RecordFailedLogin(id int, now time.Time) (int, error)
+	Lock(id int, until time.Time) error
+	// Unlock снимает блокировку входа и сбрасывает счётчик неудачных попыток
+	Unlock(id int) error
+	// SetTOTPSecret сохраняет секрет для подключения 2FA. 2FA включается только после EnableTOTP
+	SetTOTPSecret(id int, secret string) error
+	EnableTOTP(id int) error
+	// DisableTOTP выключает 2FA и удаляет секрет
+	DisableTOTP(id int) error
+	// UseTOTPStep отмечает шаг кода как использованный. Возвращает false, если этот или более поздний код уже принимался
+	UseTOTPStep(id int, step int64) (bool, error)
 	Delete(id int) error
 }
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserCan(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+		want bool
+	}{
+		{"администратор", User{ID: 1, Role: RoleAdmin}, true},
+		{"автор", User{ID: 2, Role: RoleAuthor}, false},
+		// Без входа прав нет, даже если роль заполнена
+		{"гость с ролью", User{Role: RoleAdmin}, false},
+		{"гость", User{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.user.Can(PermissionManageUsers); got != tt.want {
+			t.Errorf("%s: Can(manage_users) = %v, ожидалось %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUserCanEditArticle(t *testing.T) {
+	article := &Article{ID: 1, Authors: []string{"anna", "boris"}}
+	orphan := &Article{ID: 2}
+
+	tests := []struct {
+		name    string
+		user    User
+		article *Article
+		want    bool
+	}{
+		{"редактор, чужая статья", User{ID: 1, Username: "editor", Role: RoleEditor}, article, true},
+		{"администратор, статья без авторов", User{ID: 1, Username: "admin", Role: RoleAdmin}, orphan, true},
+		{"основной автор", User{ID: 2, Username: "anna", Role: RoleAuthor}, article, true},
+		{"соавтор", User{ID: 3, Username: "boris", Role: RoleAuthor}, article, true},
+		{"автор, чужая статья", User{ID: 4, Username: "vera", Role: RoleAuthor}, article, false},
+		{"автор, статья без авторов", User{ID: 2, Username: "anna", Role: RoleAuthor}, orphan, false},
+		// Указан автором, но роль понизили до читателя
+		{"читатель в списке авторов", User{ID: 2, Username: "anna", Role: RoleReader}, article, false},
+		{"гость с логином автора", User{Username: "anna", Role: RoleAuthor}, article, false},
+	}
+	for _, tt := range tests {
+		if got := tt.user.CanEditArticle(tt.article); got != tt.want {
+			t.Errorf("%s: CanEditArticle = %v, ожидалось %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUserCanManageImage(t *testing.T) {
+	img := &Image{ID: 1, UploadedBy: 2}
+
+	tests := []struct {
+		name string
+		user User
+		want bool
+	}{
+		{"редактор, чужая картинка", User{ID: 1, Role: RoleEditor}, true},
+		{"администратор", User{ID: 1, Role: RoleAdmin}, true},
+		{"автор, своя картинка", User{ID: 2, Role: RoleAuthor}, true},
+		{"автор, чужая картинка", User{ID: 3, Role: RoleAuthor}, false},
+		{"читатель, своя картинка", User{ID: 2, Role: RoleReader}, false},
+		{"гость", User{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.user.CanManageImage(img); got != tt.want {
+			t.Errorf("%s: CanManageImage = %v, ожидалось %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUserIsLocked(t *testing.T) {
+	tests := []struct {
+		name        string
+		lockedUntil time.Time
+		want        bool
+	}{
+		{"не блокировался", time.Time{}, false},
+		{"блокировка истекла", time.Now().Add(-time.Minute), false},
+		{"заблокирован", time.Now().Add(time.Minute), true},
+	}
+	for _, tt := range tests {
+		u := User{ID: 1, LockedUntil: tt.lockedUntil}
+		if got := u.IsLocked(); got != tt.want {
+			t.Errorf("%s: IsLocked = %v, ожидалось %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package qrcode
+
+// matrix - QR-код в процессе построения. isFunction отмечает служебные модули, которые не маскируются
+type matrix struct {
+	version    int
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+func newCode(version int) *matrix {
+	size := version*4 + 17
+	m := &matrix{version: version, size: size}
+	m.modules = make([][]bool, size)
+	m.isFunction = make([][]bool, size)
+	for i := range m.modules {
+		m.modules[i] = make([]bool, size)
+		m.isFunction[i] = make([]bool, size)
+	}
+
+	// Синхронизирующие линии
+	for i := 0; i < size; i++ {
+		m.set(6, i, i%2 == 0)
+		m.set(i, 6, i%2 == 0)
+	}
+
+	// Поисковые узоры с разделителями в трёх углах
+	m.drawFinder(3, 3)
+	m.drawFinder(size-4, 3)
+	m.drawFinder(3, size-4)
+
+	// Выравнивающие узоры, кроме пересекающихся с поисковыми
+	pos := versions[version].alignment
+	last := len(pos) - 1
+	for i, y := range pos {
+		for j, x := range pos {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					m.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Резервируем место под информацию о формате, настоящие значения пишет drawFormat
+	m.drawFormat(0)
+	m.drawVersion()
+	return m
+}
+
+// set рисует служебный модуль в столбце x, строке y
+func (m *matrix) set(x, y int, dark bool) {
+	m.modules[y][x] = dark
+	m.isFunction[y][x] = true
+}
+
+func (m *matrix) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= m.size || y < 0 || y >= m.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			m.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawFormat записывает уровень коррекции (M) и номер маски, защищённые кодом БЧХ, в обе копии
+func (m *matrix) drawFormat(mask int) {
+	const levelM = 0b00
+	data := levelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		m.set(8, i, bit(i))
+	}
+	m.set(8, 7, bit(6))
+	m.set(8, 8, bit(7))
+	m.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		m.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		m.set(m.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.set(8, m.size-15+i, bit(i))
+	}
+	m.set(8, m.size-8, true) // всегда тёмный модуль
+}
+
+// drawVersion записывает номер версии, начиная с 7-й
+func (m *matrix) drawVersion() {
+	if m.version < 7 {
+		return
+	}
+	rem := m.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := m.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 == 1
+		a, b := m.size-11+i%3, i/3
+		m.set(a, b, dark)
+		m.set(b, a, dark)
+	}
+}
+
+// drawCodewords раскладывает биты зигзагом парами столбцов справа налево, пропуская служебные модули
+func (m *matrix) drawCodewords(data []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < m.size; vert++ {
+			y := vert
+			if upward {
+				y = m.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if !m.isFunction[y][x] && i < len(data)*8 {
+					m.modules[y][x] = (data[i/8]>>(7-i%8))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (m *matrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				m.modules[y][x] = !m.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty оценивает маску по четырём правилам спецификации. Выбирается маска с наименьшей оценкой
+func (m *matrix) penalty() int {
+	result := 0
+	get := func(x, y int, vertical bool) bool {
+		if vertical {
+			return m.modules[x][y]
+		}
+		return m.modules[y][x]
+	}
+
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < m.size; y++ {
+			// Правило 1: пять и более одинаковых модулей подряд
+			run := 1
+			for x := 1; x < m.size; x++ {
+				if get(x, y, vertical) == get(x-1, y, vertical) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += 3 + run - 5
+				}
+				run = 1
+			}
+			if run >= 5 {
+				result += 3 + run - 5
+			}
+
+			// Правило 3: узоры, похожие на поисковые
+			for x := 0; x+11 <= m.size; x++ {
+				if matchesFinderLike(func(i int) bool { return get(x+i, y, vertical) }) {
+					result += 40
+				}
+			}
+		}
+	}
+
+	// Правило 2: блоки 2x2 одного цвета
+	for y := 0; y < m.size-1; y++ {
+		for x := 0; x < m.size-1; x++ {
+			c := m.modules[y][x]
+			if c == m.modules[y][x+1] && c == m.modules[y+1][x] && c == m.modules[y+1][x+1] {
+				result += 3
+			}
+		}
+	}
+
+	// Правило 4: доля тёмных модулей далека от половины
+	dark := 0
+	for _, row := range m.modules {
+		for _, d := range row {
+			if d {
+				dark++
+			}
+		}
+	}
+	total := m.size * m.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += k * 10
+
+	return result
+}
+
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+func matchesFinderLike(at func(i int) bool) bool {
+	for _, pattern := range finderLike {
+		match := true
+		for i, dark := range pattern {
+			if at(i) != dark {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,173 @@
+// Package qrcode кодирует короткие строки в QR-код (байтовый режим, уровень коррекции M, версии 1-10)
+// и рисует его в SVG. Этого хватает для otpauth:// ссылок двухфакторной аутентификации.
+// Спецификация: ISO/IEC 18004
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Code - готовый QR-код. Modules[y][x] == true для тёмного модуля
+type Code struct {
+	Size    int
+	Modules [][]bool
+}
+
+// Параметры блоков коррекции ошибок уровня M для версий 1-10
+type versionInfo struct {
+	ecPerBlock  int
+	blocks1     int
+	data1       int
+	blocks2     int
+	data2       int
+	alignment   []int
+	remainderBs int
+}
+
+var versions = []versionInfo{
+	1:  {10, 1, 16, 0, 0, nil, 0},
+	2:  {16, 1, 28, 0, 0, []int{6, 18}, 7},
+	3:  {26, 1, 44, 0, 0, []int{6, 22}, 7},
+	4:  {18, 2, 32, 0, 0, []int{6, 26}, 7},
+	5:  {24, 2, 43, 0, 0, []int{6, 30}, 7},
+	6:  {16, 4, 27, 0, 0, []int{6, 34}, 7},
+	7:  {18, 4, 31, 0, 0, []int{6, 22, 38}, 0},
+	8:  {22, 2, 38, 2, 39, []int{6, 24, 42}, 0},
+	9:  {22, 3, 36, 2, 37, []int{6, 26, 46}, 0},
+	10: {26, 4, 43, 1, 44, []int{6, 28, 50}, 0},
+}
+
+func (v versionInfo) dataCodewords() int {
+	return v.blocks1*v.data1 + v.blocks2*v.data2
+}
+
+var ErrTooLong = errors.New("qrcode: данные не помещаются в QR-код версии 10")
+
+// Encode кодирует data в QR-код наименьшей подходящей версии
+func Encode(data []byte) (*Code, error) {
+	version := 0
+	for v := 1; v < len(versions); v++ {
+		// Режим (4 бита) + длина (8 бит до версии 9, 16 бит с версии 10) + данные
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+len(data)*8 <= versions[v].dataCodewords()*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	codewords := addErrorCorrection(encodeData(data, version), versions[version])
+
+	c := newCode(version)
+	c.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // XOR повторно снимает маску
+	}
+	c.applyMask(best)
+	c.drawFormat(best)
+
+	return &Code{Size: c.size, Modules: c.modules}, nil
+}
+
+// encodeData собирает поток данных: режим, длина, байты, терминатор и байты-заполнители
+func encodeData(data []byte, version int) []byte {
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	if version >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	capacity := versions[version].dataCodewords() * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	return bits.bytes()
+}
+
+// addErrorCorrection делит данные на блоки, добавляет к каждому коды Рида-Соломона и перемежает блоки
+func addErrorCorrection(data []byte, v versionInfo) []byte {
+	divisor := rsDivisor(v.ecPerBlock)
+
+	var blocks, ecBlocks [][]byte
+	offset := 0
+	for i := 0; i < v.blocks1+v.blocks2; i++ {
+		n := v.data1
+		if i >= v.blocks1 {
+			n = v.data2
+		}
+		block := data[offset : offset+n]
+		offset += n
+		blocks = append(blocks, block)
+		ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+	}
+
+	var result []byte
+	for i := 0; i < max(v.data1, v.data2); i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				result = append(result, b[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, b := range ecBlocks {
+			result = append(result, b[i])
+		}
+	}
+	return result
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return result
+}
+
+// SVG рисует код с отступом в 4 модуля, как требует спецификация. Размер задаётся CSS
+func (c *Code) SVG() string {
+	const quiet = 4
+	var path strings.Builder
+	for y, row := range c.Modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+quiet, y+quiet)
+			}
+		}
+	}
+	size := c.Size + 2*quiet
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path d="%s" fill="#000"/></svg>`, size, size, path.String())
+}
@@ -0,0 +1,151 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Блоки версии 1-M из примеров ISO/IEC 18004 и руководства thonky.com: данные и ожидаемые коды коррекции
+func TestRSRemainder(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		ec   []byte
+	}{
+		{
+			"01234567",
+			[]byte{16, 32, 12, 86, 97, 128, 236, 17, 236, 17, 236, 17, 236, 17, 236, 17},
+			[]byte{165, 36, 212, 193, 237, 54, 199, 135, 44, 85},
+		},
+		{
+			"HELLO WORLD",
+			[]byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			[]byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+	}
+	for _, tt := range tests {
+		if got := rsRemainder(tt.data, rsDivisor(len(tt.ec))); !bytes.Equal(got, tt.ec) {
+			t.Errorf("%s: коды коррекции %v, ожидалось %v", tt.name, got, tt.ec)
+		}
+	}
+}
+
+// Строки формата для уровня M и масок 0-7 из таблицы C.1 ISO/IEC 18004
+var formatBits = [8]int{0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0}
+
+// readFormat читает обе копии информации о формате в порядке, в котором их пишет drawFormat
+func readFormat(m *matrix) (first, second int) {
+	at := func(x, y int) int {
+		if m.modules[y][x] {
+			return 1
+		}
+		return 0
+	}
+	for i := 0; i <= 5; i++ {
+		first |= at(8, i) << i
+	}
+	first |= at(8, 7)<<6 | at(8, 8)<<7 | at(7, 8)<<8
+	for i := 9; i < 15; i++ {
+		first |= at(14-i, 8) << i
+	}
+
+	for i := 0; i < 8; i++ {
+		second |= at(m.size-1-i, 8) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= at(8, m.size-15+i) << i
+	}
+	return first, second
+}
+
+func TestDrawFormat(t *testing.T) {
+	for mask, want := range formatBits {
+		m := newCode(1)
+		m.drawFormat(mask)
+		first, second := readFormat(m)
+		if first != want || second != want {
+			t.Errorf("маска %d: формат %015b и %015b, ожидалось %015b", mask, first, second, want)
+		}
+		if !m.modules[m.size-8][8] {
+			t.Errorf("маска %d: нет всегда тёмного модуля", mask)
+		}
+	}
+}
+
+// Информация о версии из таблицы D.1 ISO/IEC 18004
+func TestDrawVersion(t *testing.T) {
+	tests := map[int]int{7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3}
+	for version, want := range tests {
+		m := newCode(version)
+		var below, right int
+		for i := 0; i < 18; i++ {
+			a, b := m.size-11+i%3, i/3
+			if m.modules[a][b] {
+				below |= 1 << i
+			}
+			if m.modules[b][a] {
+				right |= 1 << i
+			}
+		}
+		if below != want || right != want {
+			t.Errorf("версия %d: %018b и %018b, ожидалось %018b", version, below, right, want)
+		}
+	}
+
+	// До 7-й версии информации о версии нет
+	m := newCode(6)
+	for i := 0; i < 18; i++ {
+		a, b := m.size-11+i%3, i/3
+		if m.isFunction[a][b] {
+			t.Fatalf("версия 6: место информации о версии занято")
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		length int
+		size   int // версия * 4 + 17
+	}{
+		{0, 21},
+		{14, 21}, // предел версии 1-M
+		{15, 25},
+		{106, 41}, // предел версии 6-M
+		{107, 45},
+		{213, 57}, // предел версии 10-M
+	}
+	for _, tt := range tests {
+		c, err := Encode([]byte(strings.Repeat("a", tt.length)))
+		if err != nil {
+			t.Fatalf("%d байт: %v", tt.length, err)
+		}
+		if c.Size != tt.size || len(c.Modules) != tt.size {
+			t.Errorf("%d байт: размер %d, ожидался %d", tt.length, c.Size, tt.size)
+			continue
+		}
+
+		// Записанная маска - одна из допустимых, и обе копии формата совпадают
+		first, second := readFormat(&matrix{size: c.Size, modules: c.Modules})
+		valid := false
+		for _, f := range formatBits {
+			valid = valid || f == first
+		}
+		if !valid || first != second {
+			t.Errorf("%d байт: формат %015b и %015b", tt.length, first, second)
+		}
+	}
+
+	if _, err := Encode(make([]byte, 214)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("214 байт: ошибка %v, ожидалась ErrTooLong", err)
+	}
+}
+
+func TestEncodeData(t *testing.T) {
+	// Байтовый режим, длина 2, "hi", терминатор и заполнители 0xEC 0x11 до 16 байт версии 1-M
+	want := []byte{0x40, 0x26, 0x86, 0x90, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	if got := encodeData([]byte("hi"), 1); !bytes.Equal(got, want) {
+		t.Errorf("encodeData = % X, ожидалось % X", got, want)
+	}
+}
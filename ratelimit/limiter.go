@@ -0,0 +1,126 @@
+// Package ratelimit реализует ограничение частоты запросов по алгоритму token bucket
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/svuvi/theweek/models"
+)
+
+// После этого количества корзин полные корзины удаляются прямо в Allow, чтобы память не росла без ограничений
+const maxBuckets = 10000
+
+// Limiter хранит по корзине токенов на каждый ключ (IP, логин и т.п.).
+// Каждая попытка забирает токен, токены восстанавливаются по одному раз в interval до capacity
+type Limiter struct {
+	name     string
+	capacity float64
+	interval time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New создаёт ограничитель. name используется как ключ при сохранении в БД и должен быть уникальным
+func New(name string, capacity int, interval time.Duration) *Limiter {
+	return &Limiter{
+		name:     name,
+		capacity: float64(capacity),
+		interval: interval,
+		buckets:  make(map[string]*bucket),
+	}
+}
+
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// refill начисляет токены, восстановившиеся с последнего обращения к корзине
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed > 0 {
+		b.tokens = min(l.capacity, b.tokens+float64(elapsed)/float64(l.interval))
+		b.updated = now
+	}
+}
+
+// Allow забирает токен из корзины key. Если токенов нет, возвращает false и время до появления следующего
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.capacity, updated: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(l.interval))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Reset возвращает корзине key все токены
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, key)
+}
+
+// Prune удаляет полностью восстановившиеся корзины, они ничем не отличаются от отсутствующих
+func (l *Limiter) Prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(time.Now())
+}
+
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Load восстанавливает корзины, сохранённые через Save, например после перезапуска сервера
+func (l *Limiter) Load(repo models.RateLimitRepository) error {
+	saved, err := repo.Load(l.name)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range saved {
+		l.buckets[s.Key] = &bucket{tokens: s.Tokens, updated: s.UpdatedAt}
+	}
+	l.prune(time.Now())
+	return nil
+}
+
+// Save сохраняет в БД все неполные корзины
+func (l *Limiter) Save(repo models.RateLimitRepository) error {
+	l.mu.Lock()
+	l.prune(time.Now())
+	buckets := make([]*models.RateLimitBucket, 0, len(l.buckets))
+	for key, b := range l.buckets {
+		buckets = append(buckets, &models.RateLimitBucket{Key: key, Tokens: b.tokens, UpdatedAt: b.updated})
+	}
+	l.mu.Unlock()
+
+	return repo.Replace(l.name, buckets)
+}
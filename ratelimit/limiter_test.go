@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/svuvi/theweek/models"
+)
+
+// rewind сдвигает время последнего обращения к корзине в прошлое, как будто прошло d
+func rewind(l *Limiter, key string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.updated = b.updated.Add(-d)
+	}
+}
+
+// step - попытка в TestLimiterAllow: сколько времени прошло перед ней и ожидаемый результат
+type step struct {
+	wait  time.Duration
+	allow bool
+}
+
+func TestLimiterAllow(t *testing.T) {
+	const interval = time.Minute
+
+	tests := []struct {
+		name     string
+		capacity int
+		steps    []step
+	}{
+		{"ёмкость исчерпана", 3, []step{{0, true}, {0, true}, {0, true}, {0, false}, {0, false}}},
+		{"токен восстанавливается за interval", 2, []step{{0, true}, {0, true}, {0, false}, {interval / 2, false}, {interval / 2, true}, {0, false}}},
+		{"не больше capacity после долгого простоя", 2, []step{{0, true}, {0, true}, {100 * interval, true}, {0, true}, {0, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New("test", tt.capacity, interval)
+			for i, step := range tt.steps {
+				rewind(l, "ip", step.wait)
+				ok, retry := l.Allow("ip")
+				if ok != step.allow {
+					t.Fatalf("попытка %d: Allow = %v, ожидалось %v", i+1, ok, step.allow)
+				}
+				if ok && retry != 0 || !ok && (retry <= 0 || retry > interval) {
+					t.Fatalf("попытка %d: повторить через %v", i+1, retry)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	l := New("test", 1, time.Minute)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("первая попытка a отклонена")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("вторая попытка a разрешена")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("корзина b пострадала от попыток a")
+	}
+
+	l.Reset("a")
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("после Reset попытка отклонена")
+	}
+}
+
+func TestLimiterPrune(t *testing.T) {
+	l := New("test", 2, time.Minute)
+	l.Allow("full")
+	l.Allow("empty")
+	l.Allow("empty")
+	rewind(l, "full", time.Minute)
+
+	l.Prune()
+	if _, ok := l.buckets["full"]; ok {
+		t.Error("восстановившаяся корзина не удалена")
+	}
+	if _, ok := l.buckets["empty"]; !ok {
+		t.Error("неполная корзина удалена")
+	}
+}
+
+type memoryRepo map[string][]*models.RateLimitBucket
+
+func (m memoryRepo) Load(limiter string) ([]*models.RateLimitBucket, error) {
+	return m[limiter], nil
+}
+
+func (m memoryRepo) Replace(limiter string, buckets []*models.RateLimitBucket) error {
+	m[limiter] = buckets
+	return nil
+}
+
+// Перезапуск сервера не сбрасывает ограничения
+func TestLimiterSaveLoad(t *testing.T) {
+	repo := memoryRepo{}
+	l := New("login_ip", 2, time.Minute)
+	l.Allow("1.2.3.4")
+	l.Allow("1.2.3.4")
+	l.Allow("5.6.7.8")
+	rewind(l, "5.6.7.8", time.Hour) // уже восстановилась и не сохраняется
+	if err := l.Save(repo); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo["login_ip"]) != 1 {
+		t.Fatalf("сохранено %d корзин, ожидалась одна", len(repo["login_ip"]))
+	}
+
+	restarted := New("login_ip", 2, time.Minute)
+	if err := restarted.Load(repo); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := restarted.Allow("1.2.3.4"); ok {
+		t.Error("после перезапуска исчерпанная корзина снова полна")
+	}
+	if ok, _ := restarted.Allow("5.6.7.8"); !ok {
+		t.Error("попытка с другого IP отклонена")
+	}
+
+	// Ограничители с другим именем хранятся отдельно
+	other := New("login_username", 2, time.Minute)
+	if err := other.Load(repo); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := other.Allow("1.2.3.4"); !ok {
+		t.Error("корзина загружена в чужой ограничитель")
+	}
+}
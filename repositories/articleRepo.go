@@ -3,6 +3,9 @@ package repositories
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/svuvi/theweek/models"
 )
@@ -17,10 +20,53 @@ func NewArticleRepo(db *sql.DB) *ArticleRepo {
 	}
 }
 
-func (r *ArticleRepo) Create(slug, title, textMD, description string, coverImageID int) error {
-	ciID := IntToNullInt16(coverImageID)
-	_, err := r.db.Exec("INSERT INTO articles(slug, title, textMD, description, cover_image_id) VALUES (?, ?, ?, ?, ?)", slug, title, textMD, description, ciID)
-	return err
+// Логины авторов статьи через разделитель authorsSeparator, основной автор первый
+const articleAuthorsColumn = `(SELECT group_concat(username, char(31)) FROM
+	(SELECT u.username FROM article_authors aa JOIN users u ON u.id = aa.user_id WHERE aa.article_id = articles.id ORDER BY aa.position))`
+
+const authorsSeparator = "\x1f"
+
+// Столбцы статьи в порядке, ожидаемом scanArticle
+const articleColumns = "id, slug, created_at, title, textMD, description, cover_image_id, section_id, status, publish_at, updated_at, " + articleAuthorsColumn
+
+// Столбцы для карточек в ленте: всё, кроме текста статьи
+const articleCardColumns = "id, slug, created_at, title, '', description, cover_image_id, section_id, status, publish_at, updated_at, " + articleAuthorsColumn
+
+// scanArticle читает строку, выбранную через articleColumns или articleCardColumns
+func scanArticle(row interface{ Scan(...any) error }) (*models.Article, error) {
+	a := new(models.Article)
+	var coverImageID, sectionID sql.NullInt16
+	var publishAt sql.NullTime
+	var authors sql.NullString
+
+	err := row.Scan(&a.ID, &a.Slug, &a.CreatedAt, &a.Title, &a.TextMD, &a.Description, &coverImageID, &sectionID, &a.Status, &publishAt, &a.UpdatedAt, &authors)
+
+	a.CoverImageID = NullInt16ToInt(coverImageID)
+	a.SectionID = NullInt16ToInt(sectionID)
+	a.PublishAt = NullTimeToTime(publishAt)
+	if authors.Valid {
+		a.Authors = strings.Split(authors.String, authorsSeparator)
+	}
+
+	return a, err
+}
+
+func createArticle(q querier, a *models.Article) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+	res, err := q.Exec("INSERT INTO articles(slug, created_at, title, textMD, description, cover_image_id, section_id, status, publish_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		a.Slug, a.CreatedAt, a.Title, a.TextMD, a.Description, IntToNullInt16(a.CoverImageID), IntToNullInt16(a.SectionID), a.Status, TimeToNullTime(a.PublishAt))
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("похоже, что эта база данных не поддерживает функцию LastInsertId:\n%s", err.Error())
+	}
+	a.ID = int(id)
+	return nil
 }
 
 func (r *ArticleRepo) SetCoverImage(id int, newCoverImageID int) error {
@@ -37,44 +83,122 @@ func (r *ArticleRepo) SetCoverImage(id int, newCoverImageID int) error {
 }
 
 func (r *ArticleRepo) GetByID(id int) (*models.Article, error) {
-	var a models.Article
-	var coverImageID sql.NullInt16
+	row := r.db.QueryRow("SELECT "+articleColumns+" FROM articles WHERE id=?", id)
+	return scanArticle(row)
+}
 
-	row := r.db.QueryRow("SELECT * FROM articles WHERE id=?", id)
-	err := row.Scan(&a.ID, &a.Slug, &a.CreatedAt, &a.Title, &a.TextMD, &a.Description, &coverImageID)
+func (r *ArticleRepo) GetBySlug(slug string) (*models.Article, error) {
+	row := r.db.QueryRow("SELECT "+articleColumns+" FROM articles WHERE slug=?", slug)
+	return scanArticle(row)
+}
 
-	a.CoverImageID = NullInt16ToInt(coverImageID)
+func (r *ArticleRepo) GetAll() ([]*models.Article, error) {
+	return r.queryArticles("SELECT " + articleColumns + " FROM articles")
+}
 
-	return &a, err
+// publishedFilter возвращает условие WHERE для опубликованных статей рубрики (sectionID = 0 для всех) и его аргументы
+func publishedFilter(sectionID int) (string, []any) {
+	if sectionID == 0 {
+		return "status=?", []any{models.StatusPublished}
+	}
+	return "status=? AND section_id=?", []any{models.StatusPublished, sectionID}
 }
 
-func (r *ArticleRepo) GetBySlug(slug string) (*models.Article, error) {
-	var a models.Article
-	var coverImageID sql.NullInt16
+// Порядок ленты. datetime() приводит даты, записанные драйвером и SQLite, к одному формату
+const feedOrder = " ORDER BY datetime(created_at) DESC, id DESC"
+
+func (r *ArticleRepo) GetLatestPublished(sectionID, limit int) ([]*models.Article, error) {
+	where, args := publishedFilter(sectionID)
+	return r.queryArticles("SELECT "+articleColumns+" FROM articles WHERE "+where+feedOrder+" LIMIT ?", append(args, limit)...)
+}
 
-	row := r.db.QueryRow("SELECT * FROM articles WHERE slug=?", slug)
-	err := row.Scan(&a.ID, &a.Slug, &a.CreatedAt, &a.Title, &a.TextMD, &a.Description, &coverImageID)
+func (r *ArticleRepo) GetPublishedCards(sectionID, offset, limit int) ([]*models.Article, error) {
+	where, args := publishedFilter(sectionID)
+	return r.queryArticles("SELECT "+articleCardColumns+" FROM articles WHERE "+where+feedOrder+" LIMIT ? OFFSET ?", append(args, limit, offset)...)
+}
 
-	a.CoverImageID = NullInt16ToInt(coverImageID)
+func (r *ArticleRepo) GetPublishedCardsBefore(sectionID int, before time.Time, beforeID, limit int) ([]*models.Article, error) {
+	where, args := publishedFilter(sectionID)
+	args = append(args, before.UTC().Format(time.DateTime), beforeID, limit)
+	return r.queryArticles("SELECT "+articleCardColumns+" FROM articles WHERE "+where+" AND (datetime(created_at), id) < (?, ?)"+feedOrder+" LIMIT ?", args...)
+}
 
-	return &a, err
+func (r *ArticleRepo) CountPublished(sectionID int) (int, error) {
+	where, args := publishedFilter(sectionID)
+	var count int
+	err := r.db.QueryRow("SELECT count(*) FROM articles WHERE "+where, args...).Scan(&count)
+	return count, err
 }
 
-func (r *ArticleRepo) GetAll() ([]*models.Article, error) {
-	rows, err := r.db.Query("SELECT * FROM articles")
+func (r *ArticleRepo) GetAllByAuthor(userID int) ([]*models.Article, error) {
+	return r.queryArticles("SELECT "+articleColumns+" FROM articles WHERE id IN (SELECT article_id FROM article_authors WHERE user_id=?)", userID)
+}
+
+func (r *ArticleRepo) GetPublishedByAuthor(userID int) ([]*models.Article, error) {
+	return r.queryArticles("SELECT "+articleCardColumns+" FROM articles WHERE status=? AND id IN (SELECT article_id FROM article_authors WHERE user_id=?)"+feedOrder,
+		models.StatusPublished, userID)
+}
+
+func (r *ArticleRepo) Save(a *models.Article, authorIDs []int, editorID int) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if a.ID == 0 {
+		if err = createArticle(tx, a); err != nil {
+			return err
+		}
+		// После отката статьи в базе нет, и форма не должна ссылаться на её ID
+		defer func() {
+			if err != nil {
+				a.ID = 0
+			}
+		}()
+	} else if err = updateArticle(tx, a); err != nil {
+		return err
+	}
+
+	if authorIDs != nil {
+		if err = setAuthors(tx, a.ID, authorIDs); err != nil {
+			return err
+		}
+	}
+	if _, err = createRevision(tx, a.ID, editorID, a.Title, a.Description, a.TextMD); err != nil {
+		return err
+	}
+	if err = addImageUsages(tx, a.ID, a.TextMD); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setAuthors(q querier, articleID int, userIDs []int) error {
+	if _, err := q.Exec("DELETE FROM article_authors WHERE article_id=$1", articleID); err != nil {
+		return err
+	}
+	for position, userID := range userIDs {
+		if _, err := q.Exec("INSERT INTO article_authors(article_id, user_id, position) VALUES (?, ?, ?)", articleID, userID, position); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ArticleRepo) queryArticles(query string, args ...any) ([]*models.Article, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return []*models.Article{}, err
 	}
 	defer rows.Close()
 
 	var articles []*models.Article
-	var i sql.NullInt16
 	for rows.Next() {
-		a := new(models.Article)
-		if err := rows.Scan(&a.ID, &a.Slug, &a.CreatedAt, &a.Title, &a.TextMD, &a.Description, &i); err != nil {
+		a, err := scanArticle(rows)
+		if err != nil {
 			return articles, err
 		}
-		a.CoverImageID = NullInt16ToInt(i)
 		articles = append(articles, a)
 	}
 	if err := rows.Err(); err != nil {
@@ -83,10 +207,48 @@ func (r *ArticleRepo) GetAll() ([]*models.Article, error) {
 	return articles, nil
 }
 
-func (r *ArticleRepo) Update(a *models.Article) error {
+func (r *ArticleRepo) Search(query string, limit int) ([]*models.ArticleSearchResult, error) {
+	ftsQuery := buildFTSQuery(query)
+	if ftsQuery == "" {
+		return []*models.ArticleSearchResult{}, nil
+	}
+
+	// Веса bm25: заголовок важнее описания, описание важнее текста
+	rows, err := r.db.Query(`SELECT a.id, a.slug, a.created_at, a.title, a.description, a.cover_image_id, a.section_id,
+			highlight(articles_fts, 0, $1, $2),
+			snippet(articles_fts, -1, $1, $2, '…', 24)
+		FROM articles_fts JOIN articles a ON a.id = articles_fts.rowid
+		WHERE articles_fts MATCH $3 AND a.status = $4
+		ORDER BY bm25(articles_fts, 10.0, 4.0, 1.0)
+		LIMIT $5`, models.SearchMarkStart, models.SearchMarkEnd, ftsQuery, models.StatusPublished, limit)
+	if err != nil {
+		return []*models.ArticleSearchResult{}, err
+	}
+	defer rows.Close()
+
+	var results []*models.ArticleSearchResult
+	var i, sID sql.NullInt16
+	for rows.Next() {
+		a := new(models.Article)
+		res := &models.ArticleSearchResult{Article: a}
+		if err := rows.Scan(&a.ID, &a.Slug, &a.CreatedAt, &a.Title, &a.Description, &i, &sID, &res.TitleHighlighted, &res.Snippet); err != nil {
+			return results, err
+		}
+		a.CoverImageID = NullInt16ToInt(i)
+		a.SectionID = NullInt16ToInt(sID)
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+func updateArticle(q querier, a *models.Article) error {
 	i := IntToNullInt16(a.CoverImageID)
-	res, err := r.db.Exec("UPDATE articles SET slug=$1, created_at=$2, title=$3, textMD=$4, description=$5, cover_image_id=$6 WHERE id=$7",
-						a.Slug, a.CreatedAt, a.Title, a.TextMD, a.Description, i, a.ID)
+	sID := IntToNullInt16(a.SectionID)
+	res, err := q.Exec("UPDATE articles SET slug=$1, created_at=$2, title=$3, textMD=$4, description=$5, cover_image_id=$6, section_id=$7, status=$8, publish_at=$9, updated_at=$10 WHERE id=$11",
+		a.Slug, a.CreatedAt, a.Title, a.TextMD, a.Description, i, sID, a.Status, TimeToNullTime(a.PublishAt), time.Now().UTC(), a.ID)
 	if err != nil {
 		return err
 	}
@@ -96,15 +258,101 @@ func (r *ArticleRepo) Update(a *models.Article) error {
 	return nil
 }
 
+func (r *ArticleRepo) FeedState(sectionID int) (time.Time, int, error) {
+	// Время изменения берётся по всем статьям, чтобы снятие с публикации тоже меняло ленту
+	query := "SELECT ifnull(max(datetime(updated_at)), ''), count(*) FILTER (WHERE status=$1) FROM articles"
+	args := []any{models.StatusPublished}
+	if sectionID != 0 {
+		query += " WHERE section_id=$2"
+		args = append(args, sectionID)
+	}
+
+	var lastModified string
+	var count int
+	if err := r.db.QueryRow(query, args...).Scan(&lastModified, &count); err != nil {
+		return time.Time{}, 0, err
+	}
+	if lastModified == "" {
+		return time.Time{}, count, nil
+	}
+
+	t, err := time.Parse(time.DateTime, lastModified)
+	return t, count, err
+}
+
+func (r *ArticleRepo) PublishScheduled(now time.Time) (int, error) {
+	// datetime() приводит время, записанное драйвером и SQLite, к одному формату в UTC
+	res, err := r.db.Exec("UPDATE articles SET status=$1, created_at=datetime(publish_at), updated_at=datetime(publish_at) WHERE status=$2 AND datetime(publish_at) <= datetime($3)",
+		models.StatusPublished, models.StatusScheduled, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	return int(affected), err
+}
+
 func (r *ArticleRepo) Delete(id int) error {
-	res, err := r.db.Exec("DELETE FROM articles WHERE id=$1", id)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM article_revisions WHERE article_id=$1", id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM article_authors WHERE article_id=$1", id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM image_usages WHERE article_id=$1", id); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM articles WHERE id=$1", id)
 	if err != nil {
 		return err
 	}
 	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
 		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
 	}
-	return nil
+	return tx.Commit()
+}
+
+// buildFTSQuery превращает пользовательский ввод в безопасный FTS5 запрос.
+// Каждое слово приводится к основе и ищется как префикс, все слова должны присутствовать.
+// Возвращает пустую строку, если в запросе нет слов
+func buildFTSQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		stem := stemRussian(word)
+		if len([]rune(stem)) < 2 {
+			stem = strings.ToLower(word)
+		}
+		terms = append(terms, fmt.Sprintf(`"%s"*`, stem))
+	}
+	return strings.Join(terms, " ")
+}
+
+// Преобразует time.Time в sql.NullTime
+// Если время нулевое, то выход будет Null
+func TimeToNullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{
+		Time:  t.UTC(),
+		Valid: !t.IsZero(),
+	}
+}
+
+// Преобразует sql.NullTime в time.Time
+// Если значение равно Null, то выход будет нулевым временем
+func NullTimeToTime(nullTime sql.NullTime) time.Time {
+	if !nullTime.Valid {
+		return time.Time{}
+	}
+	return nullTime.Time
 }
 
 // Преобразует int в sql.NullInt16
@@ -0,0 +1,163 @@
+//go:build sqlite_fts5
+
+package repositories
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/svuvi/theweek/models"
+)
+
+func TestArticleRepoSearch(t *testing.T) {
+	repo := NewArticleRepo(openTestDB(t))
+
+	articles := []*models.Article{
+		{Slug: "weather", Title: "Погода на неделю", Description: "Прогноз", TextMD: "Ожидаются дожди и сильный ветер", Status: models.StatusPublished},
+		{Slug: "news", Title: "Новости района", Description: "Коротко о главном", TextMD: "Открылась новая библиотека", Status: models.StatusPublished},
+		{Slug: "draft", Title: "Черновик о погоде", Description: "", TextMD: "Дожди не закончатся", Status: models.StatusDraft},
+	}
+	for _, a := range articles {
+		if err := repo.Save(a, nil, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		{"погода", 10, []string{"weather"}},
+		{"дождями", 10, []string{"weather"}},
+		{"новостях", 10, []string{"news"}},
+		{"библиотеки района", 10, []string{"news"}},
+		{"погода библиотека", 10, nil},
+		{"ветер", 10, []string{"weather"}},
+		{"снег", 10, nil},
+		{"!!!", 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := repo.Search(tt.query, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, r.Article.Slug)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Search(%q) = %v, ожидалось %v", tt.query, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Search(%q) = %v, ожидалось %v", tt.query, got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Совпадения в заголовке подсвечиваются маркерами, лимит соблюдается
+	if err := repo.Save(&models.Article{Slug: "weather-2", Title: "Погода в выходные", TextMD: "Солнце", Status: models.StatusPublished}, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	results, err := repo.Search("погода", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("лимит не соблюдён: %d результатов", len(results))
+	}
+	if want := models.SearchMarkStart + "Погода" + models.SearchMarkEnd; results[0].TitleHighlighted[:len(want)] != want {
+		t.Errorf("заголовок без подсветки: %q", results[0].TitleHighlighted)
+	}
+}
+
+func TestBuildFTSQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"  ,.! ", ""},
+		{"новостями", `"новост"*`},
+		{"Погода", `"погод"*`},
+		{`"; DROP TABLE articles`, `"drop"* "table"* "articles"*`},
+		{"2024", `"2024"*`},
+	}
+	for _, tt := range tests {
+		if got := buildFTSQuery(tt.query); got != tt.want {
+			t.Errorf("buildFTSQuery(%q) = %s, ожидалось %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestArticleRepoSave(t *testing.T) {
+	conn := openTestDB(t)
+	repo := NewArticleRepo(conn)
+	userRepo := NewUserRepo(conn)
+	anna, _ := userRepo.Create("anna", "hash-anna")
+	boris, _ := userRepo.Create("boris", "hash-boris")
+
+	a := &models.Article{Slug: "first", Title: "Первая", TextMD: "Текст", Status: models.StatusDraft}
+	if err := repo.Save(a, []int{anna.ID, boris.ID}, anna.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkAuthors := func(id int, want ...string) {
+		t.Helper()
+		got, err := repo.GetByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got.Authors, ",") != strings.Join(want, ",") {
+			t.Errorf("авторы %v, ожидались %v", got.Authors, want)
+		}
+	}
+	checkAuthors(a.ID, "anna", "boris")
+
+	// Без списка авторов они не меняются
+	a.Title = "Первая, исправленная"
+	if err := repo.Save(a, nil, boris.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkAuthors(a.ID, "anna", "boris")
+
+	// Ошибка в статье не меняет ни статью, ни авторов
+	second := &models.Article{Slug: "second", Title: "Вторая", TextMD: "Текст", Status: models.StatusDraft}
+	if err := repo.Save(second, []int{boris.ID}, boris.ID); err != nil {
+		t.Fatal(err)
+	}
+	second.Slug = "first"
+	if err := repo.Save(second, []int{anna.ID}, anna.ID); err == nil {
+		t.Fatal("сохранена статья с занятой ссылкой")
+	}
+	checkAuthors(second.ID, "boris")
+
+	// Новая статья с ошибкой не остаётся в базе без авторов
+	duplicate := &models.Article{Slug: "first", Title: "Копия", TextMD: "Текст", Status: models.StatusDraft}
+	if err := repo.Save(duplicate, []int{anna.ID}, anna.ID); err == nil {
+		t.Fatal("сохранена статья с занятой ссылкой")
+	}
+	if duplicate.ID != 0 {
+		t.Errorf("ID несохранённой статьи %d", duplicate.ID)
+	}
+	var orphans int
+	err := conn.QueryRow(`SELECT COUNT(*) FROM articles WHERE id NOT IN (SELECT article_id FROM article_authors)`).Scan(&orphans)
+	if err != nil || orphans != 0 {
+		t.Errorf("статей без авторов: %d, ошибка %v", orphans, err)
+	}
+
+	// Каждое успешное сохранение - ревизия от имени редактора, неудачные ревизий не оставляют
+	revisions, err := NewRevisionRepo(conn).GetByArticle(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].EditorID != boris.ID || revisions[0].Title != "Первая, исправленная" || revisions[1].EditorID != anna.ID {
+		t.Errorf("ревизии первой статьи: %+v", revisions)
+	}
+	var total int
+	if err = conn.QueryRow(`SELECT COUNT(*) FROM article_revisions`).Scan(&total); err != nil || total != 3 {
+		t.Errorf("всего ревизий %d, ожидалось 3 (ошибка %v)", total, err)
+	}
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/svuvi/theweek/models"
+)
+
+type AuditRepo struct {
+	db *sql.DB
+}
+
+func NewAuditRepo(db *sql.DB) *AuditRepo {
+	return &AuditRepo{
+		db: db,
+	}
+}
+
+func (r *AuditRepo) Create(userID int, event models.AuditEvent, details, ip string) error {
+	_, err := r.db.Exec("INSERT INTO audit_log(user_id, event, details, ip) VALUES (?, ?, ?, ?)",
+		IntToNullInt16(userID), event, details, ip)
+	return err
+}
+
+func (r *AuditRepo) GetRecent(limit int) ([]*models.AuditEntry, error) {
+	rows, err := r.db.Query(`SELECT a.id, a.created_at, a.user_id, u.username, a.event, a.details, a.ip
+		FROM audit_log a LEFT JOIN users u ON u.id = a.user_id
+		ORDER BY a.id DESC LIMIT ?`, limit)
+	if err != nil {
+		return []*models.AuditEntry{}, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		e := new(models.AuditEntry)
+		var userID sql.NullInt16
+		var username sql.NullString
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &userID, &username, &e.Event, &e.Details, &e.IP); err != nil {
+			return entries, err
+		}
+		e.UserID = NullInt16ToInt(userID)
+		e.Username = username.String
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+)
+
+type BackupCodeRepo struct {
+	db *sql.DB
+}
+
+func NewBackupCodeRepo(db *sql.DB) *BackupCodeRepo {
+	return &BackupCodeRepo{
+		db: db,
+	}
+}
+
+func (r *BackupCodeRepo) Replace(userID int, codes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM totp_backup_codes WHERE user_id=?", userID); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if _, err = tx.Exec("INSERT INTO totp_backup_codes(user_id, code_hash) VALUES (?, ?)", userID, sha3Hash(code)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *BackupCodeRepo) Use(userID int, code string) (bool, error) {
+	res, err := r.db.Exec("UPDATE totp_backup_codes SET used_at=$1 WHERE user_id=$2 AND code_hash=$3 AND used_at IS NULL",
+		time.Now().UTC(), userID, sha3Hash(code))
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *BackupCodeRepo) CountUnused(userID int) (int, error) {
+	var n int
+	err := r.db.QueryRow("SELECT count(*) FROM totp_backup_codes WHERE user_id=? AND used_at IS NULL", userID).Scan(&n)
+	return n, err
+}
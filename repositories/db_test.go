@@ -0,0 +1,22 @@
+//go:build sqlite_fts5
+
+package repositories
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/svuvi/theweek/db"
+)
+
+// openTestDB создаёт во временной папке базу со всеми миграциями
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn := db.ConnectDB(filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(func() { conn.Close() })
+	if _, err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
@@ -1,24 +1,77 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"sync"
 
+	"github.com/svuvi/theweek/blobstore"
 	"github.com/svuvi/theweek/models"
 )
 
+// ImageRepo хранит описание картинок в базе, а их содержимое - в blobs
 type ImageRepo struct {
-	db *sql.DB
+	db    *sql.DB
+	blobs blobstore.Store
+	// Одинаковые загрузки делят один файл. mu не даёт удалить файл без ссылок в тот момент,
+	// когда другая загрузка его уже записала, но ещё не сослалась на него
+	mu sync.Mutex
 }
 
-func NewImageRepo(db *sql.DB) *ImageRepo {
+func NewImageRepo(db *sql.DB, blobs blobstore.Store) *ImageRepo {
 	return &ImageRepo{
-		db: db,
+		db:    db,
+		blobs: blobs,
 	}
 }
 
-func (r *ImageRepo) Create(filename string, uploadedBy int, content []byte) (int, error) {
-	res, err := r.db.Exec("INSERT INTO images(filename, uploaded_by, content) VALUES (?, ?, ?)", filename, uploadedBy, content)
+// Столбцы для scanImage
+const imageColumns = "id, filename, uploaded_by, uploaded_at, mime_type, width, height, size, blob_key"
+
+func scanImage(row *sql.Row) (*models.Image, error) {
+	var i models.Image
+	err := row.Scan(&i.ID, &i.Filename, &i.UploadedBy, &i.UploadedAt, &i.MimeType, &i.Width, &i.Height, &i.Size, &i.BlobKey)
+	return &i, err
+}
+
+// putContent сохраняет содержимое картинки и копий в хранилище и заполняет их BlobKey и Size.
+// Файлы пишутся до транзакции: если запись в базу не удастся, в хранилище останутся лишь файлы без ссылок
+func (r *ImageRepo) putContent(img *models.Image, renditions []*models.ImageRendition) error {
+	var err error
+	if img.BlobKey, err = r.blobs.Put(context.Background(), img.Content, img.MimeType); err != nil {
+		return fmt.Errorf("не удалось сохранить файл в хранилище:\n%w", err)
+	}
+	img.Size = len(img.Content)
+	for _, rd := range renditions {
+		if rd.BlobKey, err = r.blobs.Put(context.Background(), rd.Content, rd.MimeType); err != nil {
+			return fmt.Errorf("не удалось сохранить файл в хранилище:\n%w", err)
+		}
+		rd.Size = len(rd.Content)
+	}
+	return nil
+}
+
+func (r *ImageRepo) Create(img *models.Image, renditions []*models.ImageRendition) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.putContent(img, renditions); err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO images(filename, uploaded_by, mime_type, width, height, size, blob_key) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		img.Filename, img.UploadedBy, img.MimeType, img.Width, img.Height, img.Size, img.BlobKey)
 	if err != nil {
 		return 0, err
 	}
@@ -27,16 +80,41 @@ func (r *ImageRepo) Create(filename string, uploadedBy int, content []byte) (int
 	if err != nil {
 		return 0, fmt.Errorf("похоже, что эта база данных не поддерживает функцию LastInsertId:\n%s", err.Error())
 	}
-	return int(id), nil
+	if err = insertRenditions(tx, int(id), renditions); err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+func insertRenditions(tx *sql.Tx, imageID int, renditions []*models.ImageRendition) error {
+	for _, rd := range renditions {
+		_, err := tx.Exec("INSERT INTO image_renditions(image_id, width, height, mime_type, size, blob_key) VALUES (?, ?, ?, ?, ?, ?)",
+			imageID, rd.Width, rd.Height, rd.MimeType, rd.Size, rd.BlobKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *ImageRepo) Get(id int) (*models.Image, error) {
-	var i models.Image
+	i, err := r.GetMeta(id)
+	if err != nil {
+		return i, err
+	}
+
+	f, err := r.blobs.Open(context.Background(), i.BlobKey)
+	if err != nil {
+		return i, fmt.Errorf("не удалось открыть файл картинки %d:\n%w", id, err)
+	}
+	defer f.Close()
+	i.Content, err = io.ReadAll(f)
 
-	row := r.db.QueryRow("SELECT * FROM images WHERE id=?", id)
-	err := row.Scan(&i.ID, &i.Filename, &i.UploadedBy, &i.UploadedAt, &i.Content)
+	return i, err
+}
 
-	return &i, err
+func (r *ImageRepo) GetMeta(id int) (*models.Image, error) {
+	return scanImage(r.db.QueryRow("SELECT "+imageColumns+" FROM images WHERE id=?", id))
 }
 
 func (r *ImageRepo) GetName(id int) (string, error) {
@@ -54,20 +132,205 @@ func (r *ImageRepo) GetName(id int) (string, error) {
 	return s, err
 }
 
-func (r *ImageRepo) ChangeFilename(id int, newFilename string) error {
-	res, err := r.db.Exec("UPDATE images SET file_name=$1 WHERE id=$2", newFilename, id)
+func (r *ImageRepo) GetRenditions(imageID int) ([]*models.ImageRendition, error) {
+	rows, err := r.db.Query("SELECT image_id, width, height, mime_type, size, blob_key FROM image_renditions WHERE image_id=? ORDER BY width, mime_type", imageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var renditions []*models.ImageRendition
+	for rows.Next() {
+		var rd models.ImageRendition
+		if err = rows.Scan(&rd.ImageID, &rd.Width, &rd.Height, &rd.MimeType, &rd.Size, &rd.BlobKey); err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, &rd)
+	}
+	return renditions, rows.Err()
+}
+
+func (r *ImageRepo) OpenContent(ctx context.Context, blobKey string) (io.ReadSeekCloser, error) {
+	return r.blobs.Open(ctx, blobKey)
+}
+
+func (r *ImageRepo) ListUnprocessed() ([]int, error) {
+	rows, err := r.db.Query("SELECT id FROM images WHERE width=0 ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
 
+func (r *ImageRepo) Replace(img *models.Image, renditions []*models.ImageRendition) error {
+	old, err := r.blobKeys(img.ID)
 	if err != nil {
 		return err
 	}
-	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
-		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err = r.putContent(img, renditions); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE images SET mime_type=?, width=?, height=?, size=?, blob_key=? WHERE id=?",
+		img.MimeType, img.Width, img.Height, img.Size, img.BlobKey, img.ID)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM image_renditions WHERE image_id=?", img.ID); err != nil {
+		return err
+	}
+	if err = insertRenditions(tx, img.ID, renditions); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	r.deleteUnreferenced(old)
+	return nil
+}
+
+func (r *ImageRepo) MoveContentToStore() (int, error) {
+	moved := 0
+	for _, table := range []string{"images", "image_renditions"} {
+		for {
+			var rowID int64
+			var mimeType string
+			var content []byte
+			err := r.db.QueryRow("SELECT rowid, mime_type, content FROM "+table+" WHERE blob_key='' AND content IS NOT NULL LIMIT 1").
+				Scan(&rowID, &mimeType, &content)
+			if err == sql.ErrNoRows {
+				break
+			}
+			if err != nil {
+				return moved, err
+			}
+
+			key, err := r.blobs.Put(context.Background(), content, mimeType)
+			if err != nil {
+				return moved, fmt.Errorf("не удалось сохранить файл в хранилище:\n%w", err)
+			}
+			_, err = r.db.Exec("UPDATE "+table+" SET blob_key=?, size=?, content=NULL WHERE rowid=?", key, len(content), rowID)
+			if err != nil {
+				return moved, err
+			}
+			moved++
+		}
+	}
+
+	// Освобождаем место, которое занимало содержимое
+	if moved > 0 {
+		if _, err := r.db.Exec("VACUUM"); err != nil {
+			log.Print("Не удалось сжать базу данных после переноса картинок:\n", err)
+		}
+	}
+	return moved, nil
+}
+
+// imageUsagesColumn считает использования картинки i.id: статьи, где она стоит на обложке или встречается
+// в тексте текущей версии либо одной из ревизий, и пользователей, у которых она на аватаре.
+// Статья считается один раз, сколько бы ссылок в ней ни было. Ревизии учитываются, чтобы восстановление
+// старой версии не вернуло в текст ссылку на удалённую картинку. Все подзапросы идут по индексам
+const imageUsagesColumn = `(SELECT COUNT(*) FROM (
+		SELECT id FROM articles WHERE cover_image_id = i.id
+		UNION SELECT article_id FROM image_usages WHERE image_id = i.id))
+	+ (SELECT COUNT(*) FROM users WHERE avatar_image_id = i.id)`
+
+func (r *ImageRepo) List() ([]*models.LibraryImage, error) {
+	rows, err := r.db.Query(`SELECT i.id, i.filename, i.uploaded_by, i.uploaded_at, i.mime_type, i.width, i.height, i.size, i.blob_key,
+			IFNULL(u.username, ''), ` + imageUsagesColumn + `
+		FROM images i LEFT JOIN users u ON u.id = i.uploaded_by ORDER BY i.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*models.LibraryImage
+	for rows.Next() {
+		var i models.LibraryImage
+		err = rows.Scan(&i.ID, &i.Filename, &i.UploadedBy, &i.UploadedAt, &i.MimeType, &i.Width, &i.Height, &i.Size, &i.BlobKey, &i.Uploader, &i.Usages)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, &i)
+	}
+	return images, rows.Err()
+}
+
+func (r *ImageRepo) ListMeta() ([]*models.Image, error) {
+	rows, err := r.db.Query("SELECT id, filename, width, height FROM images ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*models.Image
+	for rows.Next() {
+		var i models.Image
+		if err = rows.Scan(&i.ID, &i.Filename, &i.Width, &i.Height); err != nil {
+			return nil, err
+		}
+		images = append(images, &i)
+	}
+	return images, rows.Err()
+}
+
+func (r *ImageRepo) Usages(id int) (int, error) {
+	return countUsages(r.db, id)
+}
+
+func countUsages(q querier, id int) (int, error) {
+	var usages int
+	err := q.QueryRow("SELECT "+imageUsagesColumn+" FROM images i WHERE i.id=?", id).Scan(&usages)
+	return usages, err
+}
+
+// Ссылка на картинку в Markdown тексте статьи: /images/12, /images/12?w=640 или полный адрес
+var imageLinkRegexp = regexp.MustCompile(`/images/(\d+)`)
+
+// addImageUsages отмечает картинки, на которые ссылается textMD, как используемые статьёй.
+// Строки только добавляются: ссылка остаётся в ревизии, даже если из текущего текста её убрали
+func addImageUsages(q querier, articleID int, textMD string) error {
+	for _, m := range imageLinkRegexp.FindAllStringSubmatch(textMD, -1) {
+		id, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		if _, err = q.Exec("INSERT OR IGNORE INTO image_usages(image_id, article_id) VALUES (?, ?)", id, articleID); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (r *ImageRepo) Delete(id int) error {
-	res, err := r.db.Exec("DELETE FROM images WHERE id=$1", id)
+// querier - *sql.DB или *sql.Tx
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func (r *ImageRepo) ChangeFilename(id int, newFilename string) error {
+	res, err := r.db.Exec("UPDATE images SET filename=$1 WHERE id=$2", newFilename, id)
+
 	if err != nil {
 		return err
 	}
@@ -76,3 +339,83 @@ func (r *ImageRepo) Delete(id int) error {
 	}
 	return nil
 }
+
+func (r *ImageRepo) DeleteUnused(id int) (int, error) {
+	keys, err := r.blobKeys(id)
+	if err != nil {
+		return 0, err
+	}
+
+	// Подсчёт и удаление в одной транзакции: статья, сохранённая между ними со ссылкой на картинку,
+	// либо попадёт в подсчёт, либо транзакция не сможет завершиться
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	usages, err := countUsages(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	if usages > 0 {
+		return usages, nil
+	}
+
+	// Внешние ключи в SQLite по умолчанию не проверяются, поэтому копии удаляются явно
+	if _, err = tx.Exec("DELETE FROM image_renditions WHERE image_id=$1", id); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec("DELETE FROM images WHERE id=$1", id)
+	if err != nil {
+		return 0, err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return 0, fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleteUnreferenced(keys)
+	return 0, nil
+}
+
+// blobKeys возвращает ключи содержимого картинки и всех её копий
+func (r *ImageRepo) blobKeys(id int) ([]string, error) {
+	rows, err := r.db.Query("SELECT blob_key FROM images WHERE id=$1 UNION SELECT blob_key FROM image_renditions WHERE image_id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, rows.Err()
+}
+
+// deleteUnreferenced удаляет из хранилища файлы, на которые больше не ссылается ни одна строка.
+// Одинаковые загрузки делят один файл, поэтому удалять файл вместе с картинкой нельзя.
+// Вызывается под r.mu. Ошибки только записываются в журнал: оставшийся файл ничему не мешает
+func (r *ImageRepo) deleteUnreferenced(keys []string) {
+	for _, key := range keys {
+		var refs int
+		err := r.db.QueryRow("SELECT (SELECT COUNT(*) FROM images WHERE blob_key=$1) + (SELECT COUNT(*) FROM image_renditions WHERE blob_key=$1)", key).Scan(&refs)
+		if err != nil || refs > 0 {
+			continue
+		}
+		if err = r.blobs.Delete(context.Background(), key); err != nil {
+			log.Printf("Не удалось удалить файл %s из хранилища:\n%v", key, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+//go:build sqlite_fts5
+
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"testing"
+
+	"github.com/svuvi/theweek/blobstore"
+	"github.com/svuvi/theweek/models"
+)
+
+// Картинки из прошлых версий хранят содержимое в базе, при запуске оно переезжает в хранилище
+func TestImageRepoMoveContentToStore(t *testing.T) {
+	conn := openTestDB(t)
+	blobs := blobstore.NewLocal(t.TempDir())
+	repo := NewImageRepo(conn, blobs)
+
+	original := []byte("оригинал")
+	rendition := []byte("уменьшенная копия")
+	_, err := conn.Exec(`INSERT INTO images (id, filename, uploaded_by, content, mime_type) VALUES (1, 'a.png', 1, ?, 'image/png');
+		INSERT INTO image_renditions (image_id, width, height, mime_type, content) VALUES (1, 320, 200, 'image/webp', ?)`, original, rendition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := repo.MoveContentToStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 2 {
+		t.Errorf("перенесено %d файлов, ожидалось 2", moved)
+	}
+
+	for table, content := range map[string][]byte{"images": original, "image_renditions": rendition} {
+		var key string
+		var size int
+		var left int
+		err = conn.QueryRow("SELECT blob_key, size, content IS NOT NULL FROM "+table).Scan(&key, &size, &left)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != blobstore.Key(content) || size != len(content) || left != 0 {
+			t.Errorf("%s: blob_key %q, size %d, content остался: %v", table, key, size, left == 1)
+			continue
+		}
+
+		f, err := repo.OpenContent(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, _ := io.ReadAll(f)
+		f.Close()
+		if string(stored) != string(content) {
+			t.Errorf("%s: в хранилище %q, ожидалось %q", table, stored, content)
+		}
+	}
+
+	// Повторный запуск ничего не переносит
+	if moved, err = repo.MoveContentToStore(); err != nil || moved != 0 {
+		t.Errorf("повторный перенос: %d файлов, ошибка %v", moved, err)
+	}
+}
+
+func TestImageRepoUsagesAndDeleteUnused(t *testing.T) {
+	conn := openTestDB(t)
+	repo := NewImageRepo(conn, blobstore.NewLocal(t.TempDir()))
+	articleRepo := NewArticleRepo(conn)
+
+	// 1 - обложка, 2 - в тексте дважды, 3 - только в прошлой ревизии, 4 - аватар, 5 - нигде
+	_, err := conn.Exec(`INSERT INTO users (id, username, hashed_password) VALUES (1, 'editor', 'hash');
+		INSERT INTO images (id, filename, uploaded_by, mime_type) VALUES
+			(1, '1.png', 1, 'image/png'), (2, '2.png', 1, 'image/png'), (3, '3.png', 1, 'image/png'),
+			(4, '4.png', 1, 'image/png'), (5, '5.png', 1, 'image/png');
+		UPDATE users SET avatar_image_id = 4 WHERE id = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	articles := map[string]*models.Article{
+		"a": {Slug: "a", Title: "A", Status: models.StatusPublished, CoverImageID: 1},
+		"b": {Slug: "b", Title: "B", Status: models.StatusPublished},
+	}
+	edits := []struct {
+		slug   string
+		textMD string
+	}{
+		{"a", "![](/images/3)"},
+		{"b", "![](/images/3) ![](/images/2)"},
+		{"a", "![](/images/2) и ещё раз ![](/images/2?w=640)"},
+		{"b", "https://example.com/images/2 и /images/ без номера"},
+	}
+	for _, e := range edits {
+		a := articles[e.slug]
+		a.TextMD = e.textMD
+		if err = articleRepo.Save(a, nil, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[int]int{1: 1, 2: 2, 3: 2, 4: 1, 5: 0}
+	for id, n := range want {
+		got, err := repo.Usages(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != n {
+			t.Errorf("Usages(%d) = %d, ожидалось %d", id, got, n)
+		}
+	}
+
+	list, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, img := range list {
+		if img.Usages != want[img.ID] || img.Uploader != "editor" {
+			t.Errorf("List: картинка %d, использований %d, загрузил %q", img.ID, img.Usages, img.Uploader)
+		}
+	}
+
+	// После удаления статьи её картинки, кроме обложки, используются только в b
+	if err = articleRepo.Delete(articles["a"].ID); err != nil {
+		t.Fatal(err)
+	}
+	want[1], want[2], want[3] = 0, 1, 1
+
+	for id, n := range want {
+		usages, err := repo.DeleteUnused(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, getErr := repo.GetMeta(id)
+		deleted := getErr == sql.ErrNoRows
+		if usages != n || deleted != (n == 0) {
+			t.Errorf("DeleteUnused(%d): использований %d, удалена %v", id, usages, deleted)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/svuvi/theweek/models"
+)
+
+type PasskeyRepo struct {
+	db *sql.DB
+}
+
+func NewPasskeyRepo(db *sql.DB) *PasskeyRepo {
+	return &PasskeyRepo{
+		db: db,
+	}
+}
+
+const passkeyColumns = "id, user_id, credential_id, public_key, sign_count, name, created_at, last_used"
+
+func scanPasskey(row interface{ Scan(...any) error }) (*models.Passkey, error) {
+	p := new(models.Passkey)
+	var lastUsed sql.NullTime
+	err := row.Scan(&p.ID, &p.UserID, &p.CredentialID, &p.PublicKey, &p.SignCount, &p.Name, &p.CreatedAt, &lastUsed)
+	p.LastUsed = NullTimeToTime(lastUsed)
+	return p, err
+}
+
+func (r *PasskeyRepo) Create(userID int, credentialID, publicKey []byte, signCount uint32, name string) (*models.Passkey, error) {
+	now := time.Now().UTC()
+	res, err := r.db.Exec("INSERT INTO passkeys(user_id, credential_id, public_key, sign_count, name, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, credentialID, publicKey, signCount, name, now)
+	if err != nil {
+		return &models.Passkey{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return &models.Passkey{}, fmt.Errorf("похоже, что эта база данных не поддерживает функцию LastInsertId:\n%s", err.Error())
+	}
+	return &models.Passkey{
+		ID:           int(id),
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    publicKey,
+		SignCount:    signCount,
+		Name:         name,
+		CreatedAt:    now,
+	}, nil
+}
+
+func (r *PasskeyRepo) GetByCredentialID(credentialID []byte) (*models.Passkey, error) {
+	return scanPasskey(r.db.QueryRow("SELECT "+passkeyColumns+" FROM passkeys WHERE credential_id=?", credentialID))
+}
+
+func (r *PasskeyRepo) GetByUser(userID int) ([]*models.Passkey, error) {
+	rows, err := r.db.Query("SELECT "+passkeyColumns+" FROM passkeys WHERE user_id=? ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []*models.Passkey
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+func (r *PasskeyRepo) UpdateSignCount(id int, signCount uint32) error {
+	res, err := r.db.Exec("UPDATE passkeys SET sign_count=$1, last_used=$2 WHERE id=$3", signCount, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
+
+func (r *PasskeyRepo) Delete(id, userID int) error {
+	res, err := r.db.Exec("DELETE FROM passkeys WHERE id=$1 AND user_id=$2", id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/svuvi/theweek/models"
+)
+
+type PreSessionRepo struct {
+	db *sql.DB
+}
+
+func NewPreSessionRepo(db *sql.DB) *PreSessionRepo {
+	return &PreSessionRepo{
+		db: db,
+	}
+}
+
+func (r *PreSessionRepo) Create(purpose string, userID int, key string, challenge []byte, lifetime time.Duration) (*models.PreSession, error) {
+	now := time.Now().UTC()
+	if _, err := r.db.Exec("DELETE FROM pre_sessions WHERE expires_at < ?", now); err != nil {
+		return &models.PreSession{}, err
+	}
+
+	res, err := r.db.Exec("INSERT INTO pre_sessions(purpose, user_id, key_hash, challenge, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		purpose, IntToNullInt16(userID), sha3Hash(key), challenge, now, now.Add(lifetime))
+	if err != nil {
+		return &models.PreSession{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return &models.PreSession{}, fmt.Errorf("похоже, что эта база данных не поддерживает функцию LastInsertId:\n%s", err.Error())
+	}
+	return &models.PreSession{
+		ID:        int(id),
+		Purpose:   purpose,
+		UserID:    userID,
+		Challenge: challenge,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+	}, nil
+}
+
+func (r *PreSessionRepo) GetByKey(key string) (*models.PreSession, error) {
+	p := new(models.PreSession)
+	var userID sql.NullInt16
+	row := r.db.QueryRow("SELECT id, purpose, user_id, challenge, created_at, expires_at FROM pre_sessions WHERE key_hash=?", sha3Hash(key))
+	err := row.Scan(&p.ID, &p.Purpose, &userID, &p.Challenge, &p.CreatedAt, &p.ExpiresAt)
+	p.UserID = NullInt16ToInt(userID)
+	return p, err
+}
+
+func (r *PreSessionRepo) Delete(id int) error {
+	_, err := r.db.Exec("DELETE FROM pre_sessions WHERE id=?", id)
+	return err
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/svuvi/theweek/models"
+)
+
+type RateLimitRepo struct {
+	db *sql.DB
+}
+
+func NewRateLimitRepo(db *sql.DB) *RateLimitRepo {
+	return &RateLimitRepo{
+		db: db,
+	}
+}
+
+func (r *RateLimitRepo) Load(limiter string) ([]*models.RateLimitBucket, error) {
+	rows, err := r.db.Query("SELECT key, tokens, updated_at FROM rate_limit_buckets WHERE limiter=?", limiter)
+	if err != nil {
+		return []*models.RateLimitBucket{}, err
+	}
+	defer rows.Close()
+
+	var buckets []*models.RateLimitBucket
+	for rows.Next() {
+		b := new(models.RateLimitBucket)
+		if err := rows.Scan(&b.Key, &b.Tokens, &b.UpdatedAt); err != nil {
+			return buckets, err
+		}
+		buckets = append(buckets, b)
+	}
+	if err = rows.Err(); err != nil {
+		return buckets, err
+	}
+	return buckets, nil
+}
+
+func (r *RateLimitRepo) Replace(limiter string, buckets []*models.RateLimitBucket) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM rate_limit_buckets WHERE limiter=?", limiter); err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		if _, err = tx.Exec("INSERT INTO rate_limit_buckets(limiter, key, tokens, updated_at) VALUES (?, ?, ?, ?)",
+			limiter, b.Key, b.Tokens, b.UpdatedAt.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/svuvi/theweek/models"
+)
+
+type RevisionRepo struct {
+	db *sql.DB
+}
+
+func NewRevisionRepo(db *sql.DB) *RevisionRepo {
+	return &RevisionRepo{
+		db: db,
+	}
+}
+
+const revisionSelect = `SELECT r.id, r.article_id, r.editor_id, u.username, r.created_at, r.title, r.description, r.textMD
+	FROM article_revisions r LEFT JOIN users u ON u.id = r.editor_id`
+
+func scanRevision(row interface{ Scan(...any) error }) (*models.ArticleRevision, error) {
+	rev := new(models.ArticleRevision)
+	var editorID sql.NullInt16
+	var username sql.NullString
+
+	err := row.Scan(&rev.ID, &rev.ArticleID, &editorID, &username, &rev.CreatedAt, &rev.Title, &rev.Description, &rev.TextMD)
+
+	rev.EditorID = NullInt16ToInt(editorID)
+	rev.EditorUsername = username.String
+
+	return rev, err
+}
+
+// createRevision записывает ревизию и возвращает её ID. Ревизии создаёт только ArticleRepo.Save
+// в одной транзакции с изменением статьи
+func createRevision(q querier, articleID, editorID int, title, description, textMD string) (int, error) {
+	res, err := q.Exec("INSERT INTO article_revisions(article_id, editor_id, title, description, textMD) VALUES (?, ?, ?, ?, ?)",
+		articleID, IntToNullInt16(editorID), title, description, textMD)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("похоже, что эта база данных не поддерживает функцию LastInsertId:\n%s", err.Error())
+	}
+	return int(id), nil
+}
+
+func (r *RevisionRepo) GetByID(id int) (*models.ArticleRevision, error) {
+	row := r.db.QueryRow(revisionSelect+" WHERE r.id=?", id)
+	return scanRevision(row)
+}
+
+func (r *RevisionRepo) GetByArticle(articleID int) ([]*models.ArticleRevision, error) {
+	rows, err := r.db.Query(revisionSelect+" WHERE r.article_id=? ORDER BY r.id DESC", articleID)
+	if err != nil {
+		return []*models.ArticleRevision{}, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.ArticleRevision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return revisions, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return revisions, err
+	}
+	return revisions, nil
+}
@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/svuvi/theweek/models"
+)
+
+type SectionRepo struct {
+	db *sql.DB
+}
+
+func NewSectionRepo(db *sql.DB) *SectionRepo {
+	return &SectionRepo{
+		db: db,
+	}
+}
+
+func (r *SectionRepo) Create(slug, name string, inNavTop, inNavBottom bool, position int) (*models.Section, error) {
+	res, err := r.db.Exec("INSERT INTO sections(slug, name, in_nav_top, in_nav_bottom, position, updated_at) VALUES (?, ?, ?, ?, ?, ?)", slug, name, inNavTop, inNavBottom, position, time.Now().UTC())
+	if err != nil {
+		return &models.Section{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return &models.Section{}, fmt.Errorf("похоже, что эта база данных не поддерживает функцию LastInsertId:\n%s", err.Error())
+	}
+	return r.GetByID(int(id))
+}
+
+func (r *SectionRepo) GetByID(id int) (*models.Section, error) {
+	var s models.Section
+
+	row := r.db.QueryRow("SELECT id, slug, name, in_nav_top, in_nav_bottom, position, updated_at FROM sections WHERE id=?", id)
+	err := row.Scan(&s.ID, &s.Slug, &s.Name, &s.InNavTop, &s.InNavBottom, &s.Position, &s.UpdatedAt)
+
+	return &s, err
+}
+
+func (r *SectionRepo) GetBySlug(slug string) (*models.Section, error) {
+	var s models.Section
+
+	row := r.db.QueryRow("SELECT id, slug, name, in_nav_top, in_nav_bottom, position, updated_at FROM sections WHERE slug=?", slug)
+	err := row.Scan(&s.ID, &s.Slug, &s.Name, &s.InNavTop, &s.InNavBottom, &s.Position, &s.UpdatedAt)
+
+	return &s, err
+}
+
+func (r *SectionRepo) GetAll() ([]*models.Section, error) {
+	rows, err := r.db.Query("SELECT id, slug, name, in_nav_top, in_nav_bottom, position, updated_at FROM sections ORDER BY position, id")
+	if err != nil {
+		return []*models.Section{}, err
+	}
+	defer rows.Close()
+
+	var sections []*models.Section
+	for rows.Next() {
+		s := new(models.Section)
+		if err := rows.Scan(&s.ID, &s.Slug, &s.Name, &s.InNavTop, &s.InNavBottom, &s.Position, &s.UpdatedAt); err != nil {
+			return sections, err
+		}
+		sections = append(sections, s)
+	}
+	if err := rows.Err(); err != nil {
+		return sections, err
+	}
+	return sections, nil
+}
+
+func (r *SectionRepo) Update(s *models.Section) error {
+	res, err := r.db.Exec("UPDATE sections SET slug=$1, name=$2, in_nav_top=$3, in_nav_bottom=$4, position=$5, updated_at=$6 WHERE id=$7",
+		s.Slug, s.Name, s.InNavTop, s.InNavBottom, s.Position, time.Now().UTC(), s.ID)
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
+
+func (r *SectionRepo) Delete(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("UPDATE articles SET section_id=NULL WHERE section_id=$1", id); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM sections WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,47 @@
+//go:build sqlite_fts5
+
+package repositories
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSectionRepoUpdatedAt(t *testing.T) {
+	repo := NewSectionRepo(openTestDB(t))
+
+	before := time.Now().Add(-time.Second)
+	s, err := repo.Create("test", "Тест", false, false, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.UpdatedAt.Before(before) {
+		t.Errorf("время изменения новой рубрики %v", s.UpdatedAt)
+	}
+
+	// Время хранится с точностью до долей секунды, но ждём, чтобы изменение было заметно и в Unix-секундах
+	created := s.UpdatedAt
+	time.Sleep(1100 * time.Millisecond)
+	s.Name = "Новое название"
+	if err = repo.Update(s); err != nil {
+		t.Fatal(err)
+	}
+	s, err = repo.GetBySlug("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "Новое название" || s.UpdatedAt.Unix() <= created.Unix() {
+		t.Errorf("после изменения: %q, время %v, было %v", s.Name, s.UpdatedAt, created)
+	}
+
+	// Рубрики из миграций получают время миграции
+	all, err := repo.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range all {
+		if s.UpdatedAt.Year() < 2000 {
+			t.Errorf("рубрика %s без времени изменения: %v", s.Slug, s.UpdatedAt)
+		}
+	}
+}
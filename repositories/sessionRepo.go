@@ -19,8 +19,18 @@ func NewSessionRepo(db *sql.DB) *SessionRepo {
 	}
 }
 
-func (r *SessionRepo) Create(userID int, sessionKey string) (*models.Session, error) {
-	res, err := r.db.Exec("INSERT INTO sessions(user_id, session_key_hash) VALUES (?, ?)", userID, sha3Hash(sessionKey))
+// Столбцы сессии в порядке, ожидаемом scanSession
+const sessionColumns = "id, user_id, session_key_hash, created_at, last_use, is_active, user_agent, ip"
+
+func scanSession(row interface{ Scan(...any) error }) (*models.Session, error) {
+	s := new(models.Session)
+	err := row.Scan(&s.ID, &s.UserID, &s.SessionKeyHash, &s.CreatedAt, &s.LastUse, &s.IsActive, &s.UserAgent, &s.IP)
+	return s, err
+}
+
+func (r *SessionRepo) Create(userID int, sessionKey, userAgent, ip string) (*models.Session, error) {
+	res, err := r.db.Exec("INSERT INTO sessions(user_id, session_key_hash, user_agent, ip) VALUES (?, ?, ?, ?)",
+		userID, sha3Hash(sessionKey), userAgent, ip)
 	if err != nil {
 		return &models.Session{}, err
 	}
@@ -33,7 +43,7 @@ func (r *SessionRepo) Create(userID int, sessionKey string) (*models.Session, er
 }
 
 func (r *SessionRepo) GetUserSessions(userID int) ([]*models.Session, error) {
-	rows, err := r.db.Query("SELECT * FROM sessions WHERE user_id=?", userID)
+	rows, err := r.db.Query("SELECT "+sessionColumns+" FROM sessions WHERE user_id=? ORDER BY last_use DESC", userID)
 	if err != nil {
 		return []*models.Session{}, err
 	}
@@ -41,8 +51,8 @@ func (r *SessionRepo) GetUserSessions(userID int) ([]*models.Session, error) {
 
 	var sessions []*models.Session
 	for rows.Next() {
-		s := new(models.Session)
-		if err := rows.Scan(&s.ID, &s.UserID, &s.SessionKeyHash, &s.CreatedAt, &s.LastUse, &s.IsActive); err != nil {
+		s, err := scanSession(rows)
+		if err != nil {
 			return sessions, err
 		}
 		sessions = append(sessions, s)
@@ -54,25 +64,15 @@ func (r *SessionRepo) GetUserSessions(userID int) ([]*models.Session, error) {
 }
 
 func (r *SessionRepo) GetSessionByID(sessionID int) (*models.Session, error) {
-	var s models.Session
-
-	row := r.db.QueryRow("SELECT * FROM sessions WHERE id=?", sessionID)
-	err := row.Scan(&s.ID, &s.UserID, &s.SessionKeyHash, &s.CreatedAt, &s.LastUse, &s.IsActive)
-
-	return &s, err
+	return scanSession(r.db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id=?", sessionID))
 }
 
 func (r *SessionRepo) GetSessionByKey(sessionKey string) (*models.Session, error) {
-	var s models.Session
-
-	row := r.db.QueryRow("SELECT * FROM sessions WHERE session_key_hash=?", sha3Hash(sessionKey))
-	err := row.Scan(&s.ID, &s.UserID, &s.SessionKeyHash, &s.CreatedAt, &s.LastUse, &s.IsActive)
-
-	return &s, err
+	return scanSession(r.db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE session_key_hash=?", sha3Hash(sessionKey)))
 }
 
 func (r *SessionRepo) UpdateLastUsedByKey(sessionKey string) error {
-	res, err := r.db.Exec("UPDATE sessions SET last_use=$1 WHERE session_key_hash=$2", time.Now(), sha3Hash(sessionKey))
+	res, err := r.db.Exec("UPDATE sessions SET last_use=$1 WHERE session_key_hash=$2", time.Now().UTC(), sha3Hash(sessionKey))
 
 	if err != nil {
 		return err
@@ -84,7 +84,7 @@ func (r *SessionRepo) UpdateLastUsedByKey(sessionKey string) error {
 }
 
 func (r *SessionRepo) UpdateLastUsedByID(sessionID int) error {
-	res, err := r.db.Exec("UPDATE sessions SET last_use=$1 WHERE id=$2", time.Now(), sessionID)
+	res, err := r.db.Exec("UPDATE sessions SET last_use=$1 WHERE id=$2", time.Now().UTC(), sessionID)
 
 	if err != nil {
 		return err
@@ -107,6 +107,38 @@ func (r *SessionRepo) SetInactive(sessionKey string) error {
 	return nil
 }
 
+func (r *SessionRepo) SetInactiveByID(sessionID, userID int) error {
+	res, err := r.db.Exec("UPDATE sessions SET is_active=0 WHERE id=$1 AND user_id=$2 AND is_active=1", sessionID, userID)
+
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
+
+func (r *SessionRepo) SetInactiveExcept(userID, exceptSessionID int) (int, error) {
+	res, err := r.db.Exec("UPDATE sessions SET is_active=0 WHERE user_id=$1 AND id<>$2 AND is_active=1", userID, exceptSessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	return int(affected), err
+}
+
+func (r *SessionRepo) DeleteStale(createdBefore, usedBefore time.Time) (int, error) {
+	res, err := r.db.Exec("DELETE FROM sessions WHERE is_active=0 OR created_at<$1 OR last_use<$2", createdBefore.UTC(), usedBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	return int(affected), err
+}
+
 func sha3Hash(input string) string {
 	hash := sha3.NewShake256()
 	_, _ = hash.Write([]byte(input))
@@ -0,0 +1,114 @@
+//go:build sqlite_fts5
+
+package repositories
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionRepoDeleteStale(t *testing.T) {
+	conn := openTestDB(t)
+	repo := NewSessionRepo(conn)
+	now := time.Now().UTC()
+
+	// Сроки задаются напрямую в базе, как будто сессии созданы и использовались в прошлом
+	sessions := []struct {
+		key       string
+		createdAt time.Time
+		lastUse   time.Time
+		active    bool
+		stale     bool
+	}{
+		{"fresh", now.Add(-time.Hour), now, true, false},
+		{"idle", now.Add(-10 * 24 * time.Hour), now.Add(-8 * 24 * time.Hour), true, true},
+		{"old", now.Add(-31 * 24 * time.Hour), now.Add(-time.Minute), true, true},
+		{"logged-out", now.Add(-time.Hour), now, false, true},
+	}
+	for _, s := range sessions {
+		created, err := repo.Create(1, s.key, "test", "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = conn.Exec("UPDATE sessions SET created_at=$1, last_use=$2, is_active=$3 WHERE id=$4", s.createdAt, s.lastUse, s.active, created.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Только что созданная сессия со временем из DEFAULT CURRENT_TIMESTAMP
+	if _, err := repo.Create(1, "new", "test", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := repo.DeleteStale(now.Add(-30*24*time.Hour), now.Add(-7*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Errorf("удалено %d сессий, ожидалось 3", deleted)
+	}
+	for _, s := range sessions {
+		_, err := repo.GetSessionByKey(s.key)
+		if kept := err == nil; kept == s.stale {
+			t.Errorf("сессия %s: осталась %v", s.key, kept)
+		}
+	}
+	if _, err = repo.GetSessionByKey("new"); err != nil {
+		t.Errorf("новая сессия удалена: %v", err)
+	}
+}
+
+func TestSessionRepoRevoke(t *testing.T) {
+	repo := NewSessionRepo(openTestDB(t))
+
+	create := func(userID int, key string) int {
+		t.Helper()
+		s, err := repo.Create(userID, key, "Firefox", "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.ID
+	}
+	current := create(1, "current")
+	laptop := create(1, "laptop")
+	create(1, "phone")
+	other := create(2, "other-user")
+
+	active := func(key string) bool {
+		t.Helper()
+		s, err := repo.GetSessionByKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.IsActive
+	}
+
+	// Чужую сессию завершить нельзя
+	if err := repo.SetInactiveByID(other, 1); err == nil || !active("other-user") {
+		t.Error("пользователь завершил чужую сессию")
+	}
+	if err := repo.SetInactiveByID(laptop, 1); err != nil || active("laptop") {
+		t.Errorf("сессия не завершена: %v", err)
+	}
+	// Повторное завершение - ошибка, чтобы обработчик ответил 404
+	if err := repo.SetInactiveByID(laptop, 1); err == nil {
+		t.Error("повторное завершение без ошибки")
+	}
+
+	revoked, err := repo.SetInactiveExcept(1, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 1 || !active("current") || active("phone") || !active("other-user") {
+		t.Errorf("завершено %d сессий, текущая активна: %v, телефон активен: %v", revoked, active("current"), active("phone"))
+	}
+
+	sessions, err := repo.GetUserSessions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 3 || sessions[0].UserAgent != "Firefox" || sessions[0].IP != "192.0.2.1" {
+		t.Errorf("сессии пользователя: %d, первая %+v", len(sessions), sessions[0])
+	}
+}
@@ -0,0 +1,29 @@
+package repositories
+
+import (
+	"database/sql"
+)
+
+type SettingsRepo struct {
+	db *sql.DB
+}
+
+func NewSettingsRepo(db *sql.DB) *SettingsRepo {
+	return &SettingsRepo{
+		db: db,
+	}
+}
+
+func (r *SettingsRepo) Get(key string) (string, error) {
+	var value string
+	err := r.db.QueryRow("SELECT value FROM settings WHERE key=?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func (r *SettingsRepo) Set(key, value string) error {
+	_, err := r.db.Exec("INSERT INTO settings(key, value) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET value=$2", key, value)
+	return err
+}
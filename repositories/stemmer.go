@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Упрощённая реализация Snowball стеммера для русского языка.
+// Используется для построения префиксных FTS5 запросов: "новостями" -> "новост*",
+// так что встроенный токенизатор unicode61 находит все словоформы.
+// Описание алгоритма: https://snowballstem.org/algorithms/russian/stemmer.html
+
+var (
+	ruPerfectiveGerund1 = []string{"вшись", "вши", "в"}
+	ruPerfectiveGerund2 = []string{"ившись", "ывшись", "ивши", "ывши", "ив", "ыв"}
+	ruAdjective         = []string{"ими", "ыми", "его", "ого", "ему", "ому", "ее", "ие", "ые", "ое", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}
+	ruParticiple1       = []string{"ем", "нн", "вш", "ющ", "щ"}
+	ruParticiple2       = []string{"ивш", "ывш", "ующ"}
+	ruReflexive         = []string{"ся", "сь"}
+	ruVerb1             = []string{"ете", "йте", "ешь", "нно", "ла", "на", "ли", "ем", "ло", "но", "ет", "ют", "ны", "ть", "й", "л", "н"}
+	ruVerb2             = []string{"ейте", "уйте", "ила", "ыла", "ена", "ите", "или", "ыли", "ило", "ыло", "ено", "ует", "уют", "ены", "ить", "ыть", "ишь", "ей", "уй", "ил", "ыл", "им", "ым", "ен", "ят", "ит", "ыт", "ую", "ю"}
+	ruNoun              = []string{"иями", "ями", "ами", "ией", "иям", "ием", "иях", "ев", "ов", "ие", "ье", "еи", "ии", "ей", "ой", "ий", "ям", "ем", "ам", "ом", "ах", "ях", "ию", "ью", "ия", "ья", "а", "е", "и", "й", "о", "у", "ы", "ь", "ю", "я"}
+	ruSuperlative       = []string{"ейше", "ейш"}
+	ruDerivational      = []string{"ость", "ост"}
+)
+
+func isRuVowel(r rune) bool {
+	return strings.ContainsRune("аеиоуыэюя", r)
+}
+
+// stemRussian возвращает основу русского слова. Слова на других языках возвращаются в нижнем регистре без изменений.
+func stemRussian(word string) string {
+	w := []rune(strings.ReplaceAll(strings.ToLower(word), "ё", "е"))
+	for _, r := range w {
+		if !unicode.Is(unicode.Cyrillic, r) {
+			return string(w)
+		}
+	}
+
+	rv := len(w)
+	for i, r := range w {
+		if isRuVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	r1 := len(w)
+	for i := 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r1 = i + 1
+			break
+		}
+	}
+	r2 := len(w)
+	for i := r1 + 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r2 = i + 1
+			break
+		}
+	}
+
+	// Шаг 1
+	if s, ok := removeEnding(w, rv, ruPerfectiveGerund1, true); ok {
+		w = s
+	} else if s, ok := removeEnding(w, rv, ruPerfectiveGerund2, false); ok {
+		w = s
+	} else {
+		if s, ok := removeEnding(w, rv, ruReflexive, false); ok {
+			w = s
+		}
+		if s, ok := removeAdjectival(w, rv); ok {
+			w = s
+		} else if s, ok := removeEnding(w, rv, ruVerb1, true); ok {
+			w = s
+		} else if s, ok := removeEnding(w, rv, ruVerb2, false); ok {
+			w = s
+		} else if s, ok := removeEnding(w, rv, ruNoun, false); ok {
+			w = s
+		}
+	}
+
+	// Шаг 2
+	if s, ok := removeEnding(w, rv, []string{"и"}, false); ok {
+		w = s
+	}
+
+	// Шаг 3
+	if s, ok := removeEnding(w, r2, ruDerivational, false); ok {
+		w = s
+	}
+
+	// Шаг 4
+	if s, ok := removeEnding(w, rv, []string{"нн"}, false); ok {
+		w = append(s, 'н')
+	} else if s, ok := removeEnding(w, rv, ruSuperlative, false); ok {
+		w = s
+		if s, ok := removeEnding(w, rv, []string{"нн"}, false); ok {
+			w = append(s, 'н')
+		}
+	} else if s, ok := removeEnding(w, rv, []string{"ь"}, false); ok {
+		w = s
+	}
+
+	return string(w)
+}
+
+// removeAdjectival удаляет окончание прилагательного, а также предшествующий ему суффикс причастия.
+func removeAdjectival(w []rune, rv int) ([]rune, bool) {
+	s, ok := removeEnding(w, rv, ruAdjective, false)
+	if !ok {
+		return w, false
+	}
+	if p, ok := removeEnding(s, rv, ruParticiple1, true); ok {
+		return p, true
+	}
+	if p, ok := removeEnding(s, rv, ruParticiple2, false); ok {
+		return p, true
+	}
+	return s, true
+}
+
+// removeEnding удаляет самое длинное из окончаний, целиком лежащее в регионе, начинающемся с индекса region.
+// Если afterAYa, то окончание должно следовать за "а" или "я", которые при этом не удаляются.
+func removeEnding(w []rune, region int, endings []string, afterAYa bool) ([]rune, bool) {
+	best := -1
+	for _, e := range endings {
+		er := []rune(e)
+		start := len(w) - len(er)
+		if start < region || string(w[start:]) != e {
+			continue
+		}
+		if afterAYa && (start-1 < region || (w[start-1] != 'а' && w[start-1] != 'я')) {
+			continue
+		}
+		if best == -1 || start < best {
+			best = start
+		}
+	}
+	if best == -1 {
+		return w, false
+	}
+	return w[:best], true
+}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/svuvi/theweek/models"
 )
@@ -17,6 +18,22 @@ func NewUserRepo(db *sql.DB) *UserRepo {
 	}
 }
 
+// Столбцы пользователя в порядке, ожидаемом scanUser
+const userColumns = "id, username, hashed_password, registered_at, role, bio, avatar_image_id, failed_logins, locked_until, totp_secret, totp_enabled, totp_last_step"
+
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	u := new(models.User)
+	var avatarImageID sql.NullInt16
+	var lockedUntil sql.NullTime
+
+	err := row.Scan(&u.ID, &u.Username, &u.HashedPassowrd, &u.RegisteredAt, &u.Role, &u.Bio, &avatarImageID, &u.FailedLogins, &lockedUntil, &u.TOTPSecret, &u.TOTPEnabled, &u.TOTPLastStep)
+
+	u.AvatarImageID = NullInt16ToInt(avatarImageID)
+	u.LockedUntil = NullTimeToTime(lockedUntil)
+
+	return u, err
+}
+
 func (r *UserRepo) Create(username, hashedPassowrd string) (*models.User, error) {
 	res, err := r.db.Exec("INSERT INTO users(username, hashed_password) VALUES (?, ?)", username, hashedPassowrd)
 	if err != nil {
@@ -31,7 +48,7 @@ func (r *UserRepo) Create(username, hashedPassowrd string) (*models.User, error)
 }
 
 func (r *UserRepo) GetAll() ([]*models.User, error) {
-	rows, err := r.db.Query("SELECT * FROM users")
+	rows, err := r.db.Query("SELECT " + userColumns + " FROM users")
 	if err != nil {
 		return []*models.User{}, err
 	}
@@ -39,8 +56,8 @@ func (r *UserRepo) GetAll() ([]*models.User, error) {
 
 	var users []*models.User
 	for rows.Next() {
-		u := new(models.User)
-		if err := rows.Scan(&u.ID, &u.Username, &u.HashedPassowrd, &u.RegisteredAt, &u.IsAdmin); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			return users, err
 		}
 		users = append(users, u)
@@ -52,27 +69,23 @@ func (r *UserRepo) GetAll() ([]*models.User, error) {
 }
 
 func (r *UserRepo) GetByID(id int) (*models.User, error) {
-	var user models.User
-
-	row := r.db.QueryRow("SELECT * FROM users WHERE id=?", id)
-	err := row.Scan(&user.ID, &user.Username, &user.HashedPassowrd, &user.RegisteredAt, &user.IsAdmin)
+	row := r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id=?", id)
+	user, err := scanUser(row)
 	if err != nil {
 		return &models.User{}, err
 	}
 
-	return &user, err
+	return user, err
 }
 
 func (r *UserRepo) GetByUsername(username string) (*models.User, error) {
-	var user models.User
-
-	row := r.db.QueryRow("SELECT * FROM users WHERE username=?", username)
-	err := row.Scan(&user.ID, &user.Username, &user.HashedPassowrd, &user.RegisteredAt, &user.IsAdmin)
+	row := r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username=?", username)
+	user, err := scanUser(row)
 	if err != nil {
 		return &models.User{}, err
 	}
 
-	return &user, err
+	return user, err
 }
 
 func (r *UserRepo) ChangeUsername(id int, newUsername string) error {
@@ -99,8 +112,54 @@ func (r *UserRepo) ChangePassword(id int, newHashedPassword string) error {
 	return nil
 }
 
-func (r *UserRepo) SetAdmin(id int, isAdmin bool) error {
-	res, err := r.db.Exec("UPDATE users SET is_admin=$1 WHERE id=$2", isAdmin, id)
+func (r *UserRepo) SetRole(id int, role models.Role) error {
+	res, err := r.db.Exec("UPDATE users SET role=$1 WHERE id=$2", role, id)
+
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
+
+func (r *UserRepo) UpdateProfile(id int, bio string, avatarImageID int) error {
+	res, err := r.db.Exec("UPDATE users SET bio=$1, avatar_image_id=$2 WHERE id=$3", bio, IntToNullInt16(avatarImageID), id)
+
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
+
+func (r *UserRepo) RecordFailedLogin(id int, now time.Time) (int, error) {
+	// Обе части SET видят старое значение locked_until: истёкшая блокировка снимается, а счёт начинается с единицы
+	var failed int
+	err := r.db.QueryRow(`UPDATE users SET
+			failed_logins = CASE WHEN datetime(locked_until) <= datetime($1) THEN 1 ELSE failed_logins+1 END,
+			locked_until = CASE WHEN datetime(locked_until) <= datetime($1) THEN NULL ELSE locked_until END
+		WHERE id=$2 RETURNING failed_logins`, now.UTC(), id).Scan(&failed)
+	return failed, err
+}
+
+func (r *UserRepo) Lock(id int, until time.Time) error {
+	res, err := r.db.Exec("UPDATE users SET locked_until=$1 WHERE id=$2", until.UTC(), id)
+
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
+
+func (r *UserRepo) Unlock(id int) error {
+	res, err := r.db.Exec("UPDATE users SET failed_logins=0, locked_until=NULL WHERE id=$1", id)
 
 	if err != nil {
 		return err
@@ -111,6 +170,51 @@ func (r *UserRepo) SetAdmin(id int, isAdmin bool) error {
 	return nil
 }
 
+func (r *UserRepo) SetTOTPSecret(id int, secret string) error {
+	res, err := r.db.Exec("UPDATE users SET totp_secret=$1, totp_enabled=0 WHERE id=$2", secret, id)
+
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
+
+func (r *UserRepo) EnableTOTP(id int) error {
+	res, err := r.db.Exec("UPDATE users SET totp_enabled=1 WHERE id=$1 AND totp_secret != ''", id)
+
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
+
+func (r *UserRepo) DisableTOTP(id int) error {
+	res, err := r.db.Exec("UPDATE users SET totp_secret='', totp_enabled=0, totp_last_step=0 WHERE id=$1", id)
+
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); affected != 1 && err == nil {
+		return fmt.Errorf("изменено непредвиденное количество строк: %d", affected)
+	}
+	return nil
+}
+
+func (r *UserRepo) UseTOTPStep(id int, step int64) (bool, error) {
+	res, err := r.db.Exec("UPDATE users SET totp_last_step=$1 WHERE id=$2 AND totp_last_step < $1", step, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected == 1, err
+}
+
 func (r *UserRepo) Delete(id int) error {
 	res, err := r.db.Exec("DELETE FROM users WHERE id=$1", id)
 	if err != nil {
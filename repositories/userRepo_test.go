@@ -0,0 +1,82 @@
+//go:build sqlite_fts5
+
+package repositories
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserRepoLockout(t *testing.T) {
+	repo := NewUserRepo(openTestDB(t))
+	u, err := repo.Create("anna", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for want := 1; want <= 3; want++ {
+		failed, err := repo.RecordFailedLogin(u.ID, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed != want {
+			t.Errorf("неудачных попыток %d, ожидалось %d", failed, want)
+		}
+	}
+
+	until := now.Add(15 * time.Minute)
+	if err = repo.Lock(u.ID, until); err != nil {
+		t.Fatal(err)
+	}
+	u, err = repo.GetByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.IsLocked() || u.FailedLogins != 3 || u.LockedUntil.Sub(until).Abs() > time.Second {
+		t.Errorf("после блокировки: заблокирован %v до %v, попыток %d", u.IsLocked(), u.LockedUntil, u.FailedLogins)
+	}
+
+	if err = repo.Unlock(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	u, err = repo.GetByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.IsLocked() || u.FailedLogins != 0 || !u.LockedUntil.IsZero() {
+		t.Errorf("после разблокировки: до %v, попыток %d", u.LockedUntil, u.FailedLogins)
+	}
+
+	// Попытки во время блокировки считаются дальше, после её окончания счёт начинается заново
+	if err = repo.Lock(u.ID, until); err != nil {
+		t.Fatal(err)
+	}
+	attempts := []struct {
+		at         time.Time
+		wantFailed int
+		wantLocked bool // блокировка осталась в базе
+	}{
+		{now, 1, true},
+		{now.Add(14 * time.Minute), 2, true},
+		{until.Add(time.Second), 1, false},
+		{until.Add(2 * time.Second), 2, false},
+	}
+	for _, a := range attempts {
+		failed, err := repo.RecordFailedLogin(u.ID, a.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err = repo.GetByID(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed != a.wantFailed || u.LockedUntil.IsZero() == a.wantLocked {
+			t.Errorf("попытка через %v: неудачных попыток %d, блокировка до %v", a.at.Sub(now), failed, u.LockedUntil)
+		}
+	}
+
+	if err = repo.Lock(9999, until); err == nil {
+		t.Error("блокировка несуществующего пользователя без ошибки")
+	}
+}
@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/models"
+)
+
+type sessionKey struct{}
+
+// Как часто обновляется last_use. Чаще писать в SQLite на каждый просмотр страницы незачем:
+// для таймаута бездействия и списка сессий такой точности хватает
+const sessionTouchInterval = 5 * time.Minute
+
+// authenticate один раз за запрос находит сессию по куки и кладёт её и пользователя в контекст.
+// Заодно продлевает сессию: обновляет last_use не чаще sessionTouchInterval и вместе с ним
+// переставляет куки, чтобы браузер хранил его до нового срока истечения.
+// Истёкшие сессии завершаются, а куки удаляется
+func (h *BaseHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/static/") || strings.HasPrefix(r.URL.Path, "/images/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := getSessionKey(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		session, err := h.sessionRepo.GetSessionByKey(key)
+		if err != nil || !session.IsActive {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		if h.sessionPolicy.IsExpired(session, now) {
+			if err = h.sessionRepo.SetInactive(key); err != nil {
+				log.Printf("Ошибка при завершении истёкшей сессии с ID=%d:\n%v", session.ID, err)
+			}
+			h.clearSessionCookie(w)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := h.userRepo.GetByID(session.UserID)
+		if err != nil {
+			log.Printf("Ошибка при загрузке пользователя с ID=%d для сессии с ID=%d:\n%v", session.UserID, session.ID, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if now.Sub(session.LastUse) >= sessionTouchInterval {
+			if err = h.sessionRepo.UpdateLastUsedByID(session.ID); err != nil {
+				log.Printf("Ошибка при попытке обновить поле last_use для сессии с ID=%d:\n%v", session.ID, err)
+			} else {
+				session.LastUse = now
+				h.setSessionCookie(w, key, h.sessionPolicy.ExpiresAt(session))
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), sessionKey{}, session)
+		ctx = components.WithUser(ctx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// currentUser возвращает пользователя, найденного authenticate. Для гостей возвращается пользователь с ID=0 и false
+func currentUser(r *http.Request) (*models.User, bool) {
+	user := components.CurrentUser(r.Context())
+	return user, user.ID != 0
+}
+
+// currentSession возвращает сессию, с которой пришёл запрос
+func currentSession(r *http.Request) (*models.Session, bool) {
+	session, ok := r.Context().Value(sessionKey{}).(*models.Session)
+	return session, ok
+}
+
+// denyAccess отвечает гостю 401, а браузеру, открывающему страницу, предлагает войти
+func denyAccess(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.Header.Get("HX-Request") == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.Error(w, "Отказано в доступе", http.StatusUnauthorized)
+}
+
+// RequireUser пропускает к next только вошедших пользователей
+func (h *BaseHandler) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := currentUser(r); !ok {
+			denyAccess(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RequireRole пропускает к next пользователей с ролью role или выше.
+// Неавторизованным отвечает 401, остальным 403
+func (h *BaseHandler) RequireRole(role models.Role, next http.HandlerFunc) http.HandlerFunc {
+	return h.require(func(user *models.User) bool { return user.Role.AtLeast(role) }, next)
+}
+
+// RequirePermission пропускает к next, только если у пользователя есть право p.
+// Неавторизованным отвечает 401, пользователям без нужного права 403
+func (h *BaseHandler) RequirePermission(p models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return h.require(func(user *models.User) bool { return user.Can(p) }, next)
+}
+
+func (h *BaseHandler) require(allowed func(user *models.User) bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(r)
+		if !ok {
+			denyAccess(w, r)
+			return
+		}
+		if !allowed(user) {
+			http.Error(w, "Отказано в доступе", http.StatusForbidden)
+			return
+		}
+		if user.Role == models.RoleAdmin && !user.TOTPEnabled && h.admin2FARequired() {
+			http.Error(w, "Администраторам необходимо включить двухфакторную аутентификацию на странице /account/", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
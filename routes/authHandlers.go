@@ -2,19 +2,24 @@ package routes
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/google/uuid"
 	"github.com/svuvi/theweek/components"
 	"github.com/svuvi/theweek/layouts"
+	"github.com/svuvi/theweek/models"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func (h *BaseHandler) loginFormHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, _ := isAuthorised(r, h)
-	if authorized {
+	if _, authorized := currentUser(r); authorized {
 		http.Error(w, "Вы уже зашли в аккаунт", http.StatusBadRequest)
 		return
 	}
@@ -53,6 +58,23 @@ func (h *BaseHandler) loginFormHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Лимиты проверяются до bcrypt, чтобы перебор не нагружал процессор
+	ip := clientIP(r)
+	if ok, retry := h.ipLimiter.Allow(ip); !ok {
+		log.Printf("Превышен лимит попыток входа с IP %s", ip)
+		tooManyAttempts(w, retry)
+		passwordResult = components.FormWarning(tooManyAttemptsMessage(retry))
+		components.LoginForm(username, password, usernameResult, passwordResult).Render(r.Context(), w)
+		return
+	}
+	if ok, retry := h.usernameLimiter.Allow(strings.ToLower(username)); !ok {
+		log.Printf("Превышен лимит попыток входа для логина %s, IP %s", username, ip)
+		tooManyAttempts(w, retry)
+		passwordResult = components.FormWarning(tooManyAttemptsMessage(retry))
+		components.LoginForm(username, password, usernameResult, passwordResult).Render(r.Context(), w)
+		return
+	}
+
 	user, err := h.userRepo.GetByUsername(username)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -61,35 +83,119 @@ func (h *BaseHandler) loginFormHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.IsLocked() {
+		w.WriteHeader(http.StatusForbidden)
+		passwordResult = components.FormWarning(fmt.Sprintf("Вход в аккаунт заблокирован до %s из-за неудачных попыток входа. Попробуйте позже или обратитесь к администратору",
+			user.LockedUntil.Local().Format("02.01.2006 15:04")))
+		components.LoginForm(username, password, usernameResult, passwordResult).Render(r.Context(), w)
+		return
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassowrd), []byte(password)); err != nil {
+		h.recordFailedLogin(user, ip)
 		w.WriteHeader(http.StatusUnauthorized)
 		passwordResult = components.FormWarning("Неверный пароль")
 		components.LoginForm(username, password, usernameResult, passwordResult).Render(r.Context(), w)
 		return
 	}
 
-	sessionKey := uuid.NewString()
-	_, err = h.sessionRepo.Create(user.ID, sessionKey)
-	if err != nil {
+	if user.FailedLogins > 0 || !user.LockedUntil.IsZero() {
+		if err = h.userRepo.Unlock(user.ID); err != nil {
+			log.Printf("Ошибка при сбросе счётчика неудачных попыток входа пользователя %s:\n%v", user.Username, err)
+		}
+	}
+	h.usernameLimiter.Reset(strings.ToLower(username))
+
+	// С включённой 2FA сессия создаётся только после ввода кода, см. totpLoginHandler
+	if user.TOTPEnabled {
+		if err = h.startPreSession(w, models.PreSessionTOTP, user.ID, nil); err != nil {
+			log.Printf("Ошибка при создании предварительной сессии пользователя %s:\n%v", user.Username, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			passwordResult = components.FormWarning("Ошкбка на стороне сервера")
+			components.LoginForm(username, password, usernameResult, passwordResult).Render(r.Context(), w)
+			return
+		}
+		components.TOTPLoginForm(templ.NopComponent).Render(r.Context(), w)
+		return
+	}
+
+	if err = h.createSession(w, r, user.ID); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		passwordResult = components.FormWarning("Ошкбка на стороне сервера")
 		components.LoginForm(username, password, usernameResult, passwordResult).Render(r.Context(), w)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_key",
-		Value:    sessionKey,
-		Path:     "",
-		HttpOnly: true,
-		Secure:   true,
-	})
 	components.LoggedIn().Render(r.Context(), w)
 }
 
+// Длина сохраняемого User-Agent: для списка сессий хватает начала строки
+const maxUserAgentLength = 300
+
+// createSession создаёт сессию пользователя и выставляет куки session_key.
+// Браузер и IP запоминаются для списка активных сессий на странице аккаунта
+func (h *BaseHandler) createSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+
+	sessionKey := uuid.NewString()
+	session, err := h.sessionRepo.Create(userID, sessionKey, userAgent, clientIP(r))
+	if err != nil {
+		return err
+	}
+
+	h.setSessionCookie(w, sessionKey, h.sessionPolicy.ExpiresAt(session))
+	return nil
+}
+
+// Количество неудачных попыток входа подряд, после которого аккаунт блокируется на lockoutDuration
+const (
+	maxFailedLogins = 5
+	lockoutDuration = 15 * time.Minute
+)
+
+// recordFailedLogin учитывает неудачную попытку входа и при необходимости блокирует аккаунт
+func (h *BaseHandler) recordFailedLogin(user *models.User, ip string) {
+	now := time.Now()
+	failed, err := h.userRepo.RecordFailedLogin(user.ID, now)
+	if err != nil {
+		log.Printf("Ошибка при учёте неудачной попытки входа пользователя %s:\n%v", user.Username, err)
+		return
+	}
+	if failed < maxFailedLogins {
+		return
+	}
+
+	until := now.Add(lockoutDuration)
+	if err = h.userRepo.Lock(user.ID, until); err != nil {
+		log.Printf("Ошибка при блокировке входа пользователя %s:\n%v", user.Username, err)
+		return
+	}
+
+	details := fmt.Sprintf("%d неудачных попыток входа подряд, вход заблокирован до %s", failed, until.Local().Format("02.01.2006 15:04"))
+	log.Printf("Блокировка входа пользователя %s: %s, IP %s", user.Username, details, ip)
+	if err = h.auditRepo.Create(user.ID, models.AuditLoginLockout, details, ip); err != nil {
+		log.Print("Ошибка при записи в журнал безопасности:\n", err)
+	}
+}
+
+// tooManyAttempts выставляет статус 429 и Retry-After
+func tooManyAttempts(w http.ResponseWriter, retry time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+func tooManyAttemptsMessage(retry time.Duration) string {
+	if retry < time.Minute {
+		return fmt.Sprintf("Слишком много попыток. Попробуйте снова через %d сек.", int(math.Ceil(retry.Seconds())))
+	}
+	return fmt.Sprintf("Слишком много попыток. Попробуйте снова через %d мин.", int(math.Ceil(retry.Minutes())))
+}
+
 func (h *BaseHandler) registrationFormHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, _ := isAuthorised(r, h)
-	if authorized {
+	if _, authorized := currentUser(r); authorized {
 		http.Error(w, "Вы уже зашли в аккаунт", http.StatusBadRequest)
 		return
 	}
@@ -150,7 +256,7 @@ func (h *BaseHandler) registrationFormHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
 	if err != nil {
 		log.Print("Unexpected error when generating hash from password: ", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -164,20 +270,11 @@ func (h *BaseHandler) registrationFormHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	sessionKey := uuid.NewString()
-	_, err = h.sessionRepo.Create(user.ID, sessionKey)
-	if err != nil {
+	if err = h.createSession(w, r, user.ID); err != nil {
 		log.Printf("Error when creating session for the user who just registered.\nUsername: %s, Hashed password: %s\n%v", username, hashedPassword, err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_key",
-		Value:    sessionKey,
-		Path:     "",
-		HttpOnly: true,
-		Secure:   true,
-	})
 
 	components.Registered().Render(r.Context(), w)
 
@@ -187,8 +284,7 @@ func (h *BaseHandler) registrationFormHandler(w http.ResponseWriter, r *http.Req
 }
 
 func (h *BaseHandler) logoutHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, _ := isAuthorised(r, h)
-	if !authorized {
+	if _, authorized := currentUser(r); !authorized {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
@@ -201,24 +297,13 @@ func (h *BaseHandler) logoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_key",
-		Value:    "",
-		Path:     "/",
-		Expires:  time.Unix(0, 0),
-		HttpOnly: true,
-		Secure:   true,
-	})
+	h.clearSessionCookie(w)
 
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 func (h *BaseHandler) changePasswordForm(w http.ResponseWriter, r *http.Request) {
-	authorised, user := isAuthorised(r, h)
-	if !authorised {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
-	}
+	user, _ := currentUser(r)
 
 	err := r.ParseForm()
 	if err != nil {
@@ -257,7 +342,7 @@ func (h *BaseHandler) changePasswordForm(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordNew), 14)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordNew), h.config.BcryptCost)
 	if err != nil {
 		repeatResult = components.FormWarning("Внутрянняя ошибка сервера. Новый пароль не вступает в силу")
 		components.PasswordChangeForm(passwordResult, passwordNewResult, repeatResult, passwordCurrent, passwordNew, "").Render(r.Context(), w)
@@ -271,13 +356,15 @@ func (h *BaseHandler) changePasswordForm(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Остальные устройства должны войти заново с новым паролем
+	session, _ := currentSession(r)
+	h.revokeOtherSessions(user.ID, session.ID)
+
 	components.PasswordChanged().Render(r.Context(), w)
 	log.Printf("Изменен пароль пользователя %s", user.Username)
 }
 
 func (h *BaseHandler) restorePasswordPage(w http.ResponseWriter, r *http.Request) {
-	isAuthorised(r, h) // Здесь только для отметки последнего использования сессии
-
 	q := r.URL.Query()
 	code := q.Get("code")
 
@@ -301,7 +388,7 @@ func (h *BaseHandler) restorePasswordPage(w http.ResponseWriter, r *http.Request
 }
 
 func (h *BaseHandler) restorePasswordForm(w http.ResponseWriter, r *http.Request) {
-	authorised, _ := isAuthorised(r, h) // отметка
+	_, authorised := currentUser(r)
 
 	q := r.URL.Query()
 	code := q.Get("code")
@@ -312,6 +399,14 @@ func (h *BaseHandler) restorePasswordForm(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	ip := clientIP(r)
+	if ok, retry := h.ipLimiter.Allow(ip); !ok {
+		log.Printf("Превышен лимит попыток восстановления пароля с IP %s", ip)
+		tooManyAttempts(w, retry)
+		components.PasswordRestoreForm(code, components.FormWarning(tooManyAttemptsMessage(retry))).Render(r.Context(), w)
+		return
+	}
+
 	rCode, err := h.recoveryCodeRepo.Get(code)
 	if err != nil || !rCode.IsActive() {
 		log.Print("err when retreiving the code from db: \n", err)
@@ -360,7 +455,7 @@ func (h *BaseHandler) restorePasswordForm(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
 	if err != nil {
 		result := components.FormWarning("Внутренняя ошибка сервера. Сообщи администратору и попробуй позже")
 		components.PasswordRestoreForm(code, result).Render(r.Context(), w)
@@ -379,22 +474,19 @@ func (h *BaseHandler) restorePasswordForm(w http.ResponseWriter, r *http.Request
 		log.Printf("Ошибка при попытке отметить код восстановления для пользователя как использованный.\nКод:%s\nID пользователя:%d", rCode.RecoveryCode, rCode.UserID)
 	}
 
+	// Пароль мог утечь вместе с сессиями, поэтому все остальные входы в аккаунт завершаются
+	currentSessionID := 0
+	if session, ok := currentSession(r); ok && session.UserID == rCode.UserID {
+		currentSessionID = session.ID
+	}
+	h.revokeOtherSessions(rCode.UserID, currentSessionID)
+
 	if !authorised {
-		sessionKey := uuid.NewString()
-		_, err = h.sessionRepo.Create(rCode.ID, sessionKey)
-		if err != nil {
+		if err = h.createSession(w, r, rCode.UserID); err != nil {
 			result := components.FormWarning("Внутренняя ошибка сервера. Сообщи администратору и попробуй позже")
 			components.PasswordRestoreForm(code, result).Render(r.Context(), w)
 			return
 		}
-
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_key",
-			Value:    sessionKey,
-			Path:     "",
-			HttpOnly: true,
-			Secure:   true,
-		})
 	}
 
 	components.PasswordRestored().Render(r.Context(), w)
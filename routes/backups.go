@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/svuvi/theweek/backup"
+	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/layouts"
+	"github.com/svuvi/theweek/models"
+)
+
+func (h *BaseHandler) dashboardBackupsHandler(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := h.backupStore.List()
+	if err != nil {
+		log.Print("Ошибка при чтении папки резервных копий:\n", err)
+		http.Error(w, "Ошибка при попытке загрузить резервные копии", http.StatusInternalServerError)
+		return
+	}
+	layouts.DashboardBackups(snapshots, h.backupStore.Enabled()).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) createBackup(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+
+	result := components.FormOK("Копия создана и проверена")
+	snapshot, err := h.backupStore.Create(backup.KindManual)
+	if err != nil {
+		log.Print("Ошибка при создании резервной копии базы данных:\n", err)
+		result = components.FormWarning("Не удалось создать копию, подробности в журнале сервера")
+	} else {
+		log.Printf("Пользователь %s создал резервную копию %s", user.Username, snapshot.Name)
+		if err = h.auditRepo.Create(user.ID, models.AuditBackupCreate, snapshot.Name, clientIP(r)); err != nil {
+			log.Print("Ошибка при записи в журнал безопасности:\n", err)
+		}
+	}
+
+	snapshots, err := h.backupStore.List()
+	if err != nil {
+		http.Error(w, "Ошибка при попытке загрузить резервные копии", http.StatusInternalServerError)
+		return
+	}
+	components.BackupTable(snapshots, result).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) downloadBackup(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	name := r.PathValue("name")
+
+	path, err := h.backupStore.Path(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r) // копию удалили по политике хранения
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Пользователь %s скачал резервную копию %s", user.Username, name)
+	if err = h.auditRepo.Create(user.ID, models.AuditBackupGet, name, clientIP(r)); err != nil {
+		log.Print("Ошибка при записи в журнал безопасности:\n", err)
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
@@ -0,0 +1,22 @@
+package routes
+
+import "net/http"
+
+// setCookie выставляет служебные куки сайта: HttpOnly на весь сайт, Secure и SameSite по настройкам.
+// maxAge <= 0 создаёт куки до закрытия браузера
+func (h *BaseHandler) setCookie(w http.ResponseWriter, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.config.CookieSecure,
+		SameSite: h.config.SameSite(),
+	})
+}
+
+// clearCookie удаляет куки, выставленное через setCookie
+func (h *BaseHandler) clearCookie(w http.ResponseWriter, name string) {
+	h.setCookie(w, name, "", -1)
+}
@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/svuvi/theweek/components"
+)
+
+// Токен передаётся htmx в заголовке (см. hx-headers в layouts.Base) или обычной формой в скрытом поле.
+// Формы с файлами передают его только в заголовке
+const (
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+	// Куки с токеном для посетителей без сессии: формы входа, регистрации и восстановления пароля
+	csrfCookie = "csrf_token"
+)
+
+// csrfProtect проверяет CSRF-токен у всех запросов, меняющих состояние, и кладёт токен в контекст для шаблонов
+func (h *BaseHandler) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicCacheable(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := h.csrfToken(w, r)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			sent := r.Header.Get(csrfHeader)
+			if sent == "" && isURLEncodedForm(r) {
+				r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxFormSize)
+				sent = r.PostFormValue(csrfField)
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				log.Printf("Отклонён запрос %s %s с неверным CSRF-токеном, IP: %s", r.Method, r.URL.Path, r.RemoteAddr)
+				http.Error(w, "Недействительный токен формы. Обновите страницу и попробуйте ещё раз", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(components.WithCSRFToken(r.Context(), token)))
+	})
+}
+
+// isURLEncodedForm сообщает, что тело запроса - обычная форма, из которой можно взять скрытое поле с токеном.
+// Формы с файлами отправляют htmx и media.js, а они всегда передают токен заголовком. Разбирать такое тело
+// до проверки токена нельзя: ParseMultipartForm пишет большие файлы во временную папку
+func isURLEncodedForm(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// publicCacheable сообщает, что по адресу лежат файлы или ленты с Cache-Control: public. В них нет форм,
+// а куки с токеном в таком ответе попала бы в общий кэш прокси и досталась бы другим посетителям
+func publicCacheable(path string) bool {
+	return strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/images/") ||
+		strings.HasSuffix(path, "/feed.xml") || strings.HasSuffix(path, "/atom.xml")
+}
+
+// csrfToken возвращает токен текущего посетителя.
+// При наличии сессии токен выводится из её ключа, так что у каждой сессии он свой и хранить его не нужно.
+// Без сессии используется случайный токен из куки, который создаётся при первом запросе
+func (h *BaseHandler) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if sessionKey, err := getSessionKey(r); err == nil {
+		mac := hmac.New(sha256.New, []byte(sessionKey))
+		mac.Write([]byte("csrf"))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	if cookie, err := r.Cookie(csrfCookie); err == nil && len(cookie.Value) == 64 {
+		if _, err = hex.DecodeString(cookie.Value); err == nil {
+			return cookie.Value
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Print("Ошибка при генерации CSRF-токена:\n", err)
+	}
+	token := hex.EncodeToString(b)
+	h.setCookie(w, csrfCookie, token, 0)
+	return token
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/config"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	h := &BaseHandler{config: &config.Config{MaxFormSize: 1 << 20}}
+	handler := h.csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(components.CSRFToken(r.Context())))
+	}))
+	const token = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		cookie     string // значение куки csrf_token в запросе
+		header     string // значение X-CSRF-Token
+		field      string // значение csrf_token в форме
+		wantStatus int
+		wantCookie bool // ответ выставляет куки с токеном
+	}{
+		{"страница без куки получает токен", "GET", "/login", "", "", "", 200, true},
+		{"страница с куки", "GET", "/login", token, "", "", 200, false},
+		{"лента RSS", "GET", "/feed.xml", "", "", "", 200, false},
+		{"лента Atom рубрики", "GET", "/section/news/atom.xml", "", "", "", 200, false},
+		{"картинка", "GET", "/images/1", "", "", "", 200, false},
+		{"статика", "GET", "/static/style.css", "", "", "", 200, false},
+		{"POST без токена", "POST", "/login", token, "", "", 403, false},
+		{"POST с чужим токеном", "POST", "/login", token, strings.Repeat("f", 64), "", 403, false},
+		{"POST с токеном в заголовке", "POST", "/login", token, token, "", 200, false},
+		{"POST с токеном в форме", "POST", "/login", token, "", token, 200, false},
+		{"POST без куки", "POST", "/login", "", token, "", 403, true},
+		{"форма с файлами и токеном только в поле", "POST", "/dashboard/media/upload", token, "", token, 403, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(csrfField+"="+tt.field))
+			switch {
+			case strings.HasPrefix(tt.path, "/dashboard/media/"):
+				r = httptest.NewRequest(tt.method, tt.path, strings.NewReader(multipartField(csrfField, tt.field)))
+				r.Header.Set("Content-Type", "multipart/form-data; boundary="+testBoundary)
+			case tt.field != "":
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(csrfHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("код ответа %d, ожидался %d", w.Code, tt.wantStatus)
+			}
+			gotCookie := strings.Contains(w.Header().Get("Set-Cookie"), csrfCookie+"=")
+			if gotCookie != tt.wantCookie {
+				t.Errorf("Set-Cookie: %q", w.Header().Get("Set-Cookie"))
+			}
+			if tt.cookie != "" && w.Code == 200 && !publicCacheable(tt.path) && w.Body.String() != tt.cookie {
+				t.Errorf("в шаблоны передан токен %q, ожидался токен из куки", w.Body.String())
+			}
+		})
+	}
+}
+
+const testBoundary = "theweek-test-boundary"
+
+func multipartField(name, value string) string {
+	return "--" + testBoundary + "\r\nContent-Disposition: form-data; name=\"" + name + "\"\r\n\r\n" + value + "\r\n"
+}
+
+// filler отдаёт size байт и считает, сколько из них прочитано
+type filler struct {
+	size, read int64
+}
+
+func (f *filler) Read(p []byte) (int, error) {
+	if f.read >= f.size {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), f.size-f.read))
+	for i := range p[:n] {
+		p[i] = 'a'
+	}
+	f.read += int64(n)
+	return n, nil
+}
+
+// Большое тело без токена в заголовке отклоняется без чтения файлов и без выхода за MaxFormSize
+func TestCSRFProtectLargeBody(t *testing.T) {
+	const maxFormSize = 1 << 20
+	h := &BaseHandler{config: &config.Config{MaxFormSize: maxFormSize}}
+	handler := h.csrfProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("запрос без верного токена дошёл до обработчика")
+	}))
+	const token = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name        string
+		contentType string
+		prefix      string // начало тела перед 64 Мбайт заполнителя
+		maxRead     int64
+	}{
+		{
+			"файл в форме с файлами",
+			"multipart/form-data; boundary=" + testBoundary,
+			multipartField(csrfField, token) + "--" + testBoundary +
+				"\r\nContent-Disposition: form-data; name=\"image\"; filename=\"a.png\"\r\n\r\n",
+			0,
+		},
+		{"обычная форма", "application/x-www-form-urlencoded", "text=", maxFormSize + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &filler{size: 64 << 20}
+			r := httptest.NewRequest("POST", "/dashboard/media/upload", io.MultiReader(strings.NewReader(tt.prefix), body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: token})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("код ответа %d, ожидался 403", w.Code)
+			}
+			if body.read > tt.maxRead {
+				t.Errorf("прочитано %d байт тела, допустимо не больше %d", body.read, tt.maxRead)
+			}
+		})
+	}
+}
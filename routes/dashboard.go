@@ -6,33 +6,24 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/a-h/templ"
 	"github.com/google/uuid"
 	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/diff"
 	"github.com/svuvi/theweek/layouts"
 	"github.com/svuvi/theweek/models"
 )
 
 func (h *BaseHandler) dasboardPageHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
-	if !authorized || !user.IsAdmin {
-		http.Error(w, "Отказано в доступе", http.StatusUnauthorized)
-		return
-	}
-
 	layouts.DashboardHome().Render(r.Context(), w)
 }
 
 func (h *BaseHandler) dashboardUsersHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
-	if !authorized || !user.IsAdmin {
-		http.Error(w, "Отказано в доступе", http.StatusUnauthorized)
-		return
-	}
-
 	users, err := h.userRepo.GetAll()
 	if err != nil {
 		http.Error(w, "Ошибка при попытке загрузить пользователей", http.StatusInternalServerError)
@@ -45,16 +36,16 @@ func (h *BaseHandler) dashboardUsersHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	layouts.DashboardUsers(users, rCodes).Render(r.Context(), w)
-}
-
-func (h *BaseHandler) dashboardInvitesHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
-	if !authorized || !user.IsAdmin {
-		http.Error(w, "Отказано в доступе", http.StatusUnauthorized)
+	audit, err := h.auditRepo.GetRecent(50)
+	if err != nil {
+		http.Error(w, "Ошибка при попытке загрузить журнал безопасности", http.StatusInternalServerError)
 		return
 	}
 
+	layouts.DashboardUsers(users, rCodes, audit, h.admin2FARequired()).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) dashboardInvitesHandler(w http.ResponseWriter, r *http.Request) {
 	invites, err := h.inviteRepo.GetAll()
 	if err != nil {
 		http.Error(w, "Ошибка при попытке загрузить приглашения", http.StatusInternalServerError)
@@ -64,12 +55,6 @@ func (h *BaseHandler) dashboardInvitesHandler(w http.ResponseWriter, r *http.Req
 }
 
 func (h *BaseHandler) createInvite(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
-	if !authorized || !user.IsAdmin {
-		http.Error(w, "Отказано в доступе", http.StatusUnauthorized)
-		return
-	}
-
 	_, err := h.inviteRepo.Create()
 	if err != nil {
 		http.Error(w, "Ошибка при попытке создать приглашение", http.StatusInternalServerError)
@@ -86,12 +71,6 @@ func (h *BaseHandler) createInvite(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *BaseHandler) deleteInvite(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
-	if !authorized || !user.IsAdmin {
-		http.Error(w, "Отказано в доступе", http.StatusUnauthorized)
-		return
-	}
-
 	if err := uuid.Validate(r.PathValue("code")); err != nil {
 		http.Error(w, "Невалидный формат кода", http.StatusBadRequest)
 		return
@@ -105,17 +84,119 @@ func (h *BaseHandler) deleteInvite(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *BaseHandler) dashboardPublishing(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
-	if !user.IsAdmin {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+func (h *BaseHandler) dashboardArticlesHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	// Авторы видят только свои статьи
+	var articles []*models.Article
+	var err error
+	if user.Can(models.PermissionEditAllArticles) {
+		articles, err = h.articleRepo.GetAll()
+	} else {
+		articles, err = h.articleRepo.GetAllByAuthor(user.ID)
+	}
+	if err != nil {
+		http.Error(w, "Ошибка при попытке загрузить статьи", http.StatusInternalServerError)
+		return
+	}
+
+	layouts.DashboardArticles(articles).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) dashboardRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	articleID, err := strconv.Atoi(r.PathValue("articleID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	article, err := h.articleRepo.GetByID(articleID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !user.CanEditArticle(article) {
+		http.Error(w, "Отказано в доступе", http.StatusForbidden)
+		return
+	}
+
+	revisions, err := h.revisionRepo.GetByArticle(articleID)
+	if err != nil {
+		http.Error(w, "Ошибка при попытке загрузить историю изменений", http.StatusInternalServerError)
+		return
+	}
+
+	// Сравниваемые ревизии выбираются через ?from=ID&to=ID
+	var from, to *models.ArticleRevision
+	q := r.URL.Query()
+	fromID, _ := strconv.Atoi(q.Get("from"))
+	toID, _ := strconv.Atoi(q.Get("to"))
+	for _, rev := range revisions {
+		if rev.ID == fromID {
+			from = rev
+		}
+		if rev.ID == toID {
+			to = rev
+		}
+	}
+
+	var lines []diff.Line
+	if from != nil && to != nil {
+		lines = diff.Lines(from.Document(), to.Document())
+	}
+
+	layouts.DashboardRevisions(article, revisions, from, to, lines).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) restoreRevision(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	articleID, err := strconv.Atoi(r.PathValue("articleID"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	revisionID, err := strconv.Atoi(r.PathValue("revisionID"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
+	rev, err := h.revisionRepo.GetByID(revisionID)
+	if err != nil || rev.ArticleID != articleID {
+		http.NotFound(w, r)
+		return
+	}
+
+	article, err := h.articleRepo.GetByID(articleID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !user.CanEditArticle(article) {
+		http.Error(w, "Отказано в доступе", http.StatusForbidden)
+		return
+	}
+
+	article.Title = rev.Title
+	article.Description = rev.Description
+	article.TextMD = rev.TextMD
+	if err = h.articleRepo.Save(article, nil, user.ID); err != nil {
+		log.Printf("Ошибка при восстановлении ревизии %d статьи %d:\n%v", revisionID, articleID, err)
+		components.FormWarning("Ошибка сервера при восстановлении ревизии").Render(r.Context(), w)
+		return
+	}
+
+	log.Printf("Пользователь %s восстановил ревизию %d статьи %d", user.Username, revisionID, articleID)
+	w.Header().Set("HX-Refresh", "true")
+	components.FormOK("Ревизия восстановлена").Render(r.Context(), w)
+}
+
+func (h *BaseHandler) dashboardPublishing(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
 	idString := r.PathValue("articleID")
 
 	if idString == "" || idString == "1" {
-		layouts.PublishingPage(authorized, user, &models.Article{ID: 0}).Render(r.Context(), w)
+		layouts.PublishingPage(&models.Article{ID: 0, Status: models.StatusDraft, Authors: []string{user.Username}}).Render(r.Context(), w)
 		return
 	}
 
@@ -134,23 +215,37 @@ func (h *BaseHandler) dashboardPublishing(w http.ResponseWriter, r *http.Request
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	if !user.CanEditArticle(article) {
+		http.Error(w, "Отказано в доступе", http.StatusForbidden)
+		return
+	}
 
-	layouts.PublishingPage(authorized, user, article).Render(r.Context(), w)
+	layouts.PublishingPage(article).Render(r.Context(), w)
 }
 
 func (h *BaseHandler) publishingFormHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
-	if !authorized || !user.IsAdmin {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
-	}
-
+	user, _ := currentUser(r)
 	a := models.Article{ID: 0}
 
 	idString := r.PathValue("articleID")
 	a.ID, _ = strconv.Atoi(idString)
 
-	err := r.ParseMultipartForm(10 << 20)
+	var existing *models.Article
+	if a.ID != 0 {
+		var err error
+		existing, err = h.articleRepo.GetByID(a.ID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if !user.CanEditArticle(existing) {
+			http.Error(w, "Отказано в доступе", http.StatusForbidden)
+			return
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxFormSize)
+	err := r.ParseMultipartForm(h.config.MaxFormSize)
 	if err != nil {
 		log.Print(err)
 		http.Error(w, "Невозможно обработать данные формы", http.StatusBadRequest)
@@ -161,22 +256,54 @@ func (h *BaseHandler) publishingFormHandler(w http.ResponseWriter, r *http.Reque
 	a.Title = r.PostFormValue("title")
 	a.Description = r.PostFormValue("description")
 	a.TextMD = r.PostFormValue("textMD")
+	a.SectionID, _ = strconv.Atoi(r.PostFormValue("sectionID"))
 
-	re := regexp.MustCompile(`^[a-z0-9-]+$`)
-	match := re.MatchString(a.Slug)
+	match := slugRegexp.MatchString(a.Slug)
 	if !match {
 		slugResult := components.FormWarning("Ссылка может содержать только маленькие латинские буквы, цифры и знак \"-\"")
-		components.PublishingForm(slugResult, templ.NopComponent, &a).Render(r.Context(), w)
+		components.PublishingForm(slugResult, templ.NopComponent, templ.NopComponent, templ.NopComponent, &a).Render(r.Context(), w)
 		return
 	}
 
 	art, err := h.articleRepo.GetBySlug(a.Slug)
 	if err == nil && art.ID != a.ID {
 		slugResult := components.FormWarning("Эта ссылка уже занята")
-		components.PublishingForm(slugResult, templ.NopComponent, &a).Render(r.Context(), w)
+		components.PublishingForm(slugResult, templ.NopComponent, templ.NopComponent, templ.NopComponent, &a).Render(r.Context(), w)
+		return
+	}
+
+	var authorIDs []int
+	var authorsResult templ.Component
+	authorIDs, a.Authors, authorsResult = h.parseAuthors(r.PostFormValue("authors"))
+	if authorsResult == nil && !user.Can(models.PermissionEditAllArticles) && !slices.Contains(a.Authors, user.Username) {
+		authorsResult = components.FormWarning("Вы должны остаться в списке авторов, иначе потеряете доступ к статье")
+	}
+	if authorsResult != nil {
+		components.PublishingForm(templ.NopComponent, authorsResult, templ.NopComponent, templ.NopComponent, &a).Render(r.Context(), w)
+		return
+	}
+
+	a.Status = models.ArticleStatus(r.PostFormValue("status"))
+	if !a.Status.Valid() {
+		statusResult := components.FormWarning("Неизвестный статус статьи")
+		components.PublishingForm(templ.NopComponent, templ.NopComponent, statusResult, templ.NopComponent, &a).Render(r.Context(), w)
 		return
 	}
 
+	if a.Status == models.StatusScheduled {
+		a.PublishAt, err = time.ParseInLocation("2006-01-02T15:04", r.PostFormValue("publishAt"), time.Local)
+		if err != nil {
+			statusResult := components.FormWarning("Укажите время публикации")
+			components.PublishingForm(templ.NopComponent, templ.NopComponent, statusResult, templ.NopComponent, &a).Render(r.Context(), w)
+			return
+		}
+		if !a.PublishAt.After(time.Now()) {
+			statusResult := components.FormWarning("Время публикации должно быть в будущем")
+			components.PublishingForm(templ.NopComponent, templ.NopComponent, statusResult, templ.NopComponent, &a).Render(r.Context(), w)
+			return
+		}
+	}
+
 	// Обработка файла обложки
 	file, fileHeader, err := r.FormFile("coverImage")
 	if err != nil {
@@ -192,55 +319,79 @@ func (h *BaseHandler) publishingFormHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}()
 
+	// При редактировании сохраняем дату публикации и обложку, если новая не загружена
 	var coverImageID int
+	if existing != nil {
+		a.CreatedAt = existing.CreatedAt
+		coverImageID = existing.CoverImageID
+
+		// Дата публикации - момент, когда статья впервые стала видна читателям
+		if a.IsPublished() && !existing.IsPublished() {
+			a.CreatedAt = time.Now().UTC()
+		}
+	}
+
 	if file != nil {
-		if fileHeader.Size > 1<<20 {
-			coverResult := components.FormWarning("Файл слишком большой. Максимальный размер: 1МБ.")
-			components.PublishingForm(templ.NopComponent, coverResult, &a).Render(r.Context(), w)
+		if fileHeader.Size > h.config.MaxImageSize {
+			coverResult := components.FormWarning(fmt.Sprintf("Файл слишком большой. Максимальный размер: %s.", components.FormatSize(h.config.MaxImageSize)))
+			components.PublishingForm(templ.NopComponent, templ.NopComponent, templ.NopComponent, coverResult, &a).Render(r.Context(), w)
 			return
 		}
 		content, err := io.ReadAll(file)
 		if err != nil {
 			coverResult := components.FormWarning("Ошибка при чтении файла картинки обложки")
-			components.PublishingForm(templ.NopComponent, coverResult, &a).Render(r.Context(), w)
+			components.PublishingForm(templ.NopComponent, templ.NopComponent, templ.NopComponent, coverResult, &a).Render(r.Context(), w)
 			return
 		}
 
-		coverImageID, err = h.imageRepo.Create(fileHeader.Filename, user.ID, content)
+		coverImageID, err = h.saveImage(fileHeader.Filename, user.ID, content)
 		if err != nil {
-			log.Print(err)
-			coverResult := components.FormWarning("Ошибка при сохранении файла картинки обложки в базу данных")
-			components.PublishingForm(templ.NopComponent, coverResult, &a).Render(r.Context(), w)
+			coverResult := components.FormWarning(imageErrorMessage(err, "Ошибка при сохранении файла картинки обложки в базу данных"))
+			components.PublishingForm(templ.NopComponent, templ.NopComponent, templ.NopComponent, coverResult, &a).Render(r.Context(), w)
 			return
 		}
-	} else {
-		coverImageID = 0
 	}
-	a.CoverImageID = coverImageID
-
-	if a.ID == 0 {
-		err = h.articleRepo.Create(a.Slug, a.Title, a.TextMD, a.Description, coverImageID)
-	} else {
-		err = h.articleRepo.Update(&a)
+	if id, ok := h.coverFromLibrary(r); ok && file == nil {
+		coverImageID = id
 	}
+	a.CoverImageID = coverImageID
 
-	if err != nil {
-		log.Print(err)
-		slugResult := components.FormWarning("Внутренняя ошибка сервера")
-		components.PublishingForm(slugResult, templ.NopComponent, &a).Render(r.Context(), w)
+	if err = h.articleRepo.Save(&a, authorIDs, user.ID); err != nil {
+		log.Printf("Ошибка при сохранении статьи %s:\n%v", a.Slug, err)
+		slugResult := components.FormWarning("Внутренняя ошибка сервера, статья не сохранена")
+		components.PublishingForm(slugResult, templ.NopComponent, templ.NopComponent, templ.NopComponent, &a).Render(r.Context(), w)
 		return
 	}
 
-	components.PublishingSuccessful(a.Slug).Render(r.Context(), w)
+	components.PublishingSuccessful(&a).Render(r.Context(), w)
 }
 
-func (h *BaseHandler) createRecoveryCodeForm(w http.ResponseWriter, r *http.Request) {
-	_, user := isAuthorised(r, h)
-	if !user.IsAdmin {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
+// parseAuthors превращает список логинов через запятую в ID пользователей, сохраняя порядок.
+// Возвращает также очищенный список логинов и предупреждение для формы публикации при ошибке
+func (h *BaseHandler) parseAuthors(value string) ([]int, []string, templ.Component) {
+	var usernames []string
+	for _, username := range strings.Split(value, ",") {
+		username = strings.TrimSpace(username)
+		if username != "" && !slices.Contains(usernames, username) {
+			usernames = append(usernames, username)
+		}
 	}
+	if len(usernames) == 0 {
+		return nil, usernames, components.FormWarning("Укажите хотя бы одного автора")
+	}
+
+	ids := make([]int, 0, len(usernames))
+	for _, username := range usernames {
+		u, err := h.userRepo.GetByUsername(username)
+		if err != nil {
+			return nil, usernames, components.FormWarning(fmt.Sprintf("Пользователь «%s» не найден", username))
+		}
+		ids = append(ids, u.ID)
+	}
+	return ids, usernames, nil
+}
 
+func (h *BaseHandler) createRecoveryCodeForm(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
 		result := components.FormWarning("Ошибка в обработке формы")
@@ -275,12 +426,7 @@ func (h *BaseHandler) createRecoveryCodeForm(w http.ResponseWriter, r *http.Requ
 }
 
 func (h *BaseHandler) deleteRecoveryCode(w http.ResponseWriter, r *http.Request) {
-	_, user := isAuthorised(r, h)
-	if !user.IsAdmin {
-		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-		return
-	}
-
+	user, _ := currentUser(r)
 	rCodeID, err := strconv.Atoi(r.PathValue("rCodeID"))
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
@@ -296,3 +442,191 @@ func (h *BaseHandler) deleteRecoveryCode(w http.ResponseWriter, r *http.Request)
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (h *BaseHandler) dashboardSectionsHandler(w http.ResponseWriter, r *http.Request) {
+	sections, err := h.sectionRepo.GetAll()
+	if err != nil {
+		http.Error(w, "Ошибка при попытке загрузить рубрики", http.StatusInternalServerError)
+		return
+	}
+
+	layouts.DashboardSections(sections).Render(r.Context(), w)
+}
+
+// parseSectionForm читает поля рубрики из формы. При невалидных данных возвращает предупреждение для пользователя
+func parseSectionForm(r *http.Request) (*models.Section, templ.Component) {
+	if err := r.ParseForm(); err != nil {
+		return nil, components.FormWarning("Ошибка в обработке формы")
+	}
+
+	s := &models.Section{
+		Slug:        r.PostFormValue("slug"),
+		Name:        strings.TrimSpace(r.PostFormValue("name")),
+		InNavTop:    r.PostFormValue("inNavTop") != "",
+		InNavBottom: r.PostFormValue("inNavBottom") != "",
+	}
+
+	if !slugRegexp.MatchString(s.Slug) {
+		return nil, components.FormWarning("Ссылка может содержать только маленькие латинские буквы, цифры и знак \"-\"")
+	}
+	if s.Name == "" {
+		return nil, components.FormWarning("Название не может быть пустым")
+	}
+
+	position, err := strconv.Atoi(r.PostFormValue("position"))
+	if err != nil {
+		return nil, components.FormWarning("Порядок должен быть целым числом")
+	}
+	s.Position = position
+
+	return s, nil
+}
+
+func (h *BaseHandler) createSection(w http.ResponseWriter, r *http.Request) {
+	s, warning := parseSectionForm(r)
+	if warning != nil {
+		components.CreateSectionForm(warning).Render(r.Context(), w)
+		return
+	}
+
+	if _, err := h.sectionRepo.GetBySlug(s.Slug); err == nil {
+		components.CreateSectionForm(components.FormWarning("Эта ссылка уже занята")).Render(r.Context(), w)
+		return
+	}
+
+	s, err := h.sectionRepo.Create(s.Slug, s.Name, s.InNavTop, s.InNavBottom, s.Position)
+	if err != nil {
+		log.Print(err)
+		components.CreateSectionForm(components.FormWarning("Ошибка сервера при создании рубрики")).Render(r.Context(), w)
+		return
+	}
+
+	sections, err := h.sectionRepo.GetAll()
+	if err != nil {
+		http.Error(w, "Ошибка при попытке загрузить рубрики", http.StatusInternalServerError)
+		return
+	}
+
+	components.CreateSectionForm(components.FormOK(fmt.Sprintf("Создана рубрика «%s»", s.Name))).Render(r.Context(), w)
+	components.SectionTable(sections, true).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) updateSection(w http.ResponseWriter, r *http.Request) {
+	sectionID, err := strconv.Atoi(r.PathValue("sectionID"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.sectionRepo.GetByID(sectionID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s, warning := parseSectionForm(r)
+	if warning != nil {
+		components.SectionRow(existing, warning).Render(r.Context(), w)
+		return
+	}
+	s.ID = sectionID
+
+	if other, err := h.sectionRepo.GetBySlug(s.Slug); err == nil && other.ID != s.ID {
+		components.SectionRow(existing, components.FormWarning("Эта ссылка уже занята")).Render(r.Context(), w)
+		return
+	}
+
+	if err = h.sectionRepo.Update(s); err != nil {
+		log.Print(err)
+		components.SectionRow(existing, components.FormWarning("Ошибка сервера при сохранении рубрики")).Render(r.Context(), w)
+		return
+	}
+
+	components.SectionRow(s, components.FormOK("Сохранено")).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) deleteSection(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	sectionID, err := strconv.Atoi(r.PathValue("sectionID"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err = h.sectionRepo.Delete(sectionID); err != nil {
+		log.Printf("Ошибка при удалении рубрики\nsectionID: %d\nПользователь: %s\nОшибка: %v", sectionID, user.Username, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *BaseHandler) setUserRole(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Администратор не может понизить сам себя, чтобы на сайте не осталось никого с доступом к ролям
+	if target.ID == user.ID {
+		components.UserRoleForm(target, components.FormWarning("Нельзя изменить собственную роль")).Render(r.Context(), w)
+		return
+	}
+
+	role := models.Role(r.PostFormValue("role"))
+	if !role.Valid() {
+		components.UserRoleForm(target, components.FormWarning("Неизвестная роль")).Render(r.Context(), w)
+		return
+	}
+
+	if err = h.userRepo.SetRole(target.ID, role); err != nil {
+		log.Printf("Ошибка при назначении роли %s пользователю %s:\n%v", role, target.Username, err)
+		components.UserRoleForm(target, components.FormWarning("Ошибка сервера при сохранении роли")).Render(r.Context(), w)
+		return
+	}
+
+	log.Printf("Администратор %s назначил пользователю %s роль %s (была %s)", user.Username, target.Username, role, target.Role)
+	target.Role = role
+	components.UserRoleForm(target, components.FormOK("Сохранено")).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) unlockUser(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err = h.userRepo.Unlock(target.ID); err != nil {
+		log.Printf("Ошибка при разблокировке входа пользователя %s:\n%v", target.Username, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	h.usernameLimiter.Reset(strings.ToLower(target.Username))
+
+	details := fmt.Sprintf("Разблокировал %s", user.Username)
+	log.Printf("Администратор %s снял блокировку входа пользователя %s", user.Username, target.Username)
+	if err = h.auditRepo.Create(target.ID, models.AuditLoginUnlock, details, clientIP(r)); err != nil {
+		log.Print("Ошибка при записи в журнал безопасности:\n", err)
+	}
+
+	target.FailedLogins = 0
+	target.LockedUntil = time.Time{}
+	components.UserLockStatus(target).Render(r.Context(), w)
+}
@@ -0,0 +1,291 @@
+package routes
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/models"
+)
+
+const (
+	siteTagline   = "Новости Урбанойда"
+	siteDesc      = "Крупнейшее медиа Урбанойда"
+	feedItemLimit = 20
+)
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	SelfLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description"`
+	Content     cdata         `xml:"content:encoded"`
+	PubDate     string        `xml:"pubDate"`
+	GUID        rssGUID       `xml:"guid"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang    string      `xml:"xml:lang,attr"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Links     []atomLink  `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Summary   string      `xml:"summary"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int    `xml:"length,attr,omitempty"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (h *BaseHandler) rssHandler(w http.ResponseWriter, r *http.Request) {
+	h.serveFeed(w, r, nil, "rss")
+}
+
+func (h *BaseHandler) atomHandler(w http.ResponseWriter, r *http.Request) {
+	h.serveFeed(w, r, nil, "atom")
+}
+
+func (h *BaseHandler) sectionRSSHandler(w http.ResponseWriter, r *http.Request) {
+	section, err := h.sectionRepo.GetBySlug(r.PathValue("slug"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.serveFeed(w, r, section, "rss")
+}
+
+func (h *BaseHandler) sectionAtomHandler(w http.ResponseWriter, r *http.Request) {
+	section, err := h.sectionRepo.GetBySlug(r.PathValue("slug"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.serveFeed(w, r, section, "atom")
+}
+
+// serveFeed отдаёт RSS или Atom ленту главной страницы (section = nil) или рубрики.
+// Перед загрузкой статей проверяет условные заголовки запроса
+func (h *BaseHandler) serveFeed(w http.ResponseWriter, r *http.Request, section *models.Section, format string) {
+	sectionID := 0
+	if section != nil {
+		sectionID = section.ID
+	}
+
+	lastModified, count, err := h.articleRepo.FeedState(sectionID)
+	if err != nil {
+		log.Print("Ошибка при попытке получить состояние ленты:\n", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Название и адрес рубрики тоже есть в ленте
+	if section != nil && section.UpdatedAt.After(lastModified) {
+		lastModified = section.UpdatedAt
+	}
+
+	etag := fmt.Sprintf(`W/"%s-%d-%d-%d"`, format, sectionID, lastModified.Unix(), count)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if checkNotModified(w, r, etag, lastModified) {
+		return
+	}
+
+	articles, err := h.articleRepo.GetLatestPublished(sectionID, feedItemLimit)
+	if err != nil {
+		log.Print("Ошибка при попытке загрузить статьи для ленты:\n", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	title, link := fmt.Sprint(h.config.SiteName, " - ", siteTagline), h.config.BaseURL+"/"
+	if section != nil {
+		title = fmt.Sprint(section.Name, " - ", h.config.SiteName)
+		link = fmt.Sprint(h.config.BaseURL, "/section/", section.Slug)
+	}
+	self := h.config.BaseURL + r.URL.Path
+
+	var feed any
+	contentType := "application/rss+xml; charset=utf-8"
+	if format == "atom" {
+		feed = h.buildAtom(articles, title, link, self, lastModified)
+		contentType = "application/atom+xml; charset=utf-8"
+	} else {
+		feed = h.buildRSS(articles, title, link, self, lastModified)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Print("Ошибка при записи ленты:\n", err)
+	}
+}
+
+func (h *BaseHandler) buildRSS(articles []*models.Article, title, link, self string, lastModified time.Time) *rssFeed {
+	feed := &rssFeed{
+		Version:   "2.0",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        link,
+			Description: siteDesc,
+			Language:    "ru-RU",
+			SelfLink:    atomLink{Href: self, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if !lastModified.IsZero() {
+		feed.Channel.LastBuildDate = lastModified.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, a := range articles {
+		item := rssItem{
+			Title:       a.Title,
+			Link:        h.articleURL(a),
+			Description: a.Description,
+			Content:     cdata{h.absoluteURLs(components.MarkdownToHTML(a.TextMD))},
+			PubDate:     a.CreatedAt.UTC().Format(time.RFC1123Z),
+			GUID:        rssGUID{IsPermaLink: false, Value: articleGUID(a)},
+		}
+		if img := h.coverImageMeta(a); img != nil {
+			item.Enclosure = &rssEnclosure{
+				URL:    fmt.Sprint(h.config.BaseURL, "/images/", img.ID),
+				Length: img.Size,
+				Type:   img.MimeType,
+			}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return feed
+}
+
+func (h *BaseHandler) buildAtom(articles []*models.Article, title, link, self string, lastModified time.Time) *atomFeed {
+	feed := &atomFeed{
+		Lang:    "ru-RU",
+		Title:   title,
+		ID:      link,
+		Updated: lastModified.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	for _, a := range articles {
+		entry := atomEntry{
+			Title:     a.Title,
+			ID:        articleGUID(a),
+			Links:     []atomLink{{Href: h.articleURL(a), Rel: "alternate", Type: "text/html"}},
+			Published: a.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   a.UpdatedAt.UTC().Format(time.RFC3339),
+			Summary:   a.Description,
+			Content:   atomContent{Type: "html", Value: h.absoluteURLs(components.MarkdownToHTML(a.TextMD))},
+		}
+		if img := h.coverImageMeta(a); img != nil {
+			entry.Links = append(entry.Links, atomLink{
+				Href:   fmt.Sprint(h.config.BaseURL, "/images/", img.ID),
+				Rel:    "enclosure",
+				Type:   img.MimeType,
+				Length: img.Size,
+			})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+// coverImageMeta возвращает метаданные обложки статьи или nil, если обложки нет
+func (h *BaseHandler) coverImageMeta(a *models.Article) *models.Image {
+	if a.CoverImageID == 0 {
+		return nil
+	}
+	img, err := h.imageRepo.GetMeta(a.CoverImageID)
+	if err != nil {
+		log.Printf("Ошибка при попытке получить обложку статьи с ID=%d:\n%v", a.ID, err)
+		return nil
+	}
+	return img
+}
+
+func (h *BaseHandler) articleURL(a *models.Article) string {
+	return fmt.Sprint(h.config.BaseURL, "/", a.Slug)
+}
+
+// articleGUID не зависит от ссылки статьи, поэтому не меняется при смене slug.
+// По той же причине домен в нём не берётся из настроек: при переезде сайта читалки не должны показать все статьи заново
+func articleGUID(a *models.Article) string {
+	return fmt.Sprintf("tag:theweek.svuvich.nl,2024:article-%d", a.ID)
+}
+
+// absoluteURLs делает ссылки и картинки с путями от корня сайта абсолютными, чтобы они работали в читалках
+func (h *BaseHandler) absoluteURLs(html string) string {
+	html = strings.ReplaceAll(html, `src="/`, `src="`+h.config.BaseURL+"/")
+	html = strings.ReplaceAll(html, `href="/`, `href="`+h.config.BaseURL+"/")
+	// В srcset несколько адресов через запятую
+	return srcsetRegexp.ReplaceAllStringFunc(html, func(attr string) string {
+		attr = strings.Replace(attr, `srcset="/`, `srcset="`+h.config.BaseURL+"/", 1)
+		return strings.ReplaceAll(attr, ", /", ", "+h.config.BaseURL+"/")
+	})
+}
+
+var srcsetRegexp = regexp.MustCompile(`srcset="[^"]*"`)
@@ -1,38 +1,17 @@
 package routes
 
 import (
-	"log"
+	"net"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/svuvi/theweek/models"
 )
 
-// Также обновляет last_use
-func isAuthorised(r *http.Request, h *BaseHandler) (bool, *models.User) {
-	user := new(models.User)
-	value, err := getSessionKey(r)
-	if err != nil {
-		return false, user
-	}
-
-	session, err := h.sessionRepo.GetSessionByKey(value)
-	if err != nil || !session.IsActive {
-		return false, user
-	}
-
-	user, err = h.userRepo.GetByID(session.UserID)
-	if err != nil {
-		// невозможный сценарий
-		return false, user
-	}
-
-	if err = h.sessionRepo.UpdateLastUsedByID(session.ID); err != nil {
-		log.Printf("Ошибка при попытке обновить поле last_use для сессии с ID=%d:\n%v", session.ID, err)
-	}
-
-	return true, user
-}
+// Допустимый формат ссылок статей и рубрик
+var slugRegexp = regexp.MustCompile(`^[a-z0-9-]+$`)
 
 // getSessionKey читает и валидирует "session_key" куки из запроса.
 // Возвращает куки если это валидная uuid-строка и nil. Иначе, возвращает пустую строку и ошибку.
@@ -62,9 +41,48 @@ func getInviteCode(r *http.Request) (string, error) {
 	return cookie.Value, nil
 }
 
+// clientIP возвращает IP-адрес клиента без порта
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func acceptablePassword(password string) bool {
 	if len(password) < 6 || len(password) > 72 {
 		return false
 	}
 	return true
 }
+
+// checkNotModified выставляет ETag и Last-Modified и проверяет условные заголовки запроса.
+// Если клиент уже имеет актуальную версию, отвечает 304 и возвращает true
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match имеет приоритет над If-Modified-Since
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				w.WriteHeader(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err == nil && !lastModified.Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
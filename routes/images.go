@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/svuvi/theweek/blobstore"
+	"github.com/svuvi/theweek/imaging"
+	"github.com/svuvi/theweek/models"
+)
+
+// imageHandler отдаёт картинку. С параметром w отдаётся самая узкая копия не уже w пикселей,
+// а если такой нет - оригинал. Браузерам, которые принимают WebP, отдаётся WebP-вариант, если он есть
+func (h *BaseHandler) imageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("imageID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	width := 0
+	if v := r.URL.Query().Get("w"); v != "" {
+		if width, err = strconv.Atoi(v); err != nil || width < 1 {
+			http.Error(w, "Параметр w должен быть положительным числом", http.StatusBadRequest)
+			return
+		}
+	}
+
+	img, err := h.imageRepo.GetMeta(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Ошибка при загрузке картинки %d:\n%v", id, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Картинки, загруженные до появления обработки, отдаются как есть
+	blobKey, mimeType := img.BlobKey, img.MimeType
+	if img.Width > 0 {
+		renditions, err := h.imageRepo.GetRenditions(id)
+		if err != nil {
+			log.Printf("Ошибка при загрузке копий картинки %d:\n%v", id, err)
+		}
+		if rd := pickRendition(img, renditions, width, strings.Contains(r.Header.Get("Accept"), "image/webp")); rd != nil {
+			blobKey, mimeType = rd.BlobKey, rd.MimeType
+		}
+	}
+
+	// Картинка по адресу не меняется: новая загрузка получает новый ID. Ключ содержимого - его SHA-256,
+	// поэтому он же служит ETag, а WebP и обычный вариант различаются заголовком Vary
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if checkNotModified(w, r, `"`+blobKey+`"`, img.UploadedAt) {
+		return
+	}
+
+	content, err := h.imageRepo.OpenContent(r.Context(), blobKey)
+	if err != nil {
+		log.Printf("Ошибка при открытии файла картинки %d:\n%v", id, err)
+		// Ошибку кэшировать нельзя
+		for _, header := range []string{"Cache-Control", "ETag", "Last-Modified"} {
+			w.Header().Del(header)
+		}
+		if errors.Is(err, blobstore.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	// Без Content-Type ServeContent сам определит тип по первым байтам
+	if mimeType != "" && mimeType != "application/octet-stream" {
+		w.Header().Set("Content-Type", mimeType)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, img.Filename))
+
+	http.ServeContent(w, r, "", img.UploadedAt, content)
+}
+
+// pickRendition выбирает копию для ширины width (0 - оригинал). Возвращает nil, если подходит сам оригинал.
+// Копии в формате оригинала есть для каждой ширины, WebP-варианты - только там, где они меньше
+func pickRendition(img *models.Image, renditions []*models.ImageRendition, width int, acceptWebP bool) *models.ImageRendition {
+	target := img.Width
+	if width > 0 && width < img.Width {
+		for _, rd := range renditions {
+			if rd.MimeType != "image/webp" && rd.Width >= width {
+				target = rd.Width
+				break
+			}
+		}
+	}
+
+	var base, webp *models.ImageRendition
+	for _, rd := range renditions {
+		if rd.Width != target {
+			continue
+		}
+		if rd.MimeType == "image/webp" {
+			webp = rd
+		} else {
+			base = rd
+		}
+	}
+	if acceptWebP && webp != nil {
+		return webp
+	}
+	return base
+}
+
+// saveImage проверяет загруженную картинку, убирает из неё метаданные и сохраняет вместе с копиями.
+// Ошибки imaging.ErrUnsupported и imaging.ErrTooLarge можно показать пользователю как есть
+func (h *BaseHandler) saveImage(filename string, userID int, content []byte) (int, error) {
+	img, renditions, err := imaging.Process(content)
+	if err != nil {
+		return 0, err
+	}
+	img.Filename, img.UploadedBy = filename, userID
+	return h.imageRepo.Create(img, renditions)
+}
+
+// imageErrorMessage возвращает текст для формы: понятную причину, если картинка не подошла, или fallback
+func imageErrorMessage(err error, fallback string) string {
+	if errors.Is(err, imaging.ErrUnsupported) || errors.Is(err, imaging.ErrTooLarge) {
+		return err.Error()
+	}
+	log.Print(err)
+	return fallback
+}
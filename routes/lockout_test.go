@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/svuvi/theweek/models"
+)
+
+// lockoutUsers хранит счётчики неудачных попыток вместо базы. Остальные методы UserRepository не вызываются
+type lockoutUsers struct {
+	models.UserRepository
+	failed      map[int]int
+	lockedUntil map[int]time.Time
+}
+
+// RecordFailedLogin ведёт себя как UserRepo: истёкшая блокировка снимается, и счёт начинается заново
+func (u *lockoutUsers) RecordFailedLogin(id int, now time.Time) (int, error) {
+	if until, ok := u.lockedUntil[id]; ok && !until.After(now) {
+		delete(u.lockedUntil, id)
+		u.failed[id] = 0
+	}
+	u.failed[id]++
+	return u.failed[id], nil
+}
+
+func (u *lockoutUsers) Lock(id int, until time.Time) error {
+	u.lockedUntil[id] = until
+	return nil
+}
+
+type memoryAudit struct {
+	models.AuditRepository
+	events []models.AuditEvent
+}
+
+func (a *memoryAudit) Create(userID int, event models.AuditEvent, details, ip string) error {
+	a.events = append(a.events, event)
+	return nil
+}
+
+func TestRecordFailedLogin(t *testing.T) {
+	users := &lockoutUsers{failed: map[int]int{}, lockedUntil: map[int]time.Time{}}
+	audit := &memoryAudit{}
+	h := &BaseHandler{userRepo: users, auditRepo: audit}
+	user := &models.User{ID: 7, Username: "anna"}
+
+	// fail делает n неудачных попыток и проверяет, что блокировка появилась ровно на последней из них
+	fail := func(n int) {
+		t.Helper()
+		for attempt := 1; attempt <= n; attempt++ {
+			h.recordFailedLogin(user, "192.0.2.1")
+			until, locked := users.lockedUntil[user.ID]
+			if attempt < n {
+				if locked {
+					t.Fatalf("попытка %d: вход заблокирован раньше времени", attempt)
+				}
+				continue
+			}
+			if !locked {
+				t.Fatalf("попытка %d: вход не заблокирован", attempt)
+			}
+			if d := time.Until(until); d <= lockoutDuration-time.Minute || d > lockoutDuration {
+				t.Errorf("попытка %d: блокировка на %v, ожидалось %v", attempt, d, lockoutDuration)
+			}
+		}
+	}
+
+	fail(maxFailedLogins)
+
+	// После окончания блокировки одна неверная попытка не блокирует вход снова: счёт начинается заново
+	users.lockedUntil[user.ID] = time.Now().Add(-time.Second)
+	fail(maxFailedLogins)
+
+	if len(audit.events) != 2 || audit.events[0] != models.AuditLoginLockout || audit.events[1] != models.AuditLoginLockout {
+		t.Errorf("журнал безопасности: %v", audit.events)
+	}
+}
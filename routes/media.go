@@ -0,0 +1,225 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/layouts"
+	"github.com/svuvi/theweek/models"
+)
+
+func (h *BaseHandler) dashboardMediaHandler(w http.ResponseWriter, r *http.Request) {
+	images, err := h.imageRepo.List()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "Ошибка при попытке загрузить картинки", http.StatusInternalServerError)
+		return
+	}
+
+	layouts.DashboardMedia(images, h.config.MaxImageSize).Render(r.Context(), w)
+}
+
+// uploadMedia сохраняет одну или несколько картинок из поля images и отвечает строками таблицы медиатеки.
+// Файлы, которые не удалось сохранить, не мешают остальным: вместо них возвращается строка с причиной
+func (h *BaseHandler) uploadMedia(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxFormSize)
+	if err := r.ParseMultipartForm(h.config.MaxFormSize); err != nil {
+		components.MediaUploadWarning("Форма", fmt.Sprintf("не удалось обработать, за раз можно загрузить до %s", components.FormatSize(h.config.MaxFormSize))).Render(r.Context(), w)
+		return
+	}
+
+	for _, fileHeader := range r.MultipartForm.File["images"] {
+		id, warning := h.saveUploadedImage(fileHeader, user.ID)
+		if warning != "" {
+			components.MediaUploadWarning(fileHeader.Filename, warning).Render(r.Context(), w)
+			continue
+		}
+
+		img, err := h.imageRepo.GetMeta(id)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		components.MediaRow(&models.LibraryImage{Image: *img, Uploader: user.Username}, components.FormOK("Загружено")).Render(r.Context(), w)
+	}
+}
+
+// saveUploadedImage читает и сохраняет загруженный файл. Возвращает ID картинки или текст ошибки для пользователя
+func (h *BaseHandler) saveUploadedImage(fileHeader *multipart.FileHeader, userID int) (int, string) {
+	if fileHeader.Size > h.config.MaxImageSize {
+		return 0, fmt.Sprintf("файл слишком большой, максимальный размер: %s", components.FormatSize(h.config.MaxImageSize))
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Print(err)
+		return 0, "ошибка при чтении файла"
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		log.Print(err)
+		return 0, "ошибка при чтении файла"
+	}
+
+	id, err := h.saveImage(fileHeader.Filename, userID, content)
+	if err != nil {
+		return 0, imageErrorMessage(err, "ошибка при сохранении картинки")
+	}
+	return id, ""
+}
+
+// uploadInlineImage сохраняет картинку, перетащенную или вставленную в текст статьи, и отвечает
+// Markdown для вставки. Ответ читает скрипт media.js, ошибку он показывает пользователю как есть
+func (h *BaseHandler) uploadInlineImage(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxFormSize)
+	if err := r.ParseMultipartForm(h.config.MaxFormSize); err != nil {
+		http.Error(w, "Невозможно обработать данные формы", http.StatusBadRequest)
+		return
+	}
+	_, fileHeader, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "Файл не передан", http.StatusBadRequest)
+		return
+	}
+
+	id, warning := h.saveUploadedImage(fileHeader, user.ID)
+	if warning != "" {
+		http.Error(w, warning, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, components.MarkdownImageSnippet(&models.Image{ID: id, Filename: fileHeader.Filename}))
+}
+
+func (h *BaseHandler) renameImage(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	img, ok := h.libraryImage(w, r)
+	if !ok {
+		return
+	}
+	if !user.CanManageImage(&img.Image) {
+		http.Error(w, "Отказано в доступе", http.StatusForbidden)
+		return
+	}
+
+	filename := strings.TrimSpace(r.PostFormValue("filename"))
+	if filename == "" {
+		components.MediaRow(img, components.FormWarning("Имя файла не может быть пустым")).Render(r.Context(), w)
+		return
+	}
+
+	if err := h.imageRepo.ChangeFilename(img.ID, filename); err != nil {
+		log.Printf("Ошибка при переименовании картинки %d:\n%v", img.ID, err)
+		components.MediaRow(img, components.FormWarning("Ошибка сервера при сохранении имени")).Render(r.Context(), w)
+		return
+	}
+	img.Filename = filename
+
+	components.MediaRow(img, components.FormOK("Сохранено")).Render(r.Context(), w)
+}
+
+// deleteImage удаляет картинку, если она нигде не используется. Иначе строка таблицы возвращается с предупреждением
+func (h *BaseHandler) deleteImage(w http.ResponseWriter, r *http.Request, user *models.User, id int) {
+	img, err := h.imageRepo.GetMeta(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !user.CanManageImage(img) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	usages, err := h.imageRepo.DeleteUnused(id)
+	if err != nil {
+		log.Printf("Ошибка при удалении картинки\nimageID: %d\nПользователь: %s\nОшибка: %v", id, user.Username, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if usages > 0 {
+		row := &models.LibraryImage{Image: *img, Usages: usages}
+		row.Uploader = h.uploaderName(img.UploadedBy)
+		components.MediaRow(row, components.FormWarning("Картинка используется в статьях, их прошлых версиях или аватарах")).Render(r.Context(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// coverPickerHandler отдаёт список картинок для выбора обложки в форме публикации
+func (h *BaseHandler) coverPickerHandler(w http.ResponseWriter, r *http.Request) {
+	images, err := h.imageRepo.ListMeta()
+	if err != nil {
+		log.Print(err)
+		components.FormWarning("Ошибка при попытке загрузить картинки").Render(r.Context(), w)
+		return
+	}
+	selected, _ := strconv.Atoi(r.URL.Query().Get("selected"))
+
+	components.CoverPicker(images, selected).Render(r.Context(), w)
+}
+
+// libraryImage загружает картинку из {imageID} вместе с логином загрузившего и количеством использований.
+// При ошибке сам отвечает клиенту и возвращает false
+func (h *BaseHandler) libraryImage(w http.ResponseWriter, r *http.Request) (*models.LibraryImage, bool) {
+	id, err := strconv.Atoi(r.PathValue("imageID"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, false
+	}
+
+	img, err := h.imageRepo.GetMeta(id)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка при загрузке картинки %d:\n%v", id, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	row := &models.LibraryImage{Image: *img}
+	row.Uploader = h.uploaderName(img.UploadedBy)
+	if row.Usages, err = h.imageRepo.Usages(id); err != nil {
+		log.Printf("Ошибка при подсчёте использований картинки %d:\n%v", id, err)
+	}
+	return row, true
+}
+
+// uploaderName возвращает логин загрузившего картинку или пустую строку, если пользователь удалён
+func (h *BaseHandler) uploaderName(userID int) string {
+	u, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
+
+// coverFromLibrary возвращает обложку, выбранную в CoverPicker. ok = false, если выбор не делался
+// или выбранной картинки нет
+func (h *BaseHandler) coverFromLibrary(r *http.Request) (id int, ok bool) {
+	if !r.PostForm.Has("coverImageID") {
+		return 0, false
+	}
+	id, err := strconv.Atoi(r.PostFormValue("coverImageID"))
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	if id != 0 {
+		if _, err = h.imageRepo.GetMeta(id); err != nil {
+			return 0, false
+		}
+	}
+	return id, true
+}
@@ -0,0 +1,276 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/a-h/templ"
+	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/models"
+	"github.com/svuvi/theweek/webauthn"
+)
+
+// Максимальный размер ответа ключа доступа, который присылает браузер
+const maxPasskeyResponseSize = 64 << 10
+
+// relyingParty описывает сайт для WebAuthn по публичному адресу из настроек.
+// Ключи привязываются к домену, поэтому для разработки на localhost нужно указать -base-url http://localhost:8080
+func (h *BaseHandler) relyingParty() *webauthn.RelyingParty {
+	u, _ := url.Parse(h.config.BaseURL) // адрес проверен при загрузке настроек
+	return &webauthn.RelyingParty{
+		ID:     u.Hostname(),
+		Name:   h.config.SiteName,
+		Origin: h.config.BaseURL,
+	}
+}
+
+// passkeyResponse - ответ navigator.credentials, который passkeys.js пересылает на сервер.
+// Двоичные поля закодированы в base64url
+type passkeyResponse struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle"`
+}
+
+var errPasskeyResponse = errors.New("некорректный ответ ключа доступа")
+
+func decodePasskeyResponse(w http.ResponseWriter, r *http.Request) (*passkeyResponse, error) {
+	resp := new(passkeyResponse)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPasskeyResponseSize)).Decode(resp); err != nil {
+		return nil, errPasskeyResponse
+	}
+	return resp, nil
+}
+
+// decodeB64 декодирует поля ответа: браузеры присылают base64url без выравнивания
+func decodeB64(s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print("Ошибка при отправке JSON:\n", err)
+	}
+}
+
+// passkeyLoginOptions начинает вход по ключу доступа: выдаёт вызов для navigator.credentials.get
+func (h *BaseHandler) passkeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	if _, authorized := currentUser(r); authorized {
+		http.Error(w, "Вы уже зашли в аккаунт", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err == nil {
+		err = h.startPreSession(w, models.PreSessionPasskeyLogin, 0, challenge)
+	}
+	if err != nil {
+		log.Print("Ошибка при начале входа по ключу доступа:\n", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.relyingParty().NewRequestOptions(challenge, nil))
+}
+
+// passkeyLogin проверяет подпись ключа доступа и создаёт сессию.
+// Ключ доступа заменяет и пароль, и второй фактор
+func (h *BaseHandler) passkeyLogin(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, message string) {
+		w.WriteHeader(status)
+		components.LoginForm("", "", templ.NopComponent, components.FormWarning(message)).Render(r.Context(), w)
+	}
+
+	ip := clientIP(r)
+	if ok, retry := h.ipLimiter.Allow(ip); !ok {
+		log.Printf("Превышен лимит попыток входа с IP %s", ip)
+		tooManyAttempts(w, retry)
+		components.LoginForm("", "", templ.NopComponent, components.FormWarning(tooManyAttemptsMessage(retry))).Render(r.Context(), w)
+		return
+	}
+
+	pre, err := h.getPreSession(r, models.PreSessionPasskeyLogin)
+	if err != nil {
+		fail(http.StatusUnauthorized, "Время на вход истекло, попробуйте ещё раз")
+		return
+	}
+	// Вызов одноразовый, даже если проверка не пройдёт
+	h.finishPreSession(w, pre)
+
+	resp, err := decodePasskeyResponse(w, r)
+	if err != nil {
+		fail(http.StatusBadRequest, "Ключ прислал некорректный ответ")
+		return
+	}
+
+	passkey, err := h.passkeyRepo.GetByCredentialID(decodeB64(resp.ID))
+	if err != nil {
+		fail(http.StatusUnauthorized, "Этот ключ не привязан ни к одному аккаунту")
+		return
+	}
+	if handle := decodeB64(resp.UserHandle); handle != nil && !bytes.Equal(handle, webauthn.UserHandle(passkey.UserID)) {
+		fail(http.StatusUnauthorized, "Этот ключ не привязан ни к одному аккаунту")
+		return
+	}
+
+	user, err := h.userRepo.GetByID(passkey.UserID)
+	if err != nil {
+		fail(http.StatusUnauthorized, "Этот ключ не привязан ни к одному аккаунту")
+		return
+	}
+	if user.IsLocked() {
+		fail(http.StatusForbidden, "Вход в аккаунт временно заблокирован из-за неудачных попыток входа")
+		return
+	}
+
+	signCount, err := h.relyingParty().VerifyAssertion(pre.Challenge, passkey.PublicKey, passkey.SignCount,
+		decodeB64(resp.ClientDataJSON), decodeB64(resp.AuthenticatorData), decodeB64(resp.Signature))
+	if err != nil {
+		log.Printf("Неудачный вход по ключу доступа %q пользователя %s, IP %s:\n%v", passkey.Name, user.Username, ip, err)
+		fail(http.StatusUnauthorized, "Не удалось проверить ключ")
+		return
+	}
+	if err = h.passkeyRepo.UpdateSignCount(passkey.ID, signCount); err != nil {
+		log.Printf("Ошибка при сохранении счётчика ключа доступа с ID=%d:\n%v", passkey.ID, err)
+	}
+
+	if user.FailedLogins > 0 || !user.LockedUntil.IsZero() {
+		if err = h.userRepo.Unlock(user.ID); err != nil {
+			log.Printf("Ошибка при сбросе счётчика неудачных попыток входа пользователя %s:\n%v", user.Username, err)
+		}
+	}
+
+	if err = h.createSession(w, r, user.ID); err != nil {
+		fail(http.StatusInternalServerError, "Ошибка на стороне сервера")
+		return
+	}
+
+	components.LoggedIn().Render(r.Context(), w)
+}
+
+// passkeyRegisterOptions начинает регистрацию нового ключа доступа: выдаёт вызов для navigator.credentials.create
+func (h *BaseHandler) passkeyRegisterOptions(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+
+	passkeys, err := h.passkeyRepo.GetByUser(user.ID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке ключей доступа пользователя %s:\n%v", user.Username, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	var exclude [][]byte
+	for _, p := range passkeys {
+		exclude = append(exclude, p.CredentialID)
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err == nil {
+		err = h.startPreSession(w, models.PreSessionPasskeyRegister, user.ID, challenge)
+	}
+	if err != nil {
+		log.Printf("Ошибка при начале регистрации ключа доступа пользователя %s:\n%v", user.Username, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.relyingParty().NewCreationOptions(challenge, user.ID, user.Username, exclude))
+}
+
+// passkeyRegister проверяет ответ ключа и сохраняет его
+func (h *BaseHandler) passkeyRegister(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+
+	pre, err := h.getPreSession(r, models.PreSessionPasskeyRegister)
+	if err != nil || pre.UserID != user.ID {
+		h.renderPasskeyList(w, r, user, components.FormWarning("Время на добавление ключа истекло, попробуйте ещё раз"))
+		return
+	}
+	h.finishPreSession(w, pre)
+
+	resp, err := decodePasskeyResponse(w, r)
+	if err != nil {
+		h.renderPasskeyList(w, r, user, components.FormWarning("Ключ прислал некорректный ответ"))
+		return
+	}
+
+	name := strings.TrimSpace(resp.Name)
+	if name == "" {
+		name = "Ключ доступа"
+	}
+	if utf8.RuneCountInString(name) > 50 {
+		h.renderPasskeyList(w, r, user, components.FormWarning("Название ключа не должно быть длиннее 50 символов"))
+		return
+	}
+
+	credential, err := h.relyingParty().VerifyRegistration(pre.Challenge, decodeB64(resp.ClientDataJSON), decodeB64(resp.AttestationObject))
+	if err != nil {
+		log.Printf("Не удалось зарегистрировать ключ доступа пользователя %s:\n%v", user.Username, err)
+		message := "Не удалось проверить ключ"
+		if errors.Is(err, webauthn.ErrUnsupportedKey) {
+			message = "Этот тип ключа не поддерживается"
+		}
+		h.renderPasskeyList(w, r, user, components.FormWarning(message))
+		return
+	}
+
+	if _, err = h.passkeyRepo.Create(user.ID, credential.ID, credential.PublicKey, credential.SignCount, name); err != nil {
+		log.Printf("Ошибка при сохранении ключа доступа пользователя %s:\n%v", user.Username, err)
+		h.renderPasskeyList(w, r, user, components.FormWarning("Ошибка сервера при сохранении. Возможно, этот ключ уже добавлен"))
+		return
+	}
+
+	log.Printf("Пользователь %s добавил ключ доступа %q", user.Username, name)
+	if err = h.auditRepo.Create(user.ID, models.AuditPasskeyAdd, name, clientIP(r)); err != nil {
+		log.Print("Ошибка при записи в журнал безопасности:\n", err)
+	}
+
+	h.renderPasskeyList(w, r, user, components.FormOK("Ключ добавлен"))
+}
+
+func (h *BaseHandler) deletePasskey(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+
+	id, err := strconv.Atoi(r.PathValue("passkeyID"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Delete проверяет владельца, чужой ключ удалить нельзя
+	if err = h.passkeyRepo.Delete(id, user.ID); err != nil {
+		h.renderPasskeyList(w, r, user, components.FormWarning("Ключ не найден"))
+		return
+	}
+
+	log.Printf("Пользователь %s удалил ключ доступа с ID=%d", user.Username, id)
+	if err = h.auditRepo.Create(user.ID, models.AuditPasskeyDel, strconv.Itoa(id), clientIP(r)); err != nil {
+		log.Print("Ошибка при записи в журнал безопасности:\n", err)
+	}
+
+	h.renderPasskeyList(w, r, user, components.FormOK("Ключ удалён"))
+}
+
+func (h *BaseHandler) renderPasskeyList(w http.ResponseWriter, r *http.Request, user *models.User, result templ.Component) {
+	passkeys, err := h.passkeyRepo.GetByUser(user.ID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке ключей доступа пользователя %s:\n%v", user.Username, err)
+	}
+	components.PasskeyList(passkeys, result).Render(r.Context(), w)
+}
@@ -2,16 +2,23 @@ package routes
 
 import (
 	"database/sql"
-	"embed"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/svuvi/theweek/backup"
+	"github.com/svuvi/theweek/blobstore"
 	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/config"
 	"github.com/svuvi/theweek/layouts"
 	"github.com/svuvi/theweek/models"
+	"github.com/svuvi/theweek/ratelimit"
 	"github.com/svuvi/theweek/repositories"
 )
 
@@ -22,72 +29,240 @@ type BaseHandler struct {
 	inviteRepo       models.InviteRepository
 	imageRepo        models.ImageRepository
 	recoveryCodeRepo models.RecoveryCodeRepository
+	sectionRepo      models.SectionRepository
+	revisionRepo     models.RevisionRepository
+	auditRepo        models.AuditRepository
+	backupCodeRepo   models.BackupCodeRepository
+	preSessionRepo   models.PreSessionRepository
+	settingsRepo     models.SettingsRepository
+	passkeyRepo      models.PasskeyRepository
+
+	backupStore *backup.Store
+
+	config        *config.Config
+	sessionPolicy models.SessionPolicy
+
+	// Ограничители попыток входа и восстановления пароля по IP и по логину
+	ipLimiter       *ratelimit.Limiter
+	usernameLimiter *ratelimit.Limiter
 }
 
-func NewBaseHandler(db *sql.DB) *BaseHandler {
+func NewBaseHandler(db *sql.DB, cfg *config.Config, blobs blobstore.Store, backupStore *backup.Store, ipLimiter, usernameLimiter *ratelimit.Limiter) *BaseHandler {
 	return &BaseHandler{
 		articleRepo:      repositories.NewArticleRepo(db),
 		userRepo:         repositories.NewUserRepo(db),
 		sessionRepo:      repositories.NewSessionRepo(db),
 		inviteRepo:       repositories.NewInviteRepo(db),
-		imageRepo:        repositories.NewImageRepo(db),
+		imageRepo:        repositories.NewImageRepo(db, blobs),
 		recoveryCodeRepo: repositories.NewRecoveryCodeRepo(db),
+		sectionRepo:      repositories.NewSectionRepo(db),
+		revisionRepo:     repositories.NewRevisionRepo(db),
+		auditRepo:        repositories.NewAuditRepo(db),
+		backupCodeRepo:   repositories.NewBackupCodeRepo(db),
+		preSessionRepo:   repositories.NewPreSessionRepo(db),
+		settingsRepo:     repositories.NewSettingsRepo(db),
+		passkeyRepo:      repositories.NewPasskeyRepo(db),
+		backupStore:      backupStore,
+		ipLimiter:        ipLimiter,
+		usernameLimiter:  usernameLimiter,
+		config:           cfg,
+		sessionPolicy:    cfg.SessionPolicy(),
 	}
 }
 
-//go:embed static
-var static embed.FS
-
 func (h *BaseHandler) NewRouter() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /{$}", h.indexHandler)
+	mux.HandleFunc("GET /page/{n}", h.pageHandler)
+	mux.HandleFunc("GET /feed/cards", h.feedCardsHandler)
 	mux.HandleFunc("GET /{slug}", h.articleHandler)
+	mux.HandleFunc("GET /search", h.searchHandler)
+	mux.HandleFunc("GET /section/{slug}", h.sectionHandler)
+	mux.HandleFunc("GET /feed.xml", h.rssHandler)
+	mux.HandleFunc("GET /atom.xml", h.atomHandler)
+	mux.HandleFunc("GET /section/{slug}/feed.xml", h.sectionRSSHandler)
+	mux.HandleFunc("GET /section/{slug}/atom.xml", h.sectionAtomHandler)
 
 	mux.HandleFunc("GET /login", h.loginPageHandler)
 	mux.HandleFunc("POST /login", h.loginFormHandler)
+	mux.HandleFunc("POST /login/2fa", h.totpLoginHandler)
+	mux.HandleFunc("POST /login/passkey/options", h.passkeyLoginOptions)
+	mux.HandleFunc("POST /login/passkey", h.passkeyLogin)
 	mux.HandleFunc("GET /logout", h.logoutHandler)
 
 	mux.HandleFunc("GET /invite/{code}", h.claimInvite)
 	mux.HandleFunc("GET /register", h.registrationPageHandler)
 	mux.HandleFunc("POST /register", h.registrationFormHandler)
 
-	mux.HandleFunc("GET /account/", h.accountPage)
-	mux.HandleFunc("GET /account/change-password", h.changePasswordPage)
-	mux.HandleFunc("POST /account/change-password", h.changePasswordForm)
+	mux.HandleFunc("GET /user/{username}", h.userProfileHandler)
+
+	mux.HandleFunc("GET /account/", h.RequireUser(h.accountPage))
+	mux.HandleFunc("POST /account/profile", h.RequireUser(h.profileForm))
+	mux.HandleFunc("POST /account/2fa/setup", h.RequireUser(h.totpSetup))
+	mux.HandleFunc("POST /account/2fa/enable", h.RequireUser(h.totpEnable))
+	mux.HandleFunc("POST /account/2fa/disable", h.RequireUser(h.totpDisable))
+	mux.HandleFunc("POST /account/2fa/backup-codes", h.RequireUser(h.totpBackupCodes))
+	mux.HandleFunc("POST /account/passkeys/options", h.RequireUser(h.passkeyRegisterOptions))
+	mux.HandleFunc("POST /account/passkeys", h.RequireUser(h.passkeyRegister))
+	mux.HandleFunc("DELETE /account/passkeys/{passkeyID}", h.RequireUser(h.deletePasskey))
+	mux.HandleFunc("DELETE /account/sessions/{sessionID}", h.RequireUser(h.revokeSession))
+	mux.HandleFunc("POST /account/sessions/revoke-others", h.RequireUser(h.revokeOtherSessionsHandler))
+	mux.HandleFunc("GET /account/change-password", h.RequireUser(h.changePasswordPage))
+	mux.HandleFunc("POST /account/change-password", h.RequireUser(h.changePasswordForm))
 	mux.HandleFunc("GET /account/restore-password", h.restorePasswordPage)
 	mux.HandleFunc("POST /account/restore-password", h.restorePasswordForm)
 
-	mux.HandleFunc("GET /dashboard/", h.dasboardPageHandler)
-	mux.HandleFunc("GET /dashboard/users/", h.dashboardUsersHandler)
-	mux.HandleFunc("GET /dashboard/invites/", h.dashboardInvitesHandler)
-	mux.HandleFunc("POST /dashboard/invites/create", h.createInvite)
-	mux.HandleFunc("DELETE /dashboard/invites/delete/{code}", h.deleteInvite)
-	mux.HandleFunc("POST /dashboard/reocvery-codes/create", h.createRecoveryCodeForm)
-	mux.HandleFunc("DELETE /dashboard/reocvery-codes/delete/{rCodeID}", h.deleteRecoveryCode)
-	mux.HandleFunc("GET /dashboard/publishing/", h.dashboardPublishing)
-	mux.HandleFunc("GET /dashboard/publishing/{articleID}", h.dashboardPublishing)
-	mux.HandleFunc("POST /dashboard/publishing/", h.publishingFormHandler)
-	mux.HandleFunc("POST /dashboard/publishing/{articleID}", h.publishingFormHandler)
-
-	mux.HandleFunc("/delete/{type}/{id}", h.deleteResourceHandler)
+	mux.HandleFunc("GET /dashboard/", h.RequirePermission(models.PermissionDashboard, h.dasboardPageHandler))
+	mux.HandleFunc("GET /dashboard/users/", h.RequirePermission(models.PermissionManageUsers, h.dashboardUsersHandler))
+	mux.HandleFunc("POST /dashboard/users/{userID}/role", h.RequirePermission(models.PermissionManageUsers, h.setUserRole))
+	mux.HandleFunc("POST /dashboard/users/{userID}/unlock", h.RequirePermission(models.PermissionManageUsers, h.unlockUser))
+	mux.HandleFunc("POST /dashboard/users/2fa-policy", h.RequirePermission(models.PermissionManageUsers, h.setAdmin2FAPolicy))
+	mux.HandleFunc("GET /dashboard/invites/", h.RequirePermission(models.PermissionManageInvites, h.dashboardInvitesHandler))
+	mux.HandleFunc("POST /dashboard/invites/create", h.RequirePermission(models.PermissionManageInvites, h.createInvite))
+	mux.HandleFunc("DELETE /dashboard/invites/delete/{code}", h.RequirePermission(models.PermissionManageInvites, h.deleteInvite))
+	mux.HandleFunc("POST /dashboard/reocvery-codes/create", h.RequirePermission(models.PermissionManageUsers, h.createRecoveryCodeForm))
+	mux.HandleFunc("DELETE /dashboard/reocvery-codes/delete/{rCodeID}", h.RequirePermission(models.PermissionManageUsers, h.deleteRecoveryCode))
+	mux.HandleFunc("GET /dashboard/articles/", h.RequirePermission(models.PermissionWriteArticles, h.dashboardArticlesHandler))
+	mux.HandleFunc("GET /dashboard/articles/{articleID}/revisions/", h.RequirePermission(models.PermissionWriteArticles, h.dashboardRevisionsHandler))
+	mux.HandleFunc("POST /dashboard/articles/{articleID}/revisions/{revisionID}/restore", h.RequirePermission(models.PermissionWriteArticles, h.restoreRevision))
+	mux.HandleFunc("GET /dashboard/publishing/", h.RequirePermission(models.PermissionWriteArticles, h.dashboardPublishing))
+	mux.HandleFunc("GET /dashboard/publishing/{articleID}", h.RequirePermission(models.PermissionWriteArticles, h.dashboardPublishing))
+	mux.HandleFunc("POST /dashboard/publishing/", h.RequirePermission(models.PermissionWriteArticles, h.publishingFormHandler))
+	mux.HandleFunc("POST /dashboard/publishing/{articleID}", h.RequirePermission(models.PermissionWriteArticles, h.publishingFormHandler))
+	mux.HandleFunc("GET /dashboard/media/", h.RequirePermission(models.PermissionWriteArticles, h.dashboardMediaHandler))
+	mux.HandleFunc("GET /dashboard/media/picker", h.RequirePermission(models.PermissionWriteArticles, h.coverPickerHandler))
+	mux.HandleFunc("POST /dashboard/media/upload", h.RequirePermission(models.PermissionWriteArticles, h.uploadMedia))
+	mux.HandleFunc("POST /dashboard/media/inline", h.RequirePermission(models.PermissionWriteArticles, h.uploadInlineImage))
+	mux.HandleFunc("POST /dashboard/media/{imageID}/rename", h.RequirePermission(models.PermissionWriteArticles, h.renameImage))
+	mux.HandleFunc("GET /dashboard/sections/", h.RequirePermission(models.PermissionManageSections, h.dashboardSectionsHandler))
+	mux.HandleFunc("POST /dashboard/sections/create", h.RequirePermission(models.PermissionManageSections, h.createSection))
+	mux.HandleFunc("POST /dashboard/sections/{sectionID}", h.RequirePermission(models.PermissionManageSections, h.updateSection))
+	mux.HandleFunc("DELETE /dashboard/sections/delete/{sectionID}", h.RequirePermission(models.PermissionManageSections, h.deleteSection))
+	mux.HandleFunc("GET /dashboard/backups/", h.RequirePermission(models.PermissionManageBackups, h.dashboardBackupsHandler))
+	mux.HandleFunc("POST /dashboard/backups/create", h.RequirePermission(models.PermissionManageBackups, h.createBackup))
+	mux.HandleFunc("GET /dashboard/backups/{name}", h.RequirePermission(models.PermissionManageBackups, h.downloadBackup))
+
+	mux.HandleFunc("DELETE /delete/{type}/{id}", h.RequirePermission(models.PermissionWriteArticles, h.deleteResourceHandler))
 
 	mux.HandleFunc("GET /images/{imageID}", h.imageHandler)
-	mux.Handle("GET /static/", http.FileServerFS(static))
+	mux.HandleFunc("GET /static/{path...}", h.staticHandler)
+
+	return h.withSite(h.authenticate(h.csrfProtect(h.withSections(mux))))
+}
+
+// withSite кладёт название и публичный адрес сайта из настроек в контекст для шаблонов
+func (h *BaseHandler) withSite(next http.Handler) http.Handler {
+	site := components.Site{Name: h.config.SiteName, URL: h.config.BaseURL, Static: staticURLs()}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(components.WithSite(r.Context(), site)))
+	})
+}
+
+// withSections загружает рубрики для навигации в контекст запроса.
+// Статика и картинки рубрики не рендерят, для них запрос в БД пропускается
+func (h *BaseHandler) withSections(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/static/") || strings.HasPrefix(r.URL.Path, "/images/") {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-	return mux
+		sections, err := h.sectionRepo.GetAll()
+		if err != nil {
+			log.Print("Ошибка при попытке загрузить рубрики:\n", err)
+		}
+		next.ServeHTTP(w, r.WithContext(components.WithSections(r.Context(), sections)))
+	})
 }
 
+// Количество статей на одной странице ленты
+const feedPageSize = 20
+
 func (h *BaseHandler) indexHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
+	h.renderFeedPage(w, r, 1)
+}
 
-	articles, err := h.articleRepo.GetAll()
+func (h *BaseHandler) pageHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || page < 1 {
+		http.NotFound(w, r)
+		return
+	}
+	if page == 1 {
+		http.Redirect(w, r, "/", http.StatusMovedPermanently)
+		return
+	}
+	h.renderFeedPage(w, r, page)
+}
+
+// renderFeedPage рендерит пронумерованную страницу главной ленты.
+// Нумерованные страницы нужны поисковикам, читатели догружают ленту через feedCardsHandler
+func (h *BaseHandler) renderFeedPage(w http.ResponseWriter, r *http.Request, page int) {
+	total, err := h.articleRepo.CountPublished(0)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	totalPages := max((total+feedPageSize-1)/feedPageSize, 1)
+	if page > totalPages {
+		http.NotFound(w, r)
+		return
+	}
+
+	articles, err := h.articleRepo.GetPublishedCards(0, (page-1)*feedPageSize, feedPageSize)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	layouts.Index(articles, authorized, user).Render(r.Context(), w)
+	moreURL := ""
+	if page < totalPages {
+		moreURL = feedMoreURL(0, articles)
+	}
+
+	layouts.Index(articles, moreURL, page, totalPages).Render(r.Context(), w)
+}
+
+// feedCardsHandler отдаёт следующую порцию карточек ленты для бесконечной прокрутки.
+// Позиция задаётся датой публикации и ID последней показанной статьи
+func (h *BaseHandler) feedCardsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sectionID, _ := strconv.Atoi(q.Get("section"))
+	beforeID, err := strconv.Atoi(q.Get("id"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	before, err := time.Parse(time.DateTime, q.Get("before"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Лишняя статья показывает, есть ли что догружать дальше
+	articles, err := h.articleRepo.GetPublishedCardsBefore(sectionID, before, beforeID, feedPageSize+1)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	moreURL := ""
+	if len(articles) > feedPageSize {
+		articles = articles[:feedPageSize]
+		moreURL = feedMoreURL(sectionID, articles)
+	}
+
+	components.ArticleFeedChunk(articles, moreURL).Render(r.Context(), w)
+}
+
+// feedMoreURL возвращает адрес следующей порции карточек после последней статьи в articles
+func feedMoreURL(sectionID int, articles []*models.Article) string {
+	if len(articles) == 0 {
+		return ""
+	}
+	last := articles[len(articles)-1]
+	return fmt.Sprintf("/feed/cards?section=%d&before=%s&id=%d", sectionID, url.QueryEscape(last.CreatedAt.UTC().Format(time.DateTime)), last.ID)
 }
 
 func (h *BaseHandler) articleHandler(w http.ResponseWriter, r *http.Request) {
@@ -111,18 +286,76 @@ func (h *BaseHandler) articleHandler(w http.ResponseWriter, r *http.Request) {
 		coverImagePath = ""
 	} */
 
-	authorized, user := isAuthorised(r, h)
-	layouts.Article(article, authorized, user).Render(r.Context(), w)
+	// Неопубликованные статьи видны только тем, кто может их редактировать, в режиме предпросмотра
+	if !article.IsPublished() {
+		if user, _ := currentUser(r); !user.CanEditArticle(article) {
+			http.NotFound(w, r)
+			return
+		}
+		layouts.ArticleReviewMode(article).Render(r.Context(), w)
+		return
+	}
+
+	layouts.Article(article).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) sectionHandler(w http.ResponseWriter, r *http.Request) {
+	section, err := h.sectionRepo.GetBySlug(r.PathValue("slug"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	articles, err := h.articleRepo.GetPublishedCards(section.ID, 0, feedPageSize+1)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	moreURL := ""
+	if len(articles) > feedPageSize {
+		articles = articles[:feedPageSize]
+		moreURL = feedMoreURL(section.ID, articles)
+	}
+
+	layouts.SectionPage(section, articles, moreURL).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len([]rune(query)) > 200 {
+		http.Error(w, "Слишком длинный запрос", http.StatusBadRequest)
+		return
+	}
+
+	// Выпадающий список в шапке показывает только первые результаты
+	live := r.Header.Get("HX-Request") == "true"
+	limit := 50
+	if live {
+		limit = 6
+	}
+
+	results, err := h.articleRepo.Search(query, limit)
+	if err != nil {
+		log.Printf("Ошибка при поиске по запросу %q:\n%v", query, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if live {
+		components.SearchDropdown(query, results).Render(r.Context(), w)
+		return
+	}
+
+	layouts.SearchPage(query, results).Render(r.Context(), w)
 }
 
 func (h *BaseHandler) loginPageHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
-	layouts.LoginPage(authorized, user).Render(r.Context(), w)
+	layouts.LoginPage().Render(r.Context(), w)
 }
 
 func (h *BaseHandler) claimInvite(w http.ResponseWriter, r *http.Request) {
-	authorized, _ := isAuthorised(r, h)
-	if authorized {
+	if _, authorized := currentUser(r); authorized {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -145,22 +378,14 @@ func (h *BaseHandler) claimInvite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "registration_invite",
-		Value:    code,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		MaxAge:   900,
-	})
+	h.setCookie(w, "registration_invite", code, 900)
 
 	http.Redirect(w, r, "/register", http.StatusFound)
 }
 
 func (h *BaseHandler) registrationPageHandler(w http.ResponseWriter, r *http.Request) {
-	authorized, user := isAuthorised(r, h)
-	if authorized {
-		layouts.AlreadyRegisteredPage(user).Render(r.Context(), w)
+	if _, authorized := currentUser(r); authorized {
+		layouts.AlreadyRegisteredPage().Render(r.Context(), w)
 		return
 	}
 
@@ -180,89 +405,127 @@ func (h *BaseHandler) registrationPageHandler(w http.ResponseWriter, r *http.Req
 	layouts.RegistrationPage().Render(r.Context(), w)
 }
 
-func (h *BaseHandler) imageHandler(w http.ResponseWriter, r *http.Request) {
-	i, err := strconv.ParseInt(r.PathValue("imageID"), 10, 64)
-	id := int(i)
-	if err != nil {
-		http.NotFound(w, r)
+func (h *BaseHandler) deleteResourceHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	idValue := r.PathValue("id")
+	typeString := r.PathValue("type")
+	log.Printf("Пользователь %s запросил удаление %s с id=%s", user.Username, typeString, idValue)
+
+	id, err := strconv.Atoi(idValue)
+	if err != nil || id < 1 || (typeString != "article" && typeString != "image") {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	/* filename := r.PathValue("filename")
-	if filename == "" {
-		http.NotFound(w, r)
+	if typeString == "image" {
+		h.deleteImage(w, r, user, id)
 		return
-	} */
+	}
 
-	img, err := h.imageRepo.Get(id)
-	if err != nil {
-		if err == sql.ErrNoRows {
+	if typeString == "article" {
+		article, err := h.articleRepo.GetByID(id)
+		if err != nil {
 			http.NotFound(w, r)
 			return
 		}
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		if !user.CanEditArticle(article) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		err = h.articleRepo.Delete(id)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		components.ArticleDeleted().Render(r.Context(), w)
 		return
 	}
+}
+
+func (h *BaseHandler) accountPage(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	backupCodesLeft, err := h.backupCodeRepo.CountUnused(user.ID)
+	if err != nil {
+		log.Printf("Ошибка при подсчёте резервных кодов пользователя %s:\n%v", user.Username, err)
+	}
+
+	passkeys, err := h.passkeyRepo.GetByUser(user.ID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке ключей доступа пользователя %s:\n%v", user.Username, err)
+	}
+
+	session, _ := currentSession(r)
+	layouts.AccountPage(backupCodesLeft, passkeys, h.activeSessions(user), session.ID).Render(r.Context(), w)
+}
 
-	/* if img.Filename != filename {
+func (h *BaseHandler) userProfileHandler(w http.ResponseWriter, r *http.Request) {
+	profile, err := h.userRepo.GetByUsername(r.PathValue("username"))
+	if err != nil {
 		http.NotFound(w, r)
 		return
-	} */
-
-	w.Header().Set("Content-Type", http.DetectContentType(img.Content))
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, img.Filename))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(img.Content)))
+	}
 
-	_, err = w.Write(img.Content)
+	articles, err := h.articleRepo.GetPublishedByAuthor(profile.ID)
 	if err != nil {
-		http.Error(w, "Ошибка при отправке файла", http.StatusInternalServerError)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
 	}
+
+	layouts.UserProfile(profile, articles).Render(r.Context(), w)
 }
 
-func (h *BaseHandler) deleteResourceHandler(w http.ResponseWriter, r *http.Request) {
-	_, user := isAuthorised(r, h)
-	if !user.IsAdmin {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+func (h *BaseHandler) profileForm(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxFormSize)
+	err := r.ParseMultipartForm(h.config.MaxFormSize)
+	if err != nil {
+		components.ProfileForm(user.Bio, components.FormWarning("Невозможно обработать данные формы")).Render(r.Context(), w)
 		return
 	}
 
-	idValue := r.PathValue("id")
-	typeString := r.PathValue("type")
-	log.Printf("Администратор %s запросил удаление %s с id=%s", user.Username, typeString, idValue)
-
-	id, err := strconv.Atoi(idValue)
-	if err != nil || id < 1 || typeString != "article" { // todo: добавить картинки и другие типы ресурсов по надобности
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	bio := strings.TrimSpace(r.PostFormValue("bio"))
+	if len([]rune(bio)) > 1000 {
+		components.ProfileForm(bio, components.FormWarning("Описание не должно быть длиннее 1000 символов")).Render(r.Context(), w)
 		return
 	}
 
-	if typeString == "article" {
-		err = h.articleRepo.Delete(id)
+	avatarImageID := user.AvatarImageID
+	file, fileHeader, err := r.FormFile("avatar")
+	if err == nil {
+		defer file.Close()
+
+		if fileHeader.Size > h.config.MaxImageSize {
+			message := fmt.Sprintf("Файл слишком большой. Максимальный размер: %s.", components.FormatSize(h.config.MaxImageSize))
+			components.ProfileForm(bio, components.FormWarning(message)).Render(r.Context(), w)
+			return
+		}
+		content, err := io.ReadAll(file)
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			components.ProfileForm(bio, components.FormWarning("Ошибка при чтении файла аватара")).Render(r.Context(), w)
 			return
 		}
-		components.ArticleDeleted().Render(r.Context(), w)
+
+		avatarImageID, err = h.saveImage(fileHeader.Filename, user.ID, content)
+		if err != nil {
+			message := imageErrorMessage(err, "Ошибка при сохранении аватара в базу данных")
+			components.ProfileForm(bio, components.FormWarning(message)).Render(r.Context(), w)
+			return
+		}
+	} else if err != http.ErrMissingFile {
+		components.ProfileForm(bio, components.FormWarning("Ошибка при чтении файла аватара")).Render(r.Context(), w)
 		return
 	}
-}
 
-func (h *BaseHandler) accountPage(w http.ResponseWriter, r *http.Request) {
-	authorised, user := isAuthorised(r, h)
-	if !authorised {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	if err = h.userRepo.UpdateProfile(user.ID, bio, avatarImageID); err != nil {
+		log.Printf("Ошибка при обновлении профиля пользователя %s:\n%v", user.Username, err)
+		components.ProfileForm(bio, components.FormWarning("Внутренняя ошибка сервера")).Render(r.Context(), w)
 		return
 	}
 
-	layouts.AccountPage(user).Render(r.Context(), w)
+	components.ProfileForm(bio, components.FormOK("Профиль сохранён")).Render(r.Context(), w)
 }
 
 func (h *BaseHandler) changePasswordPage(w http.ResponseWriter, r *http.Request) {
-	authorised, user := isAuthorised(r, h)
-	if !authorised {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-
-	layouts.ChangePasswordPage(user).Render(r.Context(), w)
+	layouts.ChangePasswordPage().Render(r.Context(), w)
 }
@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/models"
+)
+
+func (h *BaseHandler) setSessionCookie(w http.ResponseWriter, key string, expires time.Time) {
+	h.setCookie(w, "session_key", key, int(time.Until(expires)/time.Second))
+}
+
+func (h *BaseHandler) clearSessionCookie(w http.ResponseWriter) {
+	h.clearCookie(w, "session_key")
+}
+
+// revokeOtherSessions завершает все сессии пользователя, кроме exceptSessionID
+func (h *BaseHandler) revokeOtherSessions(userID, exceptSessionID int) {
+	n, err := h.sessionRepo.SetInactiveExcept(userID, exceptSessionID)
+	if err != nil {
+		log.Printf("Ошибка при завершении сессий пользователя с ID=%d:\n%v", userID, err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Завершено сессий пользователя с ID=%d: %d", userID, n)
+	}
+}
+
+// revokeSession завершает одну сессию пользователя, например на потерянном устройстве
+func (h *BaseHandler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	current, _ := currentSession(r)
+
+	id, err := strconv.Atoi(r.PathValue("sessionID"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if id == current.ID {
+		h.renderSessionList(w, r, user, current.ID, components.FormWarning("Чтобы завершить текущую сессию, выйдите из аккаунта"))
+		return
+	}
+
+	// SetInactiveByID проверяет владельца, чужую сессию завершить нельзя
+	if err = h.sessionRepo.SetInactiveByID(id, user.ID); err != nil {
+		h.renderSessionList(w, r, user, current.ID, components.FormWarning("Сессия не найдена"))
+		return
+	}
+
+	log.Printf("Пользователь %s завершил сессию с ID=%d", user.Username, id)
+	h.renderSessionList(w, r, user, current.ID, components.FormOK("Сессия завершена"))
+}
+
+// revokeOtherSessionsHandler - кнопка "Выйти на всех остальных устройствах"
+func (h *BaseHandler) revokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	current, _ := currentSession(r)
+
+	n, err := h.sessionRepo.SetInactiveExcept(user.ID, current.ID)
+	if err != nil {
+		log.Printf("Ошибка при завершении сессий пользователя %s:\n%v", user.Username, err)
+		h.renderSessionList(w, r, user, current.ID, components.FormWarning("Внутренняя ошибка сервера"))
+		return
+	}
+
+	log.Printf("Пользователь %s завершил остальные сессии: %d", user.Username, n)
+	h.renderSessionList(w, r, user, current.ID, components.FormOK("Вы вышли на всех остальных устройствах"))
+}
+
+func (h *BaseHandler) renderSessionList(w http.ResponseWriter, r *http.Request, user *models.User, currentID int, result templ.Component) {
+	components.SessionList(h.activeSessions(user), currentID, result).Render(r.Context(), w)
+}
+
+// activeSessions возвращает незавершённые и не истёкшие сессии пользователя
+func (h *BaseHandler) activeSessions(user *models.User) []*models.Session {
+	sessions, err := h.sessionRepo.GetUserSessions(user.ID)
+	if err != nil {
+		log.Printf("Ошибка при загрузке сессий пользователя %s:\n%v", user.Username, err)
+	}
+
+	now := time.Now()
+	var active []*models.Session
+	for _, s := range sessions {
+		if s.IsActive && !h.sessionPolicy.IsExpired(s, now) {
+			active = append(active, s)
+		}
+	}
+	return active
+}
@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed static
+var static embed.FS
+
+// staticAsset - файл из static/ с отпечатком содержимого
+type staticAsset struct {
+	name   string // путь внутри static/, например fonts/chomsky.woff2
+	hashed string // тот же путь с отпечатком: style.3f2a1b9c0d.css
+	etag   string
+}
+
+// Файлы встроены в исполняемый файл, поэтому отпечатки считаются один раз при запуске и меняются только с новым билдом.
+// Адреса с отпечатком шаблоны берут через components.StaticURL, браузер хранит их год без перепроверки.
+// По старым адресам без отпечатка файлы тоже отдаются, но с проверкой ETag при каждом запросе
+var staticAssets, staticByHashed = loadStaticAssets()
+
+func loadStaticAssets() (byName, byHashed map[string]*staticAsset) {
+	byName, byHashed = map[string]*staticAsset{}, map[string]*staticAsset{}
+	err := fs.WalkDir(static, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := static.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+
+		name := strings.TrimPrefix(p, "static/")
+		ext := path.Ext(name)
+		a := &staticAsset{
+			name:   name,
+			hashed: strings.TrimSuffix(name, ext) + "." + hash[:10] + ext,
+			etag:   `"` + hash[:32] + `"`,
+		}
+		byName[a.name], byHashed[a.hashed] = a, a
+		return nil
+	})
+	if err != nil {
+		log.Fatal("Не удалось прочитать встроенные статические файлы:\n", err)
+	}
+	return byName, byHashed
+}
+
+// staticURLs возвращает адреса файлов с отпечатками для components.Site
+func staticURLs() map[string]string {
+	urls := make(map[string]string, len(staticAssets))
+	for name, a := range staticAssets {
+		urls[name] = "/static/" + a.hashed
+	}
+	return urls
+}
+
+func (h *BaseHandler) staticHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("path")
+	a, fingerprinted := staticByHashed[name]
+	if fingerprinted {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else if a = staticAssets[name]; a != nil {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+
+	if checkNotModified(w, r, a.etag, time.Time{}) {
+		return
+	}
+	f, err := static.Open("static/" + a.name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	// Content-Type определяется по расширению имени
+	http.ServeContent(w, r, a.name, time.Time{}, f.(io.ReadSeeker))
+}
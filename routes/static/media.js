@@ -0,0 +1,107 @@
+// Медиатека и текст статьи: загрузка перетаскиванием, вставка из буфера и копирование Markdown.
+// Перетащенные файлы отправляются по одному, чтобы несколько больших картинок не упирались в размер формы.
+// В медиатеке ответ сервера - строки таблицы, они вставляются через htmx, как и при загрузке через форму.
+// В тексте статьи ответ - Markdown картинки, он встаёт на место курсора
+(function () {
+    // Токен CSRF лежит в hx-headers у body
+    function headers() {
+        return JSON.parse(document.body.getAttribute("hx-headers") || "{}");
+    }
+
+    function send(url, field, file) {
+        const data = new FormData();
+        data.append(field, file);
+        return fetch(url, { method: "POST", headers: headers(), body: data });
+    }
+
+    function images(files) {
+        return [...files].filter((f) => f.type.startsWith("image/"));
+    }
+
+    async function upload(form, files) {
+        for (const file of files) {
+            const response = await send(form.getAttribute("hx-post"), "images", file);
+            htmx.swap("#media tbody", await response.text(), { swapStyle: "afterbegin" });
+        }
+    }
+
+    // insert вставляет текст вместо выделения отдельным абзацем: иначе картинка не станет <figure>
+    function insert(textarea, text) {
+        const before = textarea.value.slice(0, textarea.selectionStart);
+        let prefix = "";
+        if (before !== "" && !before.endsWith("\n\n")) {
+            prefix = before.endsWith("\n") ? "\n" : "\n\n";
+        }
+        textarea.setRangeText(prefix + text + "\n\n", textarea.selectionStart, textarea.selectionEnd, "end");
+        textarea.dispatchEvent(new Event("input"));
+    }
+
+    async function uploadInline(textarea, files) {
+        for (const file of files) {
+            // Пока файл загружается, на его месте стоит заглушка, чтобы можно было продолжать писать
+            const placeholder = `![Загрузка ${file.name}…]()`;
+            insert(textarea, placeholder);
+            const response = await send(textarea.dataset.markdownUpload, "image", file);
+            const text = await response.text();
+            textarea.value = textarea.value.replace(placeholder, response.ok ? text : "");
+            textarea.dispatchEvent(new Event("input"));
+            if (!response.ok) {
+                alert(`${file.name}: ${text}`);
+            }
+        }
+    }
+
+    function dropTarget(e) {
+        return e.target.closest("[data-media-upload], [data-markdown-upload]");
+    }
+
+    document.addEventListener("dragover", (e) => {
+        const target = dropTarget(e);
+        if (target && e.dataTransfer.types.includes("Files")) {
+            e.preventDefault();
+            target.classList.add("dragover");
+        }
+    });
+    document.addEventListener("dragleave", (e) => {
+        const target = dropTarget(e);
+        if (target && !target.contains(e.relatedTarget)) {
+            target.classList.remove("dragover");
+        }
+    });
+    document.addEventListener("drop", (e) => {
+        const target = dropTarget(e);
+        if (!target || images(e.dataTransfer.files).length === 0) {
+            return;
+        }
+        e.preventDefault();
+        target.classList.remove("dragover");
+        if (target.dataset.markdownUpload) {
+            uploadInline(target, images(e.dataTransfer.files));
+        } else {
+            upload(target, images(e.dataTransfer.files));
+        }
+    });
+    document.addEventListener("paste", (e) => {
+        const textarea = e.target.closest("[data-markdown-upload]");
+        if (textarea && images(e.clipboardData.files).length > 0) {
+            e.preventDefault();
+            uploadInline(textarea, images(e.clipboardData.files));
+        }
+    });
+
+    document.addEventListener("click", async (e) => {
+        const button = e.target.closest("[data-copy]");
+        if (!button) {
+            return;
+        }
+        try {
+            await navigator.clipboard.writeText(button.dataset.copy);
+        } catch (err) {
+            prompt("Скопируйте вручную:", button.dataset.copy);
+            return;
+        }
+        const text = button.textContent;
+        button.textContent = "✅";
+        setTimeout(() => (button.textContent = text), 1500);
+    });
+})();
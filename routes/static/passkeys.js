@@ -0,0 +1,115 @@
+// Вход и регистрация ключей доступа (WebAuthn).
+// Сервер выдаёт параметры в JSON, двоичные поля в base64url; ответ браузера отправляется обратно тем же способом.
+// Ответы сервера - HTML-фрагменты, они вставляются через htmx, как и у обычных форм
+(function () {
+    function fromB64(s) {
+        s = s.replace(/-/g, "+").replace(/_/g, "/");
+        const bin = atob(s + "===".slice((s.length + 3) % 4));
+        return Uint8Array.from(bin, (c) => c.charCodeAt(0)).buffer;
+    }
+
+    function toB64(buf) {
+        if (!buf) {
+            return "";
+        }
+        const bin = String.fromCharCode(...new Uint8Array(buf));
+        return btoa(bin).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+    }
+
+    // Токен CSRF лежит в hx-headers у body
+    function headers(json) {
+        const h = JSON.parse(document.body.getAttribute("hx-headers") || "{}");
+        if (json) {
+            h["Content-Type"] = "application/json";
+        }
+        return h;
+    }
+
+    async function post(url, body) {
+        return fetch(url, {
+            method: "POST",
+            headers: headers(body !== undefined),
+            body: body === undefined ? undefined : JSON.stringify(body),
+        });
+    }
+
+    function supported() {
+        if (window.PublicKeyCredential) {
+            return true;
+        }
+        alert("Этот браузер не поддерживает ключи доступа");
+        return false;
+    }
+
+    async function login() {
+        const optionsResponse = await post("/login/passkey/options");
+        if (!optionsResponse.ok) {
+            alert(await optionsResponse.text());
+            return;
+        }
+        const options = await optionsResponse.json();
+        options.challenge = fromB64(options.challenge);
+        options.allowCredentials.forEach((c) => (c.id = fromB64(c.id)));
+
+        let credential;
+        try {
+            credential = await navigator.credentials.get({ publicKey: options });
+        } catch (e) {
+            return; // пользователь отменил вход
+        }
+
+        const response = await post("/login/passkey", {
+            id: toB64(credential.rawId),
+            clientDataJSON: toB64(credential.response.clientDataJSON),
+            authenticatorData: toB64(credential.response.authenticatorData),
+            signature: toB64(credential.response.signature),
+            userHandle: toB64(credential.response.userHandle),
+        });
+        htmx.swap("#login-form", await response.text(), { swapStyle: "outerHTML" });
+    }
+
+    async function register(form) {
+        const optionsResponse = await post("/account/passkeys/options");
+        if (!optionsResponse.ok) {
+            alert(await optionsResponse.text());
+            return;
+        }
+        const options = await optionsResponse.json();
+        options.challenge = fromB64(options.challenge);
+        options.user.id = fromB64(options.user.id);
+        options.excludeCredentials.forEach((c) => (c.id = fromB64(c.id)));
+
+        let credential;
+        try {
+            credential = await navigator.credentials.create({ publicKey: options });
+        } catch (e) {
+            if (e.name === "InvalidStateError") {
+                alert("Этот ключ уже добавлен");
+            }
+            return;
+        }
+
+        const response = await post("/account/passkeys", {
+            name: new FormData(form).get("name"),
+            clientDataJSON: toB64(credential.response.clientDataJSON),
+            attestationObject: toB64(credential.response.attestationObject),
+        });
+        htmx.swap("#passkeys", await response.text(), { swapStyle: "outerHTML" });
+    }
+
+    // Формы перерисовываются htmx, поэтому обработчики вешаются на document
+    document.addEventListener("click", (e) => {
+        if (e.target.closest("[data-passkey-login]") && supported()) {
+            login();
+        }
+    });
+    document.addEventListener("submit", (e) => {
+        const form = e.target.closest("[data-passkey-register]");
+        if (form) {
+            e.preventDefault();
+            if (supported()) {
+                register(form);
+            }
+        }
+    });
+})();
@@ -0,0 +1,326 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/google/uuid"
+	"github.com/svuvi/theweek/components"
+	"github.com/svuvi/theweek/models"
+	"github.com/svuvi/theweek/qrcode"
+	"github.com/svuvi/theweek/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Сколько времени даётся на ввод кода после проверки пароля или на действие с ключом доступа
+const preSessionLifetime = 5 * time.Minute
+
+var errPreSessionInvalid = errors.New("предварительная сессия истекла или выдана для другого действия")
+
+const backupCodesCount = 10
+
+// startPreSession сохраняет незавершённый вход или церемонию WebAuthn и выставляет куки pre_session
+func (h *BaseHandler) startPreSession(w http.ResponseWriter, purpose string, userID int, challenge []byte) error {
+	key := uuid.NewString()
+	if _, err := h.preSessionRepo.Create(purpose, userID, key, challenge, preSessionLifetime); err != nil {
+		return err
+	}
+
+	h.setCookie(w, "pre_session", key, int(preSessionLifetime/time.Second))
+	return nil
+}
+
+// getPreSessionKey читает и валидирует "pre_session" куки из запроса
+func getPreSessionKey(r *http.Request) (string, error) {
+	cookie, err := r.Cookie("pre_session")
+	if err != nil {
+		return "", err
+	}
+	if err = uuid.Validate(cookie.Value); err != nil {
+		return "", err
+	}
+
+	return cookie.Value, nil
+}
+
+// getPreSession возвращает действующую предварительную сессию с нужным назначением
+func (h *BaseHandler) getPreSession(r *http.Request, purpose string) (*models.PreSession, error) {
+	key, err := getPreSessionKey(r)
+	if err != nil {
+		return nil, err
+	}
+	pre, err := h.preSessionRepo.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if pre.IsExpired() || pre.Purpose != purpose {
+		return nil, errPreSessionInvalid
+	}
+	return pre, nil
+}
+
+// finishPreSession удаляет предварительную сессию и её куки
+func (h *BaseHandler) finishPreSession(w http.ResponseWriter, pre *models.PreSession) {
+	if err := h.preSessionRepo.Delete(pre.ID); err != nil {
+		log.Printf("Ошибка при удалении предварительной сессии с ID=%d:\n%v", pre.ID, err)
+	}
+	h.clearCookie(w, "pre_session")
+}
+
+// admin2FARequired сообщает, обязаны ли администраторы использовать двухфакторную аутентификацию
+func (h *BaseHandler) admin2FARequired() bool {
+	value, err := h.settingsRepo.Get(models.SettingRequireAdmin2FA)
+	if err != nil {
+		log.Print("Ошибка при чтении настройки 2FA для администраторов:\n", err)
+	}
+	return value == "1"
+}
+
+// totpLoginHandler - второй шаг входа: проверка кода из приложения или резервного кода
+func (h *BaseHandler) totpLoginHandler(w http.ResponseWriter, r *http.Request) {
+	expired := func() {
+		w.WriteHeader(http.StatusUnauthorized)
+		components.LoginForm("", "", components.Empty(), components.FormWarning("Время на ввод кода истекло, войдите заново")).Render(r.Context(), w)
+	}
+
+	pre, err := h.getPreSession(r, models.PreSessionTOTP)
+	if err != nil {
+		expired()
+		return
+	}
+	user, err := h.userRepo.GetByID(pre.UserID)
+	if err != nil {
+		expired()
+		return
+	}
+
+	ip := clientIP(r)
+	if ok, retry := h.ipLimiter.Allow(ip); !ok {
+		tooManyAttempts(w, retry)
+		components.TOTPLoginForm(components.FormWarning(tooManyAttemptsMessage(retry))).Render(r.Context(), w)
+		return
+	}
+	if ok, retry := h.usernameLimiter.Allow(strings.ToLower(user.Username)); !ok {
+		tooManyAttempts(w, retry)
+		components.TOTPLoginForm(components.FormWarning(tooManyAttemptsMessage(retry))).Render(r.Context(), w)
+		return
+	}
+	if user.IsLocked() {
+		w.WriteHeader(http.StatusForbidden)
+		components.TOTPLoginForm(components.FormWarning("Вход в аккаунт временно заблокирован из-за неудачных попыток входа")).Render(r.Context(), w)
+		return
+	}
+
+	code := r.PostFormValue("code")
+	accepted := false
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+		// Каждый код принимается только один раз
+		accepted, err = h.userRepo.UseTOTPStep(user.ID, step)
+	} else if backupCode := totp.NormalizeBackupCode(code); backupCode != "" {
+		accepted, err = h.backupCodeRepo.Use(user.ID, backupCode)
+		if accepted {
+			log.Printf("Пользователь %s вошёл по резервному коду", user.Username)
+			if err := h.auditRepo.Create(user.ID, models.AuditBackupCode, "", ip); err != nil {
+				log.Print("Ошибка при записи в журнал безопасности:\n", err)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Ошибка при проверке кода 2FA пользователя %s:\n%v", user.Username, err)
+	}
+	if !accepted {
+		h.recordFailedLogin(user, ip)
+		w.WriteHeader(http.StatusUnauthorized)
+		components.TOTPLoginForm(components.FormWarning("Неверный код")).Render(r.Context(), w)
+		return
+	}
+
+	h.finishPreSession(w, pre)
+
+	if user.FailedLogins > 0 {
+		if err = h.userRepo.Unlock(user.ID); err != nil {
+			log.Printf("Ошибка при сбросе счётчика неудачных попыток входа пользователя %s:\n%v", user.Username, err)
+		}
+	}
+
+	if err = h.createSession(w, r, user.ID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		components.TOTPLoginForm(components.FormWarning("Ошибка на стороне сервера")).Render(r.Context(), w)
+		return
+	}
+
+	components.LoggedIn().Render(r.Context(), w)
+}
+
+// totpSetup создаёт новый секрет и показывает QR-код для приложения-аутентификатора
+func (h *BaseHandler) totpSetup(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	if user.TOTPEnabled {
+		components.TwoFactorSettings(user, 0, components.FormWarning("Двухфакторная аутентификация уже включена")).Render(r.Context(), w)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err == nil {
+		err = h.userRepo.SetTOTPSecret(user.ID, secret)
+	}
+	if err != nil {
+		log.Printf("Ошибка при создании секрета 2FA для пользователя %s:\n%v", user.Username, err)
+		components.TwoFactorSettings(user, 0, components.FormWarning("Внутренняя ошибка сервера")).Render(r.Context(), w)
+		return
+	}
+
+	h.renderTOTPSetup(w, r, user.Username, secret, templ.NopComponent)
+}
+
+func (h *BaseHandler) renderTOTPSetup(w http.ResponseWriter, r *http.Request, username, secret string, result templ.Component) {
+	qr, err := qrcode.Encode([]byte(totp.URI(h.config.SiteName, username, secret)))
+	svg := ""
+	if err != nil {
+		log.Printf("Ошибка при создании QR-кода 2FA для пользователя %s:\n%v", username, err)
+	} else {
+		svg = qr.SVG()
+	}
+
+	components.TOTPSetup(secret, svg, result).Render(r.Context(), w)
+}
+
+// totpEnable включает 2FA после того, как пользователь ввёл первый код из приложения
+func (h *BaseHandler) totpEnable(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		components.TwoFactorSettings(user, 0, components.FormWarning("Начните подключение заново")).Render(r.Context(), w)
+		return
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, r.PostFormValue("code"), time.Now())
+	if !ok {
+		h.renderTOTPSetup(w, r, user.Username, user.TOTPSecret, components.FormWarning("Неверный код. Проверьте время на телефоне"))
+		return
+	}
+
+	codes, err := totp.GenerateBackupCodes(backupCodesCount)
+	if err == nil {
+		err = h.backupCodeRepo.Replace(user.ID, codes)
+	}
+	if err == nil {
+		err = h.userRepo.EnableTOTP(user.ID)
+	}
+	if err != nil {
+		log.Printf("Ошибка при включении 2FA для пользователя %s:\n%v", user.Username, err)
+		h.renderTOTPSetup(w, r, user.Username, user.TOTPSecret, components.FormWarning("Внутренняя ошибка сервера"))
+		return
+	}
+	if _, err = h.userRepo.UseTOTPStep(user.ID, step); err != nil {
+		log.Printf("Ошибка при сохранении шага кода 2FA пользователя %s:\n%v", user.Username, err)
+	}
+
+	log.Printf("Пользователь %s включил двухфакторную аутентификацию", user.Username)
+	if err = h.auditRepo.Create(user.ID, models.AuditTOTPEnabled, "", clientIP(r)); err != nil {
+		log.Print("Ошибка при записи в журнал безопасности:\n", err)
+	}
+
+	components.TOTPBackupCodes(codes).Render(r.Context(), w)
+}
+
+// checkAccountPassword проверяет пароль, которым пользователь подтверждает изменение настроек 2FA
+func checkAccountPassword(user *models.User, password string) bool {
+	if !acceptablePassword(password) {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.HashedPassowrd), []byte(password)) == nil
+}
+
+func (h *BaseHandler) totpDisable(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	backupCodesLeft, _ := h.backupCodeRepo.CountUnused(user.ID)
+
+	if user.Role == models.RoleAdmin && h.admin2FARequired() {
+		components.TwoFactorSettings(user, backupCodesLeft, components.FormWarning("Администраторам запрещено отключать двухфакторную аутентификацию")).Render(r.Context(), w)
+		return
+	}
+	if !checkAccountPassword(user, r.PostFormValue("password")) {
+		components.TwoFactorSettings(user, backupCodesLeft, components.FormWarning("Неверный пароль")).Render(r.Context(), w)
+		return
+	}
+
+	err := h.userRepo.DisableTOTP(user.ID)
+	if err == nil {
+		err = h.backupCodeRepo.Replace(user.ID, nil)
+	}
+	if err != nil {
+		log.Printf("Ошибка при отключении 2FA для пользователя %s:\n%v", user.Username, err)
+		components.TwoFactorSettings(user, backupCodesLeft, components.FormWarning("Внутренняя ошибка сервера")).Render(r.Context(), w)
+		return
+	}
+
+	log.Printf("Пользователь %s отключил двухфакторную аутентификацию", user.Username)
+	if err = h.auditRepo.Create(user.ID, models.AuditTOTPDisabled, "", clientIP(r)); err != nil {
+		log.Print("Ошибка при записи в журнал безопасности:\n", err)
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	components.TwoFactorSettings(user, 0, components.FormOK("Двухфакторная аутентификация отключена")).Render(r.Context(), w)
+}
+
+// totpBackupCodes заменяет резервные коды новыми
+func (h *BaseHandler) totpBackupCodes(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	backupCodesLeft, _ := h.backupCodeRepo.CountUnused(user.ID)
+
+	if !user.TOTPEnabled {
+		components.TwoFactorSettings(user, backupCodesLeft, components.FormWarning("Двухфакторная аутентификация выключена")).Render(r.Context(), w)
+		return
+	}
+	if !checkAccountPassword(user, r.PostFormValue("password")) {
+		components.TwoFactorSettings(user, backupCodesLeft, components.FormWarning("Неверный пароль")).Render(r.Context(), w)
+		return
+	}
+
+	codes, err := totp.GenerateBackupCodes(backupCodesCount)
+	if err == nil {
+		err = h.backupCodeRepo.Replace(user.ID, codes)
+	}
+	if err != nil {
+		log.Printf("Ошибка при создании резервных кодов для пользователя %s:\n%v", user.Username, err)
+		components.TwoFactorSettings(user, backupCodesLeft, components.FormWarning("Внутренняя ошибка сервера")).Render(r.Context(), w)
+		return
+	}
+
+	components.TOTPBackupCodes(codes).Render(r.Context(), w)
+}
+
+func (h *BaseHandler) setAdmin2FAPolicy(w http.ResponseWriter, r *http.Request) {
+	user, _ := currentUser(r)
+	required := r.PostFormValue("required") != ""
+
+	// Иначе администратор сразу потеряет доступ к панели, из которой включил политику
+	if required && !user.TOTPEnabled {
+		components.Admin2FAPolicyForm(false, components.FormWarning("Сначала включите двухфакторную аутентификацию в своём аккаунте")).Render(r.Context(), w)
+		return
+	}
+
+	value := "0"
+	details := "2FA для администраторов не обязательна"
+	if required {
+		value = "1"
+		details = "2FA для администраторов обязательна"
+	}
+	if err := h.settingsRepo.Set(models.SettingRequireAdmin2FA, value); err != nil {
+		log.Print("Ошибка при сохранении настройки 2FA для администраторов:\n", err)
+		components.Admin2FAPolicyForm(!required, components.FormWarning("Ошибка сервера при сохранении")).Render(r.Context(), w)
+		return
+	}
+
+	log.Printf("Администратор %s: %s", user.Username, details)
+	if err := h.auditRepo.Create(user.ID, models.AuditPolicy, details, clientIP(r)); err != nil {
+		log.Print("Ошибка при записи в журнал безопасности:\n", err)
+	}
+
+	components.Admin2FAPolicyForm(required, components.FormOK("Сохранено")).Render(r.Context(), w)
+}
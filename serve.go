@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/svuvi/theweek/backup"
+	"github.com/svuvi/theweek/handoff"
+	"github.com/svuvi/theweek/jobs"
+	"github.com/svuvi/theweek/middleware"
+	"github.com/svuvi/theweek/models"
+	"github.com/svuvi/theweek/ratelimit"
+	"github.com/svuvi/theweek/repositories"
+	"github.com/svuvi/theweek/routes"
+)
+
+func runServe(fs *flag.FlagSet, args []string) error {
+	migrateOnly := fs.Bool("migrate-only", false, "применить миграции базы данных и выйти")
+	cfg, err := loadConfig(fs, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	blobs, err := openBlobStore(cfg, conn)
+	if err != nil {
+		return err
+	}
+	if *migrateOnly {
+		return nil
+	}
+
+	ln, err := handoff.Listen(cfg.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть сокет:\n%w", err)
+	}
+
+	warnIfNoAdmin(repositories.NewUserRepo(conn))
+
+	// Фоновые задачи останавливаются вместе с сервером, до закрытия базы данных
+	ctx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	var jobsDone sync.WaitGroup
+	startJob := func(job func()) {
+		jobsDone.Add(1)
+		go func() {
+			defer jobsDone.Done()
+			job()
+		}()
+	}
+
+	// 10 попыток подряд, затем одна в 30 секунд с IP и одна в минуту на логин
+	ipLimiter := ratelimit.New("login_ip", 10, 30*time.Second)
+	usernameLimiter := ratelimit.New("login_username", 10, time.Minute)
+
+	startJob(func() { jobs.PublishScheduled(ctx, repositories.NewArticleRepo(conn), time.Minute) })
+	startJob(func() {
+		jobs.PersistRateLimits(ctx, repositories.NewRateLimitRepo(conn), time.Minute, ipLimiter, usernameLimiter)
+	})
+	startJob(func() { jobs.CleanupSessions(ctx, repositories.NewSessionRepo(conn), cfg.SessionPolicy(), time.Hour) })
+
+	backupStore := backup.NewStore(conn, cfg.BackupDir, cfg.BackupPolicy())
+	if backupStore.Enabled() {
+		startJob(func() { jobs.Backups(ctx, backupStore, 10*time.Minute) })
+	}
+
+	h := routes.NewBaseHandler(conn, cfg, blobs, backupStore, ipLimiter, usernameLimiter)
+	router := middleware.NewLogger(h.NewRouter())
+
+	server := &http.Server{
+		Handler: router,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(ln) }()
+	log.Printf("Сервер слушает %s, публичный адрес %s", ln.Addr(), cfg.BaseURL)
+	if err = handoff.Ready(); err != nil {
+		log.Print(err)
+	}
+
+	waitForShutdown(ln, serveErr)
+
+	// Новые соединения больше не принимаются, начатые запросы дорабатывают
+	log.Print("Останавливаю сервер...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		log.Print("Не все запросы успели завершиться:\n", err)
+	}
+
+	stopJobs()
+	jobsDone.Wait()
+	log.Print("Сервер остановлен")
+	return nil
+}
+
+// waitForShutdown ждёт сигнала остановки. SIGHUP и SIGUSR2 запускают новую версию программы,
+// которая получает сокет и, когда будет готова, присылает этому процессу SIGTERM
+func waitForShutdown(ln net.Listener, serveErr <-chan error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	var child *os.Process
+	childExited := make(chan error, 1)
+
+	for {
+		select {
+		case err := <-serveErr:
+			log.Print("Сервер перестал принимать соединения:\n", err)
+			return
+
+		case err := <-childExited:
+			log.Printf("Новая версия (PID %d) завершилась, не приняв работу: %v", child.Pid, err)
+			child = nil
+
+		case sig := <-signals:
+			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+				return
+			}
+			if child != nil {
+				log.Printf("Новая версия (PID %d) уже запускается", child.Pid)
+				continue
+			}
+
+			var err error
+			child, err = handoff.Restart(ln)
+			if err != nil {
+				log.Print("Не удалось запустить новую версию:\n", err)
+				continue
+			}
+			log.Printf("Запущена новая версия (PID %d), передаю ей сокет", child.Pid)
+			go func(p *os.Process) {
+				state, err := p.Wait()
+				if err == nil {
+					err = errors.New(state.String())
+				}
+				childExited <- err
+			}(child)
+		}
+	}
+}
+
+// warnIfNoAdmin подсказывает, как создать первого администратора на свежей базе
+// или там, где остался только admin с отключённым старым паролем
+func warnIfNoAdmin(userRepo models.UserRepository) {
+	users, err := userRepo.GetAll()
+	if err != nil {
+		log.Print("Ошибка при загрузке пользователей:\n", err)
+		return
+	}
+	for _, u := range users {
+		if u.Role == models.RoleAdmin && !u.LoginDisabled() {
+			return
+		}
+	}
+	log.Print("В базе нет ни одного администратора. Создайте его командой: theweek user create -admin <логин>")
+}
@@ -0,0 +1,117 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Секрет из приложения B RFC 6238 ("12345678901234567890") в base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Векторы SHA-1 из RFC 6238, последние 6 цифр восьмизначных кодов
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, v := range rfcVectors {
+		got, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.code {
+			t.Errorf("Code(%d) = %s, ожидалось %s", v.unix, got, v.code)
+		}
+	}
+
+	// Секрет в нижнем регистре тоже принимается
+	if got, _ := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1); got != "287082" {
+		t.Errorf("секрет в нижнем регистре: %s", got)
+	}
+	if _, err := Code("не base32", 1); err == nil {
+		t.Error("некорректный секрет принят")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, v := range rfcVectors {
+		at := time.Unix(v.unix, 0)
+		step := Step(at)
+
+		tests := []struct {
+			name   string
+			offset time.Duration
+			ok     bool
+		}{
+			{"тот же шаг", 0, true},
+			{"на шаг раньше", -Period, true},
+			{"на шаг позже", Period, true},
+			{"на два шага раньше", -2 * Period, false},
+			{"на два шага позже", 2 * Period, false},
+		}
+		for _, tt := range tests {
+			// Время до 1970 года не бывает, а шаги около нуля округляются к нулю
+			if at.Add(tt.offset).Unix() < 0 {
+				continue
+			}
+			got, ok := Validate(rfcSecret, v.code, at.Add(tt.offset))
+			if ok != tt.ok {
+				t.Errorf("%d, %s: ok = %v, ожидалось %v", v.unix, tt.name, ok, tt.ok)
+			}
+			if ok && got != step {
+				t.Errorf("%d, %s: шаг %d, ожидался %d", v.unix, tt.name, got, step)
+			}
+		}
+	}
+
+	at := time.Unix(59, 0)
+	for _, code := range []string{"287 082", " 287082 "} {
+		if _, ok := Validate(rfcSecret, code, at); !ok {
+			t.Errorf("код %q с пробелами не принят", code)
+		}
+	}
+	for _, code := range []string{"", "28708", "2870820", "287083", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, at); ok {
+			t.Errorf("принят неверный код %q", code)
+		}
+	}
+}
+
+func TestNormalizeBackupCode(t *testing.T) {
+	codes, err := GenerateBackupCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if NormalizeBackupCode(code) != code || seen[code] {
+			t.Errorf("код %q не в каноническом виде или повторяется", code)
+		}
+		seen[code] = true
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"abcd-efgh", "abcd-efgh"},
+		{"ABCD EFGH", "abcd-efgh"},
+		{"abcdefgh", "abcd-efgh"},
+		{"abcd-efg", ""},
+		{"abcd-efg1", ""}, // 1 нет в алфавите base32
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeBackupCode(tt.input); got != tt.want {
+			t.Errorf("NormalizeBackupCode(%q) = %q, ожидалось %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -22,66 +22,54 @@ fi
 
 # 3. Билдим приложение
 echo "Создаю билд приложения..."
-go build -o "$SCRIPT_DIR/bin/theweek-new"
+go build -tags sqlite_fts5 -o "$SCRIPT_DIR/bin/theweek-new"
 
 if [ $? -ne 0 ]; then
     echo "Билд не удался. Отмена."
     exit 1
 fi
 
-# 4. Останавливаем сервис
-echo "Останавливаю сервис theweek..."
-sudo service theweek stop
-
-if [ $? -ne 0 ]; then
-    echo "Не удалось остановить сервис theweek. Отмена."
-    exit 1
-fi
-
-# 5. Бэкап базы данных
+# 4. Бэкап базы данных. Копия делается на ходу, сервис не останавливается
 datetime=$(date +"%Y%m%d-%H%M%S")
 backup_path="$HOME/DBbackups/$datetime-prod.db"
 echo "Бэкаплю базу данных в $backup_path..."
-cp "$SCRIPT_DIR/bin/database.db" "$backup_path"
+(cd "$SCRIPT_DIR/bin" && ./theweek-new db backup "$backup_path")
 
 if [ $? -ne 0 ]; then
-    echo "Бэкап базы данных не удался. Восстанавливаю старую версию сервиса."
-    sudo service theweek start
-    if [ $? -ne 0 ]; then
-        echo "Рестарт сервиса не удался. Требуется ручное вмешательство."
-        exit 1
-    fi
+    echo "Бэкап базы данных не удался. Отмена."
     exit 1
 fi
 
-# 6. Удаляем старую версию
-echo "Удаляю старую версию..."
-rm -f "$SCRIPT_DIR/bin/theweek"
+# 5. Кладём новую версию на место старой. Работающий процесс продолжает выполнять старый файл
+echo "Заменяю исполняемый файл..."
+mv -f "$SCRIPT_DIR/bin/theweek" "$SCRIPT_DIR/bin/theweek-old" && mv "$SCRIPT_DIR/bin/theweek-new" "$SCRIPT_DIR/bin/theweek"
 
 if [ $? -ne 0 ]; then
-    echo "Не удалось удалить старую версию. Отмена. Восстанавливаю старую версию сервиса."
-    sudo service theweek start
-    if [ $? -ne 0 ]; then
-        echo "Рестарт сервиса не удался. Требуется ручное вмешательство."
-        exit 1
-    fi
+    echo "Не удалось заменить исполняемый файл. Требуется ручное вмешательство."
     exit 1
 fi
 
-# 7. Переименовываем новую версию 
-mv "$SCRIPT_DIR/bin/theweek-new" "$SCRIPT_DIR/bin/theweek"
-if [ $? -ne 0 ]; then
-    echo "Не удалось переименовать новый исполняемый файл. Отмена."
-    exit 1
-fi
-
-# 8. Запускаем сервис
-echo "Запускаю сервис theweek..."
-sudo service theweek start
+# 6. Перезапуск без простоя: старый процесс запускает новую версию и передаёт ей сокет,
+# новая версия применяет миграции и начинает принимать запросы, старая дорабатывает начатые и выходит
+old_pid=$(systemctl show -p MainPID --value theweek)
+echo "Перезапускаю сервис theweek (PID $old_pid)..."
+sudo systemctl reload theweek
+
+new_pid=$old_pid
+for i in $(seq 1 30); do
+    sleep 1
+    new_pid=$(systemctl show -p MainPID --value theweek)
+    if [ "$new_pid" != "$old_pid" ] && [ "$new_pid" != "0" ]; then
+        break
+    fi
+done
 
-if [ $? -ne 0 ]; then
-    echo "Рестарт сервиса не удался. Требуется ручное вмешательство."
+if [ "$new_pid" = "$old_pid" ] || [ "$new_pid" = "0" ]; then
+    echo "Новая версия не запустилась, старая продолжает работать. Возвращаю старый исполняемый файл."
+    echo "Причина в журнале: journalctl -u theweek"
+    mv -f "$SCRIPT_DIR/bin/theweek-old" "$SCRIPT_DIR/bin/theweek"
     exit 1
 fi
 
-echo "Обновление и перезапуск завершены успешно"
\ No newline at end of file
+rm -f "$SCRIPT_DIR/bin/theweek-old"
+echo "Обновление завершено успешно, новый PID $new_pid"
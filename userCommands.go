@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/svuvi/theweek/config"
+	"github.com/svuvi/theweek/models"
+	"github.com/svuvi/theweek/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func runUserCreate(fs *flag.FlagSet, args []string) error {
+	admin := fs.Bool("admin", false, "создать администратора (то же, что -role admin)")
+	role := fs.String("role", string(models.RoleReader), "роль пользователя: reader, author, editor или admin")
+	cfg, err := loadConfig(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *admin {
+		*role = string(models.RoleAdmin)
+	}
+	if !models.Role(*role).Valid() {
+		return fmt.Errorf("неизвестная роль %q", *role)
+	}
+
+	username := fs.Arg(0)
+	if len(username) < 2 || len(username) > 30 {
+		return errors.New("логин должен быть длиной от 2 до 30 символов")
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	userRepo := repositories.NewUserRepo(conn)
+
+	if _, err = userRepo.GetByUsername(username); err != sql.ErrNoRows {
+		if err == nil {
+			return fmt.Errorf("логин %s уже занят", username)
+		}
+		return err
+	}
+
+	hash, err := readNewPassword(cfg)
+	if err != nil {
+		return err
+	}
+
+	user, err := userRepo.Create(username, hash)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании пользователя:\n%w", err)
+	}
+	if models.Role(*role) != models.RoleReader {
+		if err = userRepo.SetRole(user.ID, models.Role(*role)); err != nil {
+			return fmt.Errorf("пользователь создан, но не удалось назначить роль:\n%w", err)
+		}
+	}
+
+	fmt.Printf("Создан пользователь %s (%s). Войти: %s/login\n", username, models.Role(*role).Label(), cfg.BaseURL)
+	return nil
+}
+
+func runUserResetPassword(fs *flag.FlagSet, args []string) error {
+	cfg, err := loadConfig(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	conn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	userRepo := repositories.NewUserRepo(conn)
+
+	user, err := userRepo.GetByUsername(fs.Arg(0))
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("пользователь %s не найден", fs.Arg(0))
+	} else if err != nil {
+		return err
+	}
+
+	hash, err := readNewPassword(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err = userRepo.ChangePassword(user.ID, hash); err != nil {
+		return fmt.Errorf("ошибка при смене пароля:\n%w", err)
+	}
+	if err = userRepo.Unlock(user.ID); err != nil {
+		return fmt.Errorf("пароль изменён, но не удалось снять блокировку входа:\n%w", err)
+	}
+	// Пароль сбрасывают, когда доступ к аккаунту потерян или мог попасть в чужие руки
+	n, err := repositories.NewSessionRepo(conn).SetInactiveExcept(user.ID, 0)
+	if err != nil {
+		return fmt.Errorf("пароль изменён, но не удалось завершить сессии:\n%w", err)
+	}
+	if err = repositories.NewAuditRepo(conn).Create(user.ID, models.AuditPasswordCLI, "", ""); err != nil {
+		fmt.Fprintln(os.Stderr, "Не удалось записать событие в журнал безопасности:", err)
+	}
+
+	fmt.Printf("Пароль пользователя %s изменён, завершено сессий: %d\n", user.Username, n)
+	if user.TOTPEnabled {
+		fmt.Println("У пользователя включена 2FA, для входа по-прежнему нужен код из приложения или резервный код")
+	}
+	return nil
+}
+
+// stdin общий для всех запросов ввода, чтобы при вводе из канала буферизация не теряла следующие строки
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassword читает пароль со стандартного ввода. Если ввод идёт с терминала, эхо отключается через stty
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", errors.New("пароль не введён")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readNewPassword запрашивает пароль дважды и возвращает его bcrypt-хэш
+func readNewPassword(cfg *config.Config) (string, error) {
+	password, err := readPassword("Пароль: ")
+	if err != nil {
+		return "", err
+	}
+	if len(password) < 6 || len(password) > 72 {
+		return "", errors.New("пароль должен быть длиной от 6 до 72 символов")
+	}
+	repeat, err := readPassword("Пароль ещё раз: ")
+	if err != nil {
+		return "", err
+	}
+	if repeat != password {
+		return "", errors.New("пароли не совпадают")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,142 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Минимальный декодер CBOR (RFC 8949): ровно то, что встречается в attestationObject и ключах COSE.
+// Целые числа возвращаются как int64, байтовые строки как []byte, массивы как []any, словари как map[any]any
+
+var errCBOR = errors.New("webauthn: некорректный CBOR")
+
+// Ограничение вложенности защищает от переполнения стека на специально собранных данных
+const maxCBORDepth = 16
+
+// decodeCBOR декодирует одно значение и возвращает оставшиеся после него байты
+func decodeCBOR(b []byte) (any, []byte, error) {
+	return decodeCBORItem(b, 0)
+}
+
+func decodeCBORItem(b []byte, depth int) (any, []byte, error) {
+	if len(b) == 0 || depth > maxCBORDepth {
+		return nil, nil, errCBOR
+	}
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+	b = b[1:]
+
+	// Простые значения и числа с плавающей точкой
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, b, nil
+		case 21:
+			return true, b, nil
+		case 22, 23:
+			return nil, b, nil
+		case 25:
+			if len(b) < 2 {
+				return nil, nil, errCBOR
+			}
+			return nil, b[2:], nil // float16 в WebAuthn не используется, значение пропускается
+		case 26:
+			if len(b) < 4 {
+				return nil, nil, errCBOR
+			}
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), b[4:], nil
+		case 27:
+			if len(b) < 8 {
+				return nil, nil, errCBOR
+			}
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:], nil
+		}
+		return nil, nil, errCBOR
+	}
+
+	arg, b, err := readCBORArgument(info, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+		return int64(arg), b, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+		return -1 - int64(arg), b, nil
+	case 2, 3:
+		if arg > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		data := b[:arg]
+		if major == 3 {
+			return string(data), b[arg:], nil
+		}
+		return append([]byte(nil), data...), b[arg:], nil
+	case 4:
+		if arg > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		items := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item any
+			item, b, err = decodeCBORItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, b, nil
+	case 5:
+		if arg > uint64(len(b)) {
+			return nil, nil, errCBOR
+		}
+		m := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value any
+			key, b, err = decodeCBORItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errCBOR
+			}
+			value, b, err = decodeCBORItem(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, b, nil
+	case 6:
+		// Теги не важны для WebAuthn, возвращается само значение
+		return decodeCBORItem(b, depth+1)
+	}
+	return nil, nil, errCBOR
+}
+
+// readCBORArgument читает аргумент заголовка. Неопределённая длина (info = 31) не поддерживается
+func readCBORArgument(info byte, b []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), b, nil
+	case info == 24 && len(b) >= 1:
+		return uint64(b[0]), b[1:], nil
+	case info == 25 && len(b) >= 2:
+		return uint64(binary.BigEndian.Uint16(b)), b[2:], nil
+	case info == 26 && len(b) >= 4:
+		return uint64(binary.BigEndian.Uint32(b)), b[4:], nil
+	case info == 27 && len(b) >= 8:
+		return binary.BigEndian.Uint64(b), b[8:], nil
+	}
+	return 0, nil, errCBOR
+}
@@ -0,0 +1,106 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// Алгоритмы COSE, которые принимает сайт, в порядке предпочтения
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+var ErrUnsupportedKey = errors.New("webauthn: неподдерживаемый тип ключа")
+
+// Параметры ключей COSE (RFC 9053)
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // для RSA это модуль n
+	coseX   = -2 // для RSA это экспонента e
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// publicKey - разобранный открытый ключ COSE
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+func parseCOSEKey(raw []byte) (*publicKey, error) {
+	value, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := value.(map[any]any)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+	crv, _ := m[int64(coseCrv)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256 && crv == crvP256:
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: alg, key: pub}, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA && crv == crvEd25519:
+		x, _ := m[int64(coseX)].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseCrv)].([]byte)
+		e, _ := m[int64(coseX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedKey
+		}
+		exp := new(big.Int).SetBytes(e)
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}}, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// verify проверяет подпись message ключом
+func (k *publicKey) verify(message, signature []byte) bool {
+	switch pub := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(pub, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, message, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,293 @@
+// Package webauthn реализует серверную часть WebAuthn (вход по ключам доступа):
+// параметры церемоний регистрации и входа для navigator.credentials и проверку ответов браузера.
+// Аттестация не запрашивается и не проверяется, сайту не важно, какая модель ключа используется.
+// Спецификация: https://www.w3.org/TR/webauthn-2/
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// RelyingParty описывает сайт: ID - домен, к которому привязываются ключи, Origin - ожидаемый источник запросов
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// Timeout церемоний в миллисекундах
+const Timeout = 120000
+
+var (
+	ErrChallenge      = errors.New("webauthn: ответ на другой запрос")
+	ErrOrigin         = errors.New("webauthn: неверный источник запроса")
+	ErrRelyingParty   = errors.New("webauthn: ключ выдан для другого сайта")
+	ErrUserPresence   = errors.New("webauthn: пользователь не подтвердил действие на ключе")
+	ErrUserVerified   = errors.New("webauthn: ключ не проверил PIN-код или биометрию пользователя")
+	ErrSignature      = errors.New("webauthn: неверная подпись")
+	ErrSignCount      = errors.New("webauthn: счётчик подписей не вырос, ключ мог быть скопирован")
+	ErrMalformed      = errors.New("webauthn: некорректный ответ ключа")
+	ErrNoCredentialID = errors.New("webauthn: в ответе нет данных ключа")
+)
+
+var b64 = base64.RawURLEncoding
+
+// NewChallenge возвращает случайный вызов для одной церемонии
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	_, err := rand.Read(challenge)
+	return challenge, err
+}
+
+// Структуры ниже сериализуются в JSON для navigator.credentials. Двоичные поля передаются в base64url,
+// скрипт на странице превращает их в ArrayBuffer
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// UserHandle - идентификатор пользователя, который ключ хранит вместе с учётными данными
+func UserHandle(userID int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+// NewCreationOptions возвращает параметры регистрации нового ключа.
+// Ключи из exclude уже зарегистрированы, браузер не даст создать на них второй
+func (rp *RelyingParty) NewCreationOptions(challenge []byte, userID int, username string, exclude [][]byte) *CreationOptions {
+	o := &CreationOptions{
+		Challenge:   b64.EncodeToString(challenge),
+		Timeout:     Timeout,
+		Attestation: "none",
+	}
+	o.RP.ID = rp.ID
+	o.RP.Name = rp.Name
+	o.User.ID = b64.EncodeToString(UserHandle(userID))
+	o.User.Name = username
+	o.User.DisplayName = username
+	for _, alg := range SupportedAlgorithms {
+		o.PubKeyCredParams = append(o.PubKeyCredParams, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	o.ExcludeCredentials = descriptors(exclude)
+	// Ключ должен хранить учётную запись, чтобы входить без ввода логина
+	o.AuthenticatorSelection.ResidentKey = "required"
+	// Вход по ключу заменяет и пароль, и второй фактор, поэтому ключ без PIN-кода или биометрии не подходит
+	o.AuthenticatorSelection.UserVerification = "required"
+	return o
+}
+
+// NewRequestOptions возвращает параметры входа. С пустым allow браузер предложит любой ключ этого сайта
+func (rp *RelyingParty) NewRequestOptions(challenge []byte, allow [][]byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        b64.EncodeToString(challenge),
+		RPID:             rp.ID,
+		Timeout:          Timeout,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "required",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	result := []CredentialDescriptor{}
+	for _, id := range ids {
+		result = append(result, CredentialDescriptor{Type: "public-key", ID: b64.EncodeToString(id)})
+	}
+	return result
+}
+
+// Credential - ключ, прошедший регистрацию. PublicKey хранится в формате COSE
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// VerifyRegistration проверяет ответ navigator.credentials.create
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	value, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, err
+	}
+	attestation, ok := value.(map[any]any)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	authDataRaw, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	authData, err := rp.parseAuthenticatorData(authDataRaw)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, ErrNoCredentialID
+	}
+	if _, err = parseCOSEKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion проверяет ответ navigator.credentials.get для ключа с открытым ключом publicKey
+// и последним известным счётчиком storedSignCount. Возвращает новое значение счётчика
+func (rp *RelyingParty) VerifyAssertion(challenge, publicKey []byte, storedSignCount uint32, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.parseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	message := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+	if !key.verify(message, signature) {
+		return 0, ErrSignature
+	}
+
+	// Ключи без счётчика всегда присылают 0
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, ErrSignCount
+	}
+	return authData.signCount, nil
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return ErrMalformed
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: тип %q вместо %q", ErrMalformed, cd.Type, ceremony)
+	}
+	got, err := b64.DecodeString(cd.Challenge)
+	if err != nil || !bytes.Equal(got, challenge) {
+		return ErrChallenge
+	}
+	if cd.Origin != rp.Origin {
+		return ErrOrigin
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+const (
+	flagUserPresent     = 0x01
+	flagUserVerified    = 0x04
+	flagAttestedCredata = 0x40
+)
+
+func (rp *RelyingParty) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, ErrMalformed
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(raw[:32], rpIDHash[:]) {
+		return nil, ErrRelyingParty
+	}
+
+	d := &authenticatorData{
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if d.flags&flagUserPresent == 0 {
+		return nil, ErrUserPresence
+	}
+	// Браузер может проигнорировать userVerification: "required", поэтому флаг проверяется и здесь
+	if d.flags&flagUserVerified == 0 {
+		return nil, ErrUserVerified
+	}
+
+	if d.flags&flagAttestedCredata != 0 {
+		rest := raw[37:]
+		// AAGUID (16 байт) и длина идентификатора ключа (2 байта)
+		if len(rest) < 18 {
+			return nil, ErrMalformed
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || len(rest) < idLen {
+			return nil, ErrMalformed
+		}
+		d.credentialID = append([]byte(nil), rest[:idLen]...)
+		rest = rest[idLen:]
+
+		// После ключа COSE могут идти расширения, поэтому берём ровно одно значение CBOR
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, err
+		}
+		d.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+	}
+	return d, nil
+}
@@ -0,0 +1,287 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var testRP = &RelyingParty{ID: "example.com", Name: "Неделя", Origin: "https://example.com"}
+
+// authenticator - программный ключ ES256, который отвечает на церемонии так же, как браузер с ключом доступа
+type authenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+	flags        byte
+	rpID         string
+	origin       string
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &authenticator{
+		key:          key,
+		credentialID: []byte("credential-1"),
+		flags:        flagUserPresent | flagUserVerified,
+		rpID:         testRP.ID,
+		origin:       testRP.Origin,
+	}
+}
+
+func (a *authenticator) clientData(ceremony string, challenge []byte) []byte {
+	b, _ := json.Marshal(clientData{Type: ceremony, Challenge: b64.EncodeToString(challenge), Origin: a.origin})
+	return b
+}
+
+func (a *authenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	d := append(rpIDHash[:], flags)
+	d = binary.BigEndian.AppendUint32(d, a.signCount)
+	return append(d, attested...)
+}
+
+func (a *authenticator) coseKey() []byte {
+	x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+	return cborMap(
+		cborInt(coseKty), cborInt(ktyEC2),
+		cborInt(coseAlg), cborInt(AlgES256),
+		cborInt(coseCrv), cborInt(crvP256),
+		cborInt(coseX), cborBytes(x),
+		cborInt(coseY), cborBytes(y),
+	)
+}
+
+// create возвращает clientDataJSON и attestationObject для navigator.credentials.create
+func (a *authenticator) create(challenge []byte) ([]byte, []byte) {
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, a.coseKey()...)
+
+	attestation := cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authData(a.flags|flagAttestedCredata, attested)),
+	)
+	return a.clientData("webauthn.create", challenge), attestation
+}
+
+// get возвращает clientDataJSON, authenticatorData и подпись для navigator.credentials.get
+func (a *authenticator) get(t *testing.T, challenge []byte) ([]byte, []byte, []byte) {
+	t.Helper()
+	a.signCount++
+	clientDataJSON := a.clientData("webauthn.get", challenge)
+	authData := a.authData(a.flags, nil)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientDataJSON, authData, signature
+}
+
+// Минимальный кодировщик CBOR для ответов ключа
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	}
+	return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+}
+
+func cborInt(n int) []byte {
+	if n < 0 {
+		return cborHead(1, uint64(-1-n))
+	}
+	return cborHead(0, uint64(n))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, uint64(len(b))), b...) }
+
+func cborText(s string) []byte { return append(cborHead(3, uint64(len(s))), s...) }
+
+func cborMap(pairs ...[]byte) []byte {
+	return append(cborHead(5, uint64(len(pairs)/2)), bytes.Join(pairs, nil)...)
+}
+
+func register(t *testing.T, a *authenticator) *Credential {
+	t.Helper()
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDataJSON, attestation := a.create(challenge)
+	cred, err := testRP.VerifyRegistration(challenge, clientDataJSON, attestation)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return cred
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	a := newAuthenticator(t)
+	cred := register(t, a)
+	if !bytes.Equal(cred.ID, a.credentialID) || cred.SignCount != 0 {
+		t.Fatalf("ключ после регистрации: ID %q, счётчик %d", cred.ID, cred.SignCount)
+	}
+
+	for i := 1; i <= 3; i++ {
+		challenge, _ := NewChallenge()
+		clientDataJSON, authData, signature := a.get(t, challenge)
+		signCount, err := testRP.VerifyAssertion(challenge, cred.PublicKey, cred.SignCount, clientDataJSON, authData, signature)
+		if err != nil {
+			t.Fatalf("вход %d: %v", i, err)
+		}
+		if signCount != uint32(i) {
+			t.Fatalf("вход %d: счётчик %d", i, signCount)
+		}
+		cred.SignCount = signCount
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(a *authenticator, challenge []byte) []byte // возвращает вызов, на который ответит ключ
+		want   error
+	}{
+		{"другой источник", func(a *authenticator, challenge []byte) []byte {
+			a.origin = "https://evil.example"
+			return challenge
+		}, ErrOrigin},
+		{"другой вызов", func(a *authenticator, challenge []byte) []byte {
+			return []byte("другой вызов")
+		}, ErrChallenge},
+		{"другой сайт", func(a *authenticator, challenge []byte) []byte {
+			a.rpID = "evil.example"
+			return challenge
+		}, ErrRelyingParty},
+		{"ключ без PIN-кода", func(a *authenticator, challenge []byte) []byte {
+			a.flags = flagUserPresent
+			return challenge
+		}, ErrUserVerified},
+		{"без касания ключа", func(a *authenticator, challenge []byte) []byte {
+			a.flags = flagUserVerified
+			return challenge
+		}, ErrUserPresence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthenticator(t)
+			challenge, _ := NewChallenge()
+			clientDataJSON, attestation := a.create(tt.modify(a, challenge))
+			_, err := testRP.VerifyRegistration(challenge, clientDataJSON, attestation)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ошибка %v, ожидалась %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		// modify меняет ответ ключа перед проверкой, storedSignCount - счётчик, сохранённый на сервере
+		modify          func(a *authenticator, challenge []byte) (clientDataJSON, authData, signature []byte)
+		storedSignCount uint32
+		want            error
+	}{
+		{"другой источник", func(a *authenticator, challenge []byte) ([]byte, []byte, []byte) {
+			a.origin = "https://evil.example"
+			return nil, nil, nil
+		}, 0, ErrOrigin},
+		{"другой вызов", func(a *authenticator, challenge []byte) ([]byte, []byte, []byte) {
+			challenge[0] ^= 0xff
+			return nil, nil, nil
+		}, 0, ErrChallenge},
+		{"подпись изменена", func(a *authenticator, challenge []byte) ([]byte, []byte, []byte) {
+			return nil, nil, []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x01}
+		}, 0, ErrSignature},
+		{"данные ключа изменены после подписи", func(a *authenticator, challenge []byte) ([]byte, []byte, []byte) {
+			a.signCount = 100
+			return nil, a.authData(a.flags, nil), nil
+		}, 0, ErrSignature},
+		{"ключ без PIN-кода", func(a *authenticator, challenge []byte) ([]byte, []byte, []byte) {
+			a.flags = flagUserPresent
+			return nil, nil, nil
+		}, 0, ErrUserVerified},
+		{"повтор счётчика", func(a *authenticator, challenge []byte) ([]byte, []byte, []byte) {
+			return nil, nil, nil
+		}, 1, ErrSignCount},
+		{"счётчик меньше сохранённого", func(a *authenticator, challenge []byte) ([]byte, []byte, []byte) {
+			return nil, nil, nil
+		}, 5, ErrSignCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAuthenticator(t)
+			cred := register(t, a)
+			challenge, _ := NewChallenge()
+
+			signed := append([]byte(nil), challenge...)
+			clientDataJSON, authData, signature := tt.modify(a, signed)
+			a.signCount = 0
+			cd, ad, sig := a.get(t, signed)
+			if clientDataJSON == nil {
+				clientDataJSON = cd
+			}
+			if authData == nil {
+				authData = ad
+			}
+			if signature == nil {
+				signature = sig
+			}
+
+			_, err := testRP.VerifyAssertion(challenge, cred.PublicKey, tt.storedSignCount, clientDataJSON, authData, signature)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ошибка %v, ожидалась %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Повторная отправка того же ответа отклоняется, потому что счётчик уже сохранён
+func TestLoginReplay(t *testing.T) {
+	a := newAuthenticator(t)
+	cred := register(t, a)
+	challenge, _ := NewChallenge()
+	clientDataJSON, authData, signature := a.get(t, challenge)
+
+	signCount, err := testRP.VerifyAssertion(challenge, cred.PublicKey, cred.SignCount, clientDataJSON, authData, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = testRP.VerifyAssertion(challenge, cred.PublicKey, signCount, clientDataJSON, authData, signature)
+	if !errors.Is(err, ErrSignCount) {
+		t.Errorf("повтор ответа: ошибка %v, ожидалась %v", err, ErrSignCount)
+	}
+}
+
+// Вход по ключу заменяет второй фактор, поэтому обе церемонии требуют проверки пользователя
+func TestOptionsRequireUserVerification(t *testing.T) {
+	challenge, _ := NewChallenge()
+	creation := testRP.NewCreationOptions(challenge, 1, "anna", nil)
+	request := testRP.NewRequestOptions(challenge, nil)
+	if creation.AuthenticatorSelection.UserVerification != "required" || request.UserVerification != "required" {
+		t.Errorf("userVerification: регистрация %q, вход %q",
+			creation.AuthenticatorSelection.UserVerification, request.UserVerification)
+	}
+}
@@ -0,0 +1,93 @@
+package webp
+
+// bitWriter пишет биты начиная с младшего, как их читает декодер VP8L
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nBits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v&(1<<n-1)) << w.nBits
+	w.nBits += n
+	for w.nBits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nBits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nBits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nBits = 0, 0
+	}
+	return w.buf
+}
+
+// encodeImage записывает пиксели argb шириной width: параметры кэша, префиксные коды и сами пиксели.
+// topLevel - основная картинка, у неё дополнительно указывается, что мета-кодов нет
+func encodeImage(bw *bitWriter, argb []uint32, width int, cacheBits uint, topLevel bool) {
+	tokens := tokenize(argb, width, cacheBits)
+
+	if cacheBits > 0 {
+		bw.write(1, 1)
+		bw.write(uint32(cacheBits), 4)
+	} else {
+		bw.write(0, 1)
+	}
+	if topLevel {
+		bw.write(0, 1)
+	}
+
+	var cacheSize int
+	if cacheBits > 0 {
+		cacheSize = 1 << cacheBits
+	}
+	green := make([]int, numLiterals+numLengths+cacheSize)
+	red := make([]int, numLiterals)
+	blue := make([]int, numLiterals)
+	alpha := make([]int, numLiterals)
+	distance := make([]int, numDistances)
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenLiteral:
+			green[t.value>>8&0xff]++
+			red[t.value>>16&0xff]++
+			blue[t.value&0xff]++
+			alpha[t.value>>24]++
+		case tokenCache:
+			green[numLiterals+numLengths+int(t.value)]++
+		case tokenCopy:
+			symbol, _, _ := prefixCode(t.length)
+			green[numLiterals+symbol]++
+			symbol, _, _ = prefixCode(int(t.value))
+			distance[symbol]++
+		}
+	}
+
+	greenCode := writeHuffmanCode(bw, green)
+	redCode := writeHuffmanCode(bw, red)
+	blueCode := writeHuffmanCode(bw, blue)
+	alphaCode := writeHuffmanCode(bw, alpha)
+	distanceCode := writeHuffmanCode(bw, distance)
+
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenLiteral:
+			greenCode.write(bw, int(t.value>>8&0xff))
+			redCode.write(bw, int(t.value>>16&0xff))
+			blueCode.write(bw, int(t.value&0xff))
+			alphaCode.write(bw, int(t.value>>24))
+		case tokenCache:
+			greenCode.write(bw, numLiterals+numLengths+int(t.value))
+		case tokenCopy:
+			symbol, extraBits, extra := prefixCode(t.length)
+			greenCode.write(bw, numLiterals+symbol)
+			bw.write(extra, extraBits)
+			symbol, extraBits, extra = prefixCode(int(t.value))
+			distanceCode.write(bw, symbol)
+			bw.write(extra, extraBits)
+		}
+	}
+}
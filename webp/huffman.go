@@ -0,0 +1,249 @@
+package webp
+
+import "sort"
+
+// Порядок длин кодов для алфавита длин (раздел 5.2.2)
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+const (
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+)
+
+// huffmanCode хранит канонический префиксный код алфавита. bits - сколько бит занимает символ в потоке:
+// у кода из одного символа длина в заголовке 1, но декодер читает его без единого бита
+type huffmanCode struct {
+	codes []uint32 // коды с обратным порядком бит, готовые к записи в поток
+	bits  []uint8
+}
+
+func (c *huffmanCode) write(bw *bitWriter, symbol int) {
+	bw.write(c.codes[symbol], uint(c.bits[symbol]))
+}
+
+// writeHuffmanCode строит код по частотам символов, записывает его описание в поток и возвращает код
+func writeHuffmanCode(bw *bitWriter, counts []int) *huffmanCode {
+	var used []int
+	for symbol, n := range counts {
+		if n > 0 {
+			used = append(used, symbol)
+		}
+	}
+	code := &huffmanCode{codes: make([]uint32, len(counts)), bits: make([]uint8, len(counts))}
+
+	// Простой код: до двух символов меньше 256. Символ читается за 0 или 1 бит
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		bw.write(1, 1)
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+			code.codes[used[1]], code.bits[used[0]], code.bits[used[1]] = 1, 1, 1
+		}
+		return code
+	}
+
+	lengths := codeLengths(counts, maxCodeLength)
+	writeCodeLengths(bw, lengths)
+	code.codes = canonicalCodes(lengths)
+	for symbol, l := range lengths {
+		code.bits[symbol] = l
+	}
+	if len(used) == 1 {
+		code.bits[used[0]] = 0
+	}
+	return code
+}
+
+// writeCodeLengths записывает длины кодов, сжатые повторами (16 - повтор предыдущей длины,
+// 17 и 18 - серии нулей) и закодированные собственным префиксным кодом
+func writeCodeLengths(bw *bitWriter, lengths []uint8) {
+	type rle struct {
+		symbol    int
+		extraBits uint
+		extra     uint32
+	}
+	var tokens []rle
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == l {
+			run++
+		}
+		i += run
+
+		if l == 0 {
+			for run >= 11 {
+				n := min(run, 138)
+				tokens = append(tokens, rle{18, 7, uint32(n - 11)})
+				run -= n
+			}
+			if run >= 3 {
+				tokens = append(tokens, rle{17, 3, uint32(run - 3)})
+				run = 0
+			}
+			for ; run > 0; run-- {
+				tokens = append(tokens, rle{0, 0, 0})
+			}
+			continue
+		}
+
+		tokens = append(tokens, rle{int(l), 0, 0})
+		run--
+		for run >= 3 {
+			n := min(run, 6)
+			tokens = append(tokens, rle{16, 2, uint32(n - 3)})
+			run -= n
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, rle{int(l), 0, 0})
+		}
+	}
+
+	counts := make([]int, len(codeLengthCodeOrder))
+	for _, t := range tokens {
+		counts[t.symbol]++
+	}
+	codeLengthLengths := codeLengths(counts, maxCodeLengthCodeLength)
+	n := len(codeLengthCodeOrder)
+	for n > 4 && codeLengthLengths[codeLengthCodeOrder[n-1]] == 0 {
+		n--
+	}
+
+	bw.write(0, 1) // обычный код
+	bw.write(uint32(n-4), 4)
+	for _, symbol := range codeLengthCodeOrder[:n] {
+		bw.write(uint32(codeLengthLengths[symbol]), 3)
+	}
+	bw.write(0, 1) // длины заданы для всего алфавита
+
+	codes := canonicalCodes(codeLengthLengths)
+	bits := codeLengthLengths
+	if used := countUsed(counts); used == 1 {
+		bits = make([]uint8, len(codeLengthLengths))
+	}
+	for _, t := range tokens {
+		bw.write(codes[t.symbol], uint(bits[t.symbol]))
+		bw.write(t.extra, t.extraBits)
+	}
+}
+
+func countUsed(counts []int) int {
+	used := 0
+	for _, n := range counts {
+		if n > 0 {
+			used++
+		}
+	}
+	return used
+}
+
+// codeLengths строит длины кодов Хаффмана не длиннее limit. Если дерево получается глубже,
+// частоты сглаживаются и дерево строится заново
+func codeLengths(counts []int, limit uint8) []uint8 {
+	counts = append([]int(nil), counts...)
+	for {
+		lengths, depth := huffmanLengths(counts)
+		if depth <= limit {
+			return lengths
+		}
+		for i, n := range counts {
+			if n > 0 {
+				counts[i] = (n + 1) / 2
+			}
+		}
+	}
+}
+
+func huffmanLengths(counts []int) ([]uint8, uint8) {
+	lengths := make([]uint8, len(counts))
+	type node struct {
+		count       int
+		symbol      int // -1 у внутренних узлов
+		left, right int
+	}
+	var nodes []node
+	for symbol, n := range counts {
+		if n > 0 {
+			nodes = append(nodes, node{count: n, symbol: symbol})
+		}
+	}
+	if len(nodes) == 0 {
+		return lengths, 0
+	}
+	if len(nodes) == 1 {
+		lengths[nodes[0].symbol] = 1
+		return lengths, 1
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count < nodes[j].count })
+
+	// Две очереди: листья по возрастанию частоты и внутренние узлы в порядке создания, который тоже возрастающий
+	leaves := len(nodes)
+	nextLeaf, nextInner := 0, leaves
+	take := func() int {
+		if nextLeaf < leaves && (nextInner >= len(nodes) || nodes[nextLeaf].count <= nodes[nextInner].count) {
+			nextLeaf++
+			return nextLeaf - 1
+		}
+		nextInner++
+		return nextInner - 1
+	}
+	for i := 0; i < leaves-1; i++ {
+		a, b := take(), take()
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, symbol: -1, left: a, right: b})
+	}
+
+	var depth uint8
+	var walk func(i int, d uint8)
+	walk = func(i int, d uint8) {
+		if nodes[i].symbol >= 0 {
+			lengths[nodes[i].symbol] = d
+			depth = max(depth, d)
+			return
+		}
+		walk(nodes[i].left, d+1)
+		walk(nodes[i].right, d+1)
+	}
+	walk(len(nodes)-1, 0)
+	return lengths, depth
+}
+
+// canonicalCodes назначает канонические коды по длинам, как это делает декодер, и переворачивает их биты:
+// декодер читает код начиная со старшего бита, а поток пишется начиная с младшего
+func canonicalCodes(lengths []uint8) []uint32 {
+	var histogram [maxCodeLength + 1]uint32
+	for _, l := range lengths {
+		histogram[l]++
+	}
+	histogram[0] = 0
+	var next [maxCodeLength + 1]uint32
+	code := uint32(0)
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + histogram[l-1]) << 1
+		next[l] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		var reversed uint32
+		for i := uint8(0); i < l; i++ {
+			reversed = reversed<<1 | c>>i&1
+		}
+		codes[symbol] = reversed
+	}
+	return codes
+}
@@ -0,0 +1,165 @@
+package webp
+
+const (
+	numLiterals  = 256
+	numLengths   = 24
+	numDistances = 40
+
+	minMatch = 3
+	maxMatch = 4096
+	// Наибольшее расстояние, которое помещается в 40 префиксных кодов, за вычетом 120 кодов ближней окрестности
+	maxDistance = 1<<20 - 120
+	// Сколько кандидатов проверяется при поиске совпадения
+	maxChain = 32
+	hashBits = 16
+
+	colorCacheMultiplier = 0x1e35a7bd
+)
+
+// Таблица кодов ближней окрестности (раздел 4.2.2): старшие 4 бита - смещение по y, младшие - 8 минус смещение по x
+var distanceMapTable = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+type tokenKind uint8
+
+const (
+	tokenLiteral tokenKind = iota
+	tokenCache
+	tokenCopy
+)
+
+// token - литерал (value - цвет), обращение к цветовому кэшу (value - индекс)
+// или копия length пикселей с кодом расстояния value
+type token struct {
+	kind   tokenKind
+	value  uint32
+	length int
+}
+
+// tokenize разбивает пиксели на литералы, обращения к кэшу и копии. Кэш ведётся так же, как в декодере:
+// в него попадает каждый пиксель, в том числе скопированный
+func tokenize(argb []uint32, width int, cacheBits uint) []token {
+	distanceCodes := planeCodes(width)
+
+	var cache []uint32
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+	remember := func(p uint32) {
+		if cache != nil {
+			cache[(p*colorCacheMultiplier)>>(32-cacheBits)] = p
+		}
+	}
+
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, len(argb))
+	insert := func(i int) {
+		if i+1 < len(argb) {
+			h := hashPair(argb[i], argb[i+1])
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	var tokens []token
+	for i := 0; i < len(argb); {
+		bestLen, bestDist := 0, 0
+		if i+minMatch <= len(argb) {
+			limit := min(maxMatch, len(argb)-i)
+			cand := head[hashPair(argb[i], argb[i+1])]
+			for tries := 0; cand >= 0 && tries < maxChain && i-int(cand) <= maxDistance; tries++ {
+				c := int(cand)
+				n := 0
+				for n < limit && argb[c+n] == argb[i+n] {
+					n++
+				}
+				if n > bestLen {
+					bestLen, bestDist = n, i-c
+					if n == limit {
+						break
+					}
+				}
+				cand = prev[c]
+			}
+		}
+
+		if bestLen >= minMatch {
+			code, ok := distanceCodes[bestDist]
+			if !ok {
+				code = uint32(bestDist + len(distanceMapTable))
+			}
+			tokens = append(tokens, token{kind: tokenCopy, value: code, length: bestLen})
+			for j := i; j < i+bestLen; j++ {
+				insert(j)
+				remember(argb[j])
+			}
+			i += bestLen
+			continue
+		}
+
+		p := argb[i]
+		if cache != nil {
+			if idx := (p * colorCacheMultiplier) >> (32 - cacheBits); cache[idx] == p {
+				tokens = append(tokens, token{kind: tokenCache, value: idx})
+				insert(i)
+				i++
+				continue
+			}
+		}
+		tokens = append(tokens, token{kind: tokenLiteral, value: p})
+		insert(i)
+		remember(p)
+		i++
+	}
+	return tokens
+}
+
+func hashPair(a, b uint32) uint32 {
+	return (a*colorCacheMultiplier ^ b*0x9e3779b1) >> (32 - hashBits)
+}
+
+// planeCodes сопоставляет линейным расстояниям коды ближней окрестности для картинки шириной width.
+// Если одному расстоянию соответствует несколько кодов, берётся меньший
+func planeCodes(width int) map[int]uint32 {
+	codes := make(map[int]uint32, len(distanceMapTable))
+	for i := len(distanceMapTable) - 1; i >= 0; i-- {
+		c := int(distanceMapTable[i])
+		yOffset, xOffset := c>>4, 8-c&0xf
+		d := yOffset*width + xOffset
+		if d < 1 {
+			d = 1
+		}
+		codes[d] = uint32(i + 1)
+	}
+	return codes
+}
+
+// prefixCode разбивает длину или код расстояния (от 1) на префиксный символ и дополнительные биты
+func prefixCode(v int) (symbol int, extraBits uint, extra uint32) {
+	v--
+	if v < 4 {
+		return v, 0, 0
+	}
+	highest := 31
+	for v>>highest == 0 {
+		highest--
+	}
+	second := v >> (highest - 1) & 1
+	extraBits = uint(highest - 1)
+	return 2*highest + second, extraBits, uint32(v) & (1<<extraBits - 1)
+}
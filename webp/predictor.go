@@ -0,0 +1,153 @@
+package webp
+
+// predict заменяет пиксели argb остатками предсказания и возвращает картинку режимов: для каждого блока
+// выбирается режим с наименьшей суммой остатков. Режим хранится в зелёном канале
+func predict(argb []uint32, width, height int) []uint32 {
+	tw, th := tiles(width), tiles(height)
+	modes := make([]uint32, tw*th)
+	for ty := 0; ty < th; ty++ {
+		for tx := 0; tx < tw; tx++ {
+			modes[ty*tw+tx] = 0xff000000 | uint32(bestMode(argb, width, height, tx, ty))<<8
+		}
+	}
+
+	// Остатки считаются по исходным пикселям, поэтому идём с конца, чтобы не затереть соседей раньше времени
+	for i := len(argb) - 1; i >= 0; i-- {
+		x, y := i%width, i/width
+		var p uint32
+		switch {
+		case x == 0 && y == 0:
+			p = 0xff000000
+		case y == 0:
+			p = argb[i-1]
+		case x == 0:
+			p = argb[i-width]
+		default:
+			mode := int(modes[(y>>predictorBits)*tw+x>>predictorBits] >> 8 & 0x0f)
+			p = predictPixel(mode, argb, i, width)
+		}
+		argb[i] = subPixels(argb[i], p)
+	}
+	return modes
+}
+
+func bestMode(argb []uint32, width, height, tx, ty int) int {
+	x0, y0 := max(tx<<predictorBits, 1), max(ty<<predictorBits, 1)
+	x1, y1 := min((tx+1)<<predictorBits, width), min((ty+1)<<predictorBits, height)
+
+	best, bestCost := 1, -1
+	for mode := 1; mode <= 13; mode++ {
+		cost := 0
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				i := y*width + x
+				cost += residualCost(subPixels(argb[i], predictPixel(mode, argb, i, width)))
+			}
+		}
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = mode, cost
+		}
+	}
+	return best
+}
+
+// predictPixel возвращает предсказание для пикселя i не в первой строке и не в первом столбце.
+// Для последнего столбца «правый верхний» сосед по спецификации - первый пиксель текущей строки,
+// что совпадает с argb[i-width+1]
+func predictPixel(mode int, argb []uint32, i, width int) uint32 {
+	l, t, tr, tl := argb[i-1], argb[i-width], argb[i-width+1], argb[i-width-1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPixel(l, t, tl)
+	case 12:
+		return clampAddSubtractFull(l, t, tl)
+	}
+	return clampAddSubtractHalf(average2(l, t), tl)
+}
+
+// average2 - среднее по каждому каналу с округлением вниз
+func average2(a, b uint32) uint32 {
+	return ((a^b)&0xfefefefe)>>1 + a&b
+}
+
+func selectPixel(l, t, tl uint32) uint32 {
+	pl, pt := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		ch := func(p uint32) int { return int(p >> shift & 0xff) }
+		pl += abs(ch(tl) - ch(t))
+		pt += abs(ch(tl) - ch(l))
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(a>>shift&0xff) + int(b>>shift&0xff) - int(c>>shift&0xff)
+		p |= clamp(v) << shift
+	}
+	return p
+}
+
+func clampAddSubtractHalf(a, b uint32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		ca, cb := int(a>>shift&0xff), int(b>>shift&0xff)
+		p |= clamp(ca+(ca-cb)/2) << shift
+	}
+	return p
+}
+
+func clamp(v int) uint32 {
+	return uint32(min(max(v, 0), 255))
+}
+
+// subPixels вычитает по каждому каналу по модулю 256
+func subPixels(a, b uint32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		p |= (a>>shift - b>>shift) & 0xff << shift
+	}
+	return p
+}
+
+// residualCost - сумма модулей остатков по каналам, остаток трактуется как число со знаком
+func residualCost(p uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		cost += abs(int(int8(p >> shift)))
+	}
+	return cost
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+// Package webp кодирует картинки в WebP без потерь (VP8L). Используются преобразования subtract green
+// и predictor, LZ77 с цветовым кэшем и одна группа префиксных кодов на всю картинку. Этого хватает,
+// чтобы графика и скриншоты получались заметно меньше PNG; фотографии без потерь обычно больше JPEG.
+// Спецификация: RFC 9649
+package webp
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Максимальная ширина и высота, которые помещаются в 14-битные поля заголовка VP8L
+const maxDimension = 1 << 14
+
+const (
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+)
+
+// Размер блока predictor: 1<<predictorBits пикселей
+const predictorBits = 4
+
+// Размер цветового кэша основной картинки: 1<<cacheBits цветов
+const cacheBits = 10
+
+// Encode записывает m в w в формате WebP без потерь
+func Encode(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxDimension || height > maxDimension {
+		return errors.New("webp: размер картинки должен быть от 1 до 16384 пикселей")
+	}
+
+	argb, opaque := pixels(m)
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8) // сигнатура VP8L
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3) // версия
+
+	// Преобразования применяются в порядке записи, декодер отменяет их в обратном
+	subtractGreen(argb)
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+
+	modes := predict(argb, width, height)
+	bw.write(1, 1)
+	bw.write(transformPredictor, 2)
+	bw.write(predictorBits-2, 3)
+	encodeImage(bw, modes, tiles(width), 0, false)
+
+	bw.write(0, 1) // преобразований больше нет
+	encodeImage(bw, argb, width, cacheBits, true)
+
+	data := bw.bytes()
+	pad := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if pad == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// pixels возвращает пиксели m в порядке строк в формате ARGB без премультипликации
+// и признак того, что картинка полностью непрозрачна
+func pixels(m image.Image) ([]uint32, bool) {
+	b := m.Bounds()
+	argb := make([]uint32, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			if c.A != 0xff {
+				opaque = false
+			}
+			argb = append(argb, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+		}
+	}
+	return argb, opaque
+}
+
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+func tiles(size int) int {
+	return (size + 1<<predictorBits - 1) >> predictorBits
+}
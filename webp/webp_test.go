@@ -0,0 +1,88 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+func fill(w, h int, at func(x, y int) color.NRGBA) *image.NRGBA {
+	m := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.SetNRGBA(x, y, at(x, y))
+		}
+	}
+	return m
+}
+
+// Кодирование без потерь: декодер из golang.org/x/image/webp должен вернуть те же пиксели
+func TestEncodeRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	noise := func(x, y int) color.NRGBA {
+		return color.NRGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 0xff}
+	}
+	palette := []color.NRGBA{{0x20, 0x40, 0x80, 0xff}, {0xff, 0xff, 0xff, 0xff}, {0xe0, 0x10, 0x10, 0xff}}
+
+	tests := []struct {
+		name string
+		m    image.Image
+	}{
+		{"один пиксель", fill(1, 1, func(x, y int) color.NRGBA { return color.NRGBA{1, 2, 3, 0xff} })},
+		{"градиент не кратен блоку predictor", fill(37, 23, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 7), uint8(y * 11), uint8(x + y), 0xff}
+		})},
+		{"шум", fill(64, 64, noise)},
+		{"один цвет", fill(300, 200, func(x, y int) color.NRGBA { return color.NRGBA{0x33, 0x66, 0x99, 0xff} })},
+		{"повторяющийся узор", fill(256, 64, func(x, y int) color.NRGBA { return palette[(x/3+y)%len(palette)] })},
+		{"прозрачность", fill(50, 40, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 5), 0x80, uint8(y * 6), uint8(x * y % 256)}
+		})},
+		{"широкая", fill(2000, 3, func(x, y int) color.NRGBA { return palette[x*y%len(palette)] })},
+		{"высокая", fill(3, 2000, func(x, y int) color.NRGBA { return color.NRGBA{uint8(y), uint8(y >> 8), uint8(x), 0xff} })},
+		{"фото", fill(640, 480, func(x, y int) color.NRGBA {
+			n := uint8(rnd.Intn(8))
+			return color.NRGBA{uint8(x*255/640) + n, uint8(y*255/480) + n, 0x80 + n, 0xff}
+		})},
+		{"не с нуля и не NRGBA", image.NewRGBA(image.Rect(10, 20, 30, 35))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.m); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := xwebp.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("декодер не прочитал результат: %v", err)
+			}
+
+			b := tt.m.Bounds()
+			if decoded.Bounds().Dx() != b.Dx() || decoded.Bounds().Dy() != b.Dy() {
+				t.Fatalf("размер %v, ожидался %v", decoded.Bounds(), b)
+			}
+			db := decoded.Bounds()
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					want := color.NRGBAModel.Convert(tt.m.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+					got := color.NRGBAModel.Convert(decoded.At(db.Min.X+x, db.Min.Y+y)).(color.NRGBA)
+					if got != want {
+						t.Fatalf("пиксель (%d, %d): %v, ожидался %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeSize(t *testing.T) {
+	for _, r := range []image.Rectangle{image.Rect(0, 0, 0, 10), image.Rect(0, 0, maxDimension+1, 1)} {
+		if err := Encode(&bytes.Buffer{}, image.NewNRGBA(r)); err == nil {
+			t.Errorf("картинка %v закодирована", r)
+		}
+	}
+}